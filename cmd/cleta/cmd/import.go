@@ -0,0 +1,94 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/store"
+	"github.com/spf13/cobra"
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import [file or name]...",
+	Short: "Import documents into a sqlite store",
+	Long: `Import adds JSON or YAML document files to a sqlite store, named by
+their absolute paths. Importing a file again, by any path, replaces its
+document, and with --remove the documents of the given files are removed
+instead.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := core.NewNopServer()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		s, err := store.NewSQLiteStore(c, metadataStoreSQLite)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer s.Close()
+
+		failed := false
+		for _, arg := range args {
+			// "./a.json" and "a.json" are the same document
+			name, err := filepath.Abs(arg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", arg, err)
+				failed = true
+				continue
+			}
+			if importRemove {
+				err = s.DeleteDocument(context.Background(), name)
+			} else {
+				err = importFile(s, name)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", arg, err)
+				failed = true
+			}
+		}
+		if failed {
+			s.Close()
+			os.Exit(1)
+		}
+	},
+}
+
+var importRemove bool
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().StringVar(&metadataStoreSQLite, "metadata-store-sqlite", "cleta.sqlite", "path of the sqlite database, created if it doesn't exist")
+	importCmd.Flags().BoolVar(&importRemove, "remove", false, "remove the named documents")
+}
+
+func importFile(s *store.SQLiteStore, path string) error {
+	d, err := store.ReadDocumentFile(path)
+	if err != nil {
+		return err
+	}
+
+	return s.PutDocument(context.Background(), path, d)
+}
@@ -22,10 +22,16 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/amari/cloud-metadata-server/internal/pkg/arp"
+	"github.com/amari/cloud-metadata-server/internal/pkg/netns"
+	"github.com/amari/cloud-metadata-server/internal/pkg/proxyproto"
+	"github.com/amari/cloud-metadata-server/pkg/apiserver"
 	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/identity"
 	"github.com/amari/cloud-metadata-server/pkg/metadataserver"
 	"github.com/amari/cloud-metadata-server/pkg/store"
 	"go.uber.org/zap"
@@ -50,16 +56,42 @@ to quickly create a Cobra application.`,
 			panic("")
 		}
 
+		if neighborTableRefreshInterval < minNeighborTableRefreshInterval {
+			c.Log().Fatal("neighbor table refresh interval too short", zap.Duration("neighborTableRefreshInterval", neighborTableRefreshInterval), zap.Duration("minimum", minNeighborTableRefreshInterval))
+		}
+
+		// parse the trusted proxies
+		trustedProxies, err := proxyproto.ParseTrusted(trustedProxySlice)
+		if err != nil {
+			c.Log().Fatal("invalid trusted proxy", zap.NamedError("error", err))
+		}
+		if metadataProxyProtocol && len(trustedProxies) == 0 {
+			c.Log().Fatal("the PROXY protocol needs at least one trusted proxy")
+		}
+
 		// bind metadataListeners
 		if len(metadataBindAddrSlice) == 0 {
 			c.Log().Fatal("needs at least one bind address")
 		}
-		metadataListeners := make([]*net.TCPListener, 0, len(metadataBindAddrSlice))
+		metadataListeners := make([]net.Listener, 0, len(metadataBindAddrSlice))
+		// the network namespaces guests are served in, "" is our own
+		var namespaces []string
 		for _, addr := range metadataBindAddrSlice {
-			hostStr, portStr, err := net.SplitHostPort(addr)
+			// addresses may be prefixed with the network namespace to
+			// listen in, e.g. tenant-a/169.254.169.254:80
+			namespace, hostPortStr := "", addr
+			if i := strings.IndexByte(addr, '/'); i >= 0 {
+				namespace, hostPortStr = addr[:i], addr[i+1:]
+			}
+			hostStr, portStr, err := net.SplitHostPort(hostPortStr)
 			if err != nil {
 				c.Log().Fatal("invalid bind address", zap.String("bindAddress", addr), zap.NamedError("error", err))
 			}
+			// link-local IPv6 addresses name the interface to bind to
+			zone := ""
+			if i := strings.LastIndexByte(hostStr, '%'); i >= 0 {
+				hostStr, zone = hostStr[:i], hostStr[i+1:]
+			}
 			ip := net.ParseIP(hostStr)
 			if ip == nil {
 				c.Log().Fatal("invalid ip address", zap.String("bindAddress", addr))
@@ -68,23 +100,31 @@ to quickly create a Cobra application.`,
 			if err != nil {
 				c.Log().Fatal("invalid port", zap.String("bindAddress", addr))
 			}
-			metadataListener, err := net.ListenTCP("tcp4", &net.TCPAddr{
-				IP:   ip,
-				Port: int(port),
-				Zone: "",
+			var metadataListener net.Listener
+			err = netns.Do(namespace, func() (err error) {
+				metadataListener, err = net.ListenTCP("tcp", &net.TCPAddr{
+					IP:   ip,
+					Port: int(port),
+					Zone: zone,
+				})
+				return err
 			})
 			if err != nil {
 				c.Log().Fatal("failed to create tcp listener", zap.String("bindAddress", addr), zap.NamedError("error", err))
 			}
-			c.Log().Info("started metadata server", zap.String("address", metadataListener.Addr().String()))
-			metadataListeners = append(metadataListeners, metadataListener)
+			c.Log().Info("started metadata server", zap.String("address", metadataListener.Addr().String()), zap.String("namespace", namespace))
+			if metadataProxyProtocol {
+				metadataListener = proxyproto.NewListener(metadataListener, trustedProxies, metadataProxyProtocolTimeout)
+			}
+			metadataListeners = append(metadataListeners, netns.NewListener(metadataListener, namespace))
+			namespaces = append(namespaces, namespace)
 		}
 
 		// initialize the store
 		var s store.Store
 		switch metadataStore {
 		case "dir":
-			dirStore, err := store.NewDirStore(c, metadataStoreDirCacheSize)
+			dirStore, err := store.NewDirStore(c, metadataStoreDirCacheSize, metadataStoreDirStrict)
 			if err != nil {
 				c.Log().Fatal("failed to create directory store", zap.NamedError("error", err))
 			}
@@ -95,18 +135,85 @@ to quickly create a Cobra application.`,
 				}
 			}
 			s = dirStore
+		case "sqlite":
+			sqliteStore, err := store.NewSQLiteStore(c, metadataStoreSQLite)
+			if err != nil {
+				c.Log().Fatal("failed to open sqlite store", zap.NamedError("error", err), zap.String("path", metadataStoreSQLite))
+			}
+			s = sqliteStore
 		default:
 			c.Log().Fatal("unknown metadata store", zap.String("metadataStore", metadataStore))
 		}
 
-		// initialize the metadata server
-		metadataSrvRoot, err := metadataserver.NewHTTPServer(c, s, neighborTableRefreshInterval)
-		if err != nil {
-			c.Log().Fatal("failed to create metadata server", zap.NamedError("error", err))
+		// initialize the identity resolvers, in priority order
+		if len(identitySlice) == 0 {
+			c.Log().Fatal("needs at least one identity resolver")
+		}
+		var resolvers identity.Chain
+		for _, name := range identitySlice {
+			switch name {
+			case "neighbor":
+				neighborStates, err := arp.ParseStates(neighborStateSlice)
+				if err != nil {
+					c.Log().Fatal("invalid neighbor state", zap.Strings("neighborStates", neighborStateSlice), zap.NamedError("error", err))
+				}
+				resolver, err := identity.NewNeighborResolver(neighborTableRefreshInterval, arp.Filter{
+					Interfaces: neighborInterfaceSlice,
+					States:     neighborStates,
+				}, neighborProbeTimeout, namespaces)
+				if err != nil {
+					c.Log().Fatal("failed to create neighbor identity resolver", zap.NamedError("error", err))
+				}
+				resolvers = append(resolvers, resolver)
+			case "static":
+				resolver, err := identity.NewStaticResolver(identityStaticMap)
+				if err != nil {
+					c.Log().Fatal("failed to create static identity resolver", zap.NamedError("error", err))
+				}
+				resolvers = append(resolvers, resolver)
+			case "dnsmasq", "dhcpd":
+				paths, format := identityDnsmasqLeasesSlice, identity.LeaseFormatDnsmasq
+				if name == "dhcpd" {
+					paths, format = identityDhcpdLeasesSlice, identity.LeaseFormatDhcpd
+				}
+				for _, path := range paths {
+					resolver, err := identity.NewLeaseFileResolver(path, format)
+					if err != nil {
+						c.Log().Fatal("failed to create lease file identity resolver", zap.NamedError("error", err), zap.String("path", path))
+					}
+					resolvers = append(resolvers, resolver)
+				}
+			case "libvirt":
+				for _, dir := range identityLibvirtDirSlice {
+					resolver, err := identity.NewLibvirtResolver(dir)
+					if err != nil {
+						c.Log().Fatal("failed to create libvirt identity resolver", zap.NamedError("error", err), zap.String("path", dir))
+					}
+					resolvers = append(resolvers, resolver)
+				}
+			default:
+				c.Log().Fatal("unknown identity resolver", zap.String("identity", name))
+			}
+		}
+		var resolver identity.Resolver = resolvers
+		if identityBridgeVerify {
+			bridgeResolver, err := identity.NewBridgeResolver(resolvers, neighborTableRefreshInterval, namespaces)
+			if err != nil {
+				c.Log().Fatal("failed to create bridge identity resolver", zap.NamedError("error", err))
+			}
+			resolver = bridgeResolver
 		}
 
+		// initialize the metadata server
+		metadataSrvRoot := metadataserver.NewHTTPServer(c, s, resolver, metadataserver.TrustedProxies{
+			CIDRs:              trustedProxies,
+			DataLinkAddrHeader: trustedProxyDataLinkAddrHeader,
+		})
+
 		metadataSrv := http.Server{
-			Handler: metadataSrvRoot,
+			Handler:     metadataSrvRoot,
+			BaseContext: metadataSrvRoot.BaseContext,
+			ConnContext: metadataSrvRoot.ConnContext,
 		}
 		for _, metadataListener := range metadataListeners {
 			go func(listener net.Listener) {
@@ -118,18 +225,54 @@ to quickly create a Cobra application.`,
 		}
 
 		// initialize the api server
+		var apiSrv *http.Server
+		if apiBindAddr != "" {
+			apiListener, err := net.Listen("tcp", apiBindAddr)
+			if err != nil {
+				c.Log().Fatal("failed to create tcp listener", zap.String("bindAddress", apiBindAddr), zap.NamedError("error", err))
+			}
+			c.Log().Info("started api server", zap.String("address", apiListener.Addr().String()))
+			apiSrv = &http.Server{
+				Handler: apiserver.NewHTTPServer(c, s),
+			}
+			go func() {
+				err := apiSrv.Serve(apiListener)
+				if err != nil && err != http.ErrServerClosed {
+					c.Log().Fatal("failed to create api server", zap.NamedError("error", err))
+				}
+			}()
+		}
 
 		// wait for shutdown
-		waitForShutdown(&metadataSrv, nil)
+		waitForShutdown(&metadataSrv, apiSrv)
 	},
 }
 
+// minNeighborTableRefreshInterval keeps polling from eating a CPU.
+const minNeighborTableRefreshInterval = 100 * time.Millisecond
+
 var metadataBindAddrSlice []string
+var metadataProxyProtocol bool
+var metadataProxyProtocolTimeout time.Duration
 var metadataStore string
 var metadataStoreDirSlice []string
 var metadataStorePostgres string
+var metadataStoreSQLite string
 var metadataStoreDirCacheSize int
+var metadataStoreDirStrict bool
+var apiBindAddr string
 var neighborTableRefreshInterval time.Duration
+var neighborInterfaceSlice []string
+var neighborStateSlice []string
+var neighborProbeTimeout time.Duration
+var identitySlice []string
+var identityStaticMap map[string]string
+var identityDnsmasqLeasesSlice []string
+var identityDhcpdLeasesSlice []string
+var identityLibvirtDirSlice []string
+var identityBridgeVerify bool
+var trustedProxySlice []string
+var trustedProxyDataLinkAddrHeader string
 
 func init() {
 	rootCmd.AddCommand(serveCmd)
@@ -143,12 +286,28 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// serveCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
-	serveCmd.Flags().StringSliceVar(&metadataBindAddrSlice, "metadata-bind-addr", []string{"169.254.169.254:80"}, "")
-	serveCmd.Flags().StringVar(&metadataStore, "metadata-store", "", "dir, postgres, mariadb, mysql")
+	serveCmd.Flags().StringSliceVar(&metadataBindAddrSlice, "metadata-bind-addr", []string{"169.254.169.254:80"}, "IPv4 or IPv6 address to serve metadata on, e.g. [fd00:ec2::254]:80 or [fe80::a9fe:a9fe%br0]:80, optionally in a named network namespace, e.g. tenant-a/169.254.169.254:80")
+	serveCmd.Flags().BoolVar(&metadataProxyProtocol, "metadata-proxy-protocol", false, "accept PROXY protocol v1 and v2 headers from trusted proxies")
+	serveCmd.Flags().DurationVar(&metadataProxyProtocolTimeout, "metadata-proxy-protocol-timeout", 5*time.Second, "how long a trusted proxy has to send its PROXY protocol header")
+	serveCmd.Flags().StringVar(&metadataStore, "metadata-store", "", "dir, sqlite, postgres, mariadb, mysql")
 	serveCmd.Flags().StringSliceVar(&metadataStoreDirSlice, "metadata-store-dir", nil, "")
 	serveCmd.Flags().StringVar(&metadataStorePostgres, "metadata-store-postgres", "", "")
+	serveCmd.Flags().StringVar(&metadataStoreSQLite, "metadata-store-sqlite", "cleta.sqlite", "path of the sqlite database, created if it doesn't exist")
 	serveCmd.Flags().IntVar(&metadataStoreDirCacheSize, "metadata-store-dir-cache-size", 128, "")
-	serveCmd.Flags().DurationVar(&neighborTableRefreshInterval, "neighbor-table-refresh-interval", 1*time.Millisecond, "")
+	serveCmd.Flags().BoolVar(&metadataStoreDirStrict, "metadata-store-dir-strict", false, "don't serve MAC addresses that more than one document claims as the same kind, instead of serving the first in --metadata-store-dir order")
+	serveCmd.Flags().StringVar(&apiBindAddr, "api-bind-addr", "", "address to serve the administrative API on, e.g. 127.0.0.1:8080, off if empty")
+	serveCmd.Flags().StringSliceVar(&identitySlice, "identity", []string{"neighbor"}, "how to identify guests, in priority order: neighbor, static, dnsmasq, dhcpd, libvirt")
+	serveCmd.Flags().StringToStringVar(&identityStaticMap, "identity-static", nil, "IP to MAC address map for the static identity resolver, e.g. 10.0.0.5=52:54:00:12:34:56")
+	serveCmd.Flags().StringSliceVar(&identityDnsmasqLeasesSlice, "identity-dnsmasq-leases", []string{"/var/lib/misc/dnsmasq.leases"}, "")
+	serveCmd.Flags().StringSliceVar(&identityDhcpdLeasesSlice, "identity-dhcpd-leases", []string{"/var/lib/dhcp/dhcpd.leases"}, "")
+	serveCmd.Flags().StringSliceVar(&identityLibvirtDirSlice, "identity-libvirt-dir", []string{"/var/run/libvirt/qemu"}, "directories of libvirt domain XML")
+	serveCmd.Flags().BoolVar(&identityBridgeVerify, "identity-bridge-verify", false, "only accept MAC addresses the bridge a request arrived on has learned behind the port they were first seen on")
+	serveCmd.Flags().StringSliceVar(&trustedProxySlice, "trusted-proxy", nil, "CIDRs of proxies whose PROXY protocol headers and X-Forwarded-For are honored, e.g. 10.0.0.0/24")
+	serveCmd.Flags().StringVar(&trustedProxyDataLinkAddrHeader, "trusted-proxy-data-link-addr-header", "", "header trusted proxies send the guest's MAC address in, e.g. X-Guest-MAC")
+	serveCmd.Flags().StringSliceVar(&neighborInterfaceSlice, "neighbor-interface", nil, "only identify guests by neighbors learned on these interfaces (name or index)")
+	serveCmd.Flags().StringSliceVar(&neighborStateSlice, "neighbor-state", nil, "acceptable neighbor states, default reachable,stale,delay,probe,permanent")
+	serveCmd.Flags().DurationVar(&neighborProbeTimeout, "neighbor-probe-timeout", 0, "if set, send an ARP request or neighbor solicitation for unknown callers and wait this long for a reply")
+	serveCmd.Flags().DurationVar(&neighborTableRefreshInterval, "neighbor-table-refresh-interval", 1*time.Second, "how often to poll the neighbor table and bridge forwarding databases where changes aren't reported by the kernel, at least 100ms")
 }
 
 func waitForShutdown(metadataSrv *http.Server, apiSrv *http.Server) {
@@ -24,7 +24,7 @@ import (
 )
 
 func main() {
-	arpTable, _ := arp.NewTable()
+	arpTable, _ := arp.NewTable("")
 	defer arpTable.Close()
 
 	if err := arpTable.Poll(context.Background(), func(_ context.Context, entry arp.Entry) {
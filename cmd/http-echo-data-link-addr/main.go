@@ -21,6 +21,7 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/amari/cloud-metadata-server/internal/pkg/arp"
@@ -28,13 +29,14 @@ import (
 )
 
 func main() {
-	arpWatcher, err := arp.NewWatcher(1 * time.Millisecond)
+	arpWatcher, err := arp.NewWatcher(1*time.Millisecond, arp.Filter{})
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	listener, err := net.ListenTCP("tcp4", &net.TCPAddr{
-		IP:   net.ParseIP("0.0.0.0"),
+	// dual-stack, so both ARP and NDP neighbors can be echoed
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{
+		IP:   net.ParseIP("::"),
 		Port: 0,
 		Zone: "",
 	})
@@ -52,15 +54,20 @@ func main() {
 				http.Error(w, "not found", http.StatusNotFound)
 				return
 			}
+			// link-local IPv6 callers carry the zone of the interface they came in on
+			zone := ""
+			if i := strings.LastIndexByte(host, '%'); i >= 0 {
+				host, zone = host[:i], host[i+1:]
+			}
 			remoteIP := net.ParseIP(host)
 			if remoteIP == nil {
 				http.Error(w, "not found", http.StatusNotFound)
 				return
 			}
-			addr := arpWatcher.GetHardwareAddrForIP4(remoteIP)
+			addr := arpWatcher.GetHardwareAddrForIP(remoteIP, zone)
 			if addr == nil {
 				arpWatcher.ForcePoll()
-				addr = arpWatcher.GetHardwareAddrForIP4(remoteIP)
+				addr = arpWatcher.GetHardwareAddrForIP(remoteIP, zone)
 			}
 			if addr == nil {
 				http.Error(w, "not found", http.StatusNotFound)
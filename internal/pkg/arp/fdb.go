@@ -0,0 +1,256 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package arp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/amari/cloud-metadata-server/internal/pkg/netns"
+)
+
+// An FDBEntry is a bridge forwarding database entry: a hardware address a
+// bridge learned behind one of its ports.
+type FDBEntry struct {
+	HardwareAddr net.HardwareAddr
+	// PortIndex is the interface index of the bridge port.
+	PortIndex int
+	// BridgeIndex is the interface index of the bridge, 0 if the entry
+	// belongs to the port itself.
+	BridgeIndex int
+	// VLAN is the VLAN ID, 0 if none.
+	VLAN  int
+	State State
+}
+
+// Local reports whether the entry is an address of the host, e.g. of the
+// port, rather than one learned from traffic.
+func (e *FDBEntry) Local() bool {
+	return e.State&Permanent != 0
+}
+
+type FDBPollFunc func(context.Context, FDBEntry)
+
+// An FDBUpdate is a change to a bridge forwarding database.
+type FDBUpdate struct {
+	FDBEntry
+	Deleted bool
+}
+
+type FDBUpdateFunc func(context.Context, FDBUpdate)
+
+// An FDBWatcher keeps track of which bridge port each hardware address lives
+// behind. An address is pinned to the first port it's learned behind until
+// that port goes away, so a guest taking over another's address shows up as
+// the address moving rather than the guest silently taking its place.
+type FDBWatcher struct {
+	table     *Table
+	namespace string
+
+	// learned entries by hardware address
+	entriesByAddr map[string][]FDBEntry
+	// bridges are the bridges with learned entries
+	bridges map[int]struct{}
+	// pins are the ports addresses were first learned behind, by bridge and
+	// address. They outlive the entries, which age out of idle guests.
+	pins map[fdbKey]int
+
+	lock   *sync.RWMutex
+	update *sync.Mutex
+	done   chan struct{}
+
+	fdbWatchState
+}
+
+type fdbKey struct {
+	bridgeIndex int
+	addr        string
+}
+
+// NewFDBWatcher keeps track of the forwarding databases of the bridges in
+// the named network namespace, or of the process if namespace is empty. Where
+// the system reports changes as they happen d is only used if that fails,
+// otherwise the databases are polled every d.
+func NewFDBWatcher(d time.Duration, namespace string) (*FDBWatcher, error) {
+	table, err := NewTable(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher := &FDBWatcher{
+		table:         table,
+		namespace:     namespace,
+		entriesByAddr: map[string][]FDBEntry{},
+		bridges:       map[int]struct{}{},
+		pins:          map[fdbKey]int{},
+		lock:          &sync.RWMutex{},
+		update:        &sync.Mutex{},
+		done:          make(chan struct{}, 1),
+	}
+
+	if err := watcher.watch(d); err != nil {
+		table.Close()
+		return nil, err
+	}
+
+	return watcher, nil
+}
+
+func (w *FDBWatcher) Close() error {
+	close(w.done)
+	w.stopWatching()
+
+	return w.table.Close()
+}
+
+// poll polls the databases every d until the watcher is closed.
+func (w *FDBWatcher) poll(d time.Duration) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.ForcePoll()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// ForcePoll reads the databases again, and frees the addresses pinned to
+// ports that no longer exist.
+func (w *FDBWatcher) ForcePoll() error {
+	w.update.Lock()
+	defer w.update.Unlock()
+
+	entriesByAddr := map[string][]FDBEntry{}
+	bridges := map[int]struct{}{}
+
+	err := w.table.PollFDB(context.Background(), func(_ context.Context, entry FDBEntry) {
+		if entry.BridgeIndex == 0 || entry.Local() {
+			return
+		}
+		key := entry.HardwareAddr.String()
+		entriesByAddr[key] = append(entriesByAddr[key], entry)
+		bridges[entry.BridgeIndex] = struct{}{}
+	})
+	if err != nil {
+		return err
+	}
+
+	var ifis []net.Interface
+	err = netns.Do(w.namespace, func() (err error) {
+		ifis, err = net.Interfaces()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	ports := make(map[int]struct{}, len(ifis))
+	for _, ifi := range ifis {
+		ports[ifi.Index] = struct{}{}
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.entriesByAddr = entriesByAddr
+	w.bridges = bridges
+	for key, port := range w.pins {
+		if _, ok := ports[port]; !ok {
+			delete(w.pins, key)
+		}
+	}
+	for _, entries := range entriesByAddr {
+		for i := range entries {
+			w.pin(&entries[i])
+		}
+	}
+
+	return nil
+}
+
+// pin pins the address of entry to its port unless it's pinned already. The
+// caller must hold the write lock.
+func (w *FDBWatcher) pin(entry *FDBEntry) {
+	key := fdbKey{entry.BridgeIndex, entry.HardwareAddr.String()}
+	if _, ok := w.pins[key]; !ok {
+		w.pins[key] = entry.PortIndex
+	}
+}
+
+// IsBridge reports whether ifIndex is a bridge that learned addresses.
+func (w *FDBWatcher) IsBridge(ifIndex int) bool {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	_, ok := w.bridges[ifIndex]
+	return ok
+}
+
+// Port returns the port of the bridge addr lives behind. It reports false if
+// the bridge hasn't learned addr, or learned it behind a port other than the
+// one it's pinned to while that port still exists.
+func (w *FDBWatcher) Port(addr net.HardwareAddr, bridgeIndex int) (int, bool) {
+	key := fdbKey{bridgeIndex, addr.String()}
+
+	w.lock.RLock()
+	pin, pinned := w.pins[key]
+	port, found, moved := 0, false, false
+	for _, entry := range w.entriesByAddr[key.addr] {
+		if entry.BridgeIndex != bridgeIndex {
+			continue
+		}
+		port, found = entry.PortIndex, true
+		if entry.PortIndex != pin {
+			moved = true
+		}
+	}
+	w.lock.RUnlock()
+
+	if !found || !pinned {
+		return 0, false
+	}
+	if !moved {
+		return pin, true
+	}
+	// the address may have moved because its guest moved to a new port, in
+	// which case the old one is gone
+	if w.portExists(pin) {
+		return 0, false
+	}
+
+	w.lock.Lock()
+	if w.pins[key] == pin {
+		w.pins[key] = port
+	}
+	w.lock.Unlock()
+
+	return port, true
+}
+
+func (w *FDBWatcher) portExists(ifIndex int) bool {
+	err := netns.Do(w.namespace, func() error {
+		_, err := net.InterfaceByIndex(ifIndex)
+		return err
+	})
+
+	return err == nil
+}
@@ -0,0 +1,44 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package arp
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errNoFDB = errors.New("Bridge forwarding databases are not supported")
+
+// PollFDB fails, the bridges here don't expose their forwarding databases.
+func (a *Table) PollFDB(ctx context.Context, f FDBPollFunc) error {
+	return errNoFDB
+}
+
+type fdbWatchState struct{}
+
+func (w *FDBWatcher) watch(d time.Duration) error {
+	if err := w.ForcePoll(); err != nil {
+		return err
+	}
+
+	go w.poll(d)
+
+	return nil
+}
+
+func (w *FDBWatcher) stopWatching() {}
@@ -0,0 +1,157 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package arp
+
+import (
+	"context"
+	"time"
+
+	"github.com/amari/cloud-metadata-server/internal/pkg/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// PollFDB polls the forwarding databases of the bridges.
+func (t *Table) PollFDB(ctx context.Context, f FDBPollFunc) error {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if t.fd < 0 {
+		return errClosed
+	}
+
+	// entries are buffered so an interrupted dump reports nothing
+	var entries []FDBEntry
+	err := t.consistentDump(unix.AF_BRIDGE, func() {
+		entries = entries[:0]
+	}, func(neigh *netlink.Neighbor) {
+		if neigh.Family == unix.AF_BRIDGE {
+			entries = append(entries, newFDBEntry(neigh))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		f(ctx, entry)
+	}
+
+	return nil
+}
+
+// ReceiveFDB is Receive for the forwarding databases of the bridges.
+func (s *Subscription) ReceiveFDB(ctx context.Context, f FDBUpdateFunc) error {
+	return s.receive(func(msgType uint16, neigh *netlink.Neighbor) {
+		if neigh.Family != unix.AF_BRIDGE {
+			return
+		}
+		f(ctx, FDBUpdate{
+			FDBEntry: newFDBEntry(neigh),
+			Deleted:  msgType == netlink.TypeDelNeigh,
+		})
+	})
+}
+
+// newFDBEntry copies neigh out of the buffer it was decoded from.
+func newFDBEntry(neigh *netlink.Neighbor) FDBEntry {
+	return FDBEntry{
+		HardwareAddr: append([]byte(nil), neigh.LLAddr...),
+		PortIndex:    int(neigh.IfIndex),
+		BridgeIndex:  int(neigh.Master),
+		VLAN:         int(neigh.VLAN),
+		State:        State(neigh.State),
+	}
+}
+
+type fdbWatchState struct {
+	subscription *Subscription
+}
+
+// watch applies changes to the databases as the kernel reports them and only
+// polls them when notifications were lost.
+func (w *FDBWatcher) watch(d time.Duration) error {
+	subscription, err := w.table.Subscribe()
+	if err != nil {
+		return err
+	}
+	w.subscription = subscription
+
+	// subscribe first so nothing slips in between the dump and the updates
+	if err := w.ForcePoll(); err != nil {
+		subscription.Close()
+		return err
+	}
+
+	go func() {
+		for {
+			err := subscription.ReceiveFDB(context.Background(), w.apply)
+
+			select {
+			case <-w.done:
+				return
+			default:
+			}
+
+			if err == ErrOverrun {
+				w.ForcePoll()
+			} else if err != nil {
+				// the subscription is broken, fall back to polling
+				w.poll(d)
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (w *FDBWatcher) stopWatching() {
+	w.subscription.Close()
+}
+
+func (w *FDBWatcher) apply(_ context.Context, update FDBUpdate) {
+	if update.BridgeIndex == 0 || update.Local() {
+		return
+	}
+
+	w.update.Lock()
+	defer w.update.Unlock()
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	// a bridge has one entry per address and VLAN, moving it to another port
+	// is a single update for the new port
+	key := update.HardwareAddr.String()
+	entries := w.entriesByAddr[key][:0:0]
+	for _, entry := range w.entriesByAddr[key] {
+		if entry.BridgeIndex != update.BridgeIndex || entry.VLAN != update.VLAN {
+			entries = append(entries, entry)
+		}
+	}
+	if !update.Deleted {
+		entries = append(entries, update.FDBEntry)
+		w.bridges[update.BridgeIndex] = struct{}{}
+		w.pin(&update.FDBEntry)
+	}
+
+	if len(entries) == 0 {
+		delete(w.entriesByAddr, key)
+	} else {
+		w.entriesByAddr[key] = entries
+	}
+}
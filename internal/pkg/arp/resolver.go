@@ -0,0 +1,123 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package arp
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/amari/cloud-metadata-server/internal/pkg/netns"
+	"golang.org/x/sys/unix"
+)
+
+// How often a Resolver polls the table while it waits, for systems that
+// don't report changes as they happen.
+const resolverPollInterval = 50 * time.Millisecond
+
+// The port probes are sent to. Nothing listens on it, the datagram only exists
+// to make the kernel resolve the neighbor.
+const probePort = 9 // discard
+
+// A Resolver actively resolves neighbors the watcher doesn't know about yet,
+// e.g. a guest whose first packet beat its ARP entry.
+type Resolver struct {
+	watcher *Watcher
+	timeout time.Duration
+}
+
+func NewResolver(w *Watcher, timeout time.Duration) *Resolver {
+	return &Resolver{
+		watcher: w,
+		timeout: timeout,
+	}
+}
+
+// Resolve makes the kernel send an ARP request (IPv4) or neighbor
+// solicitation (IPv6) for ip, out of ifIndex if the watcher restricts lookups
+// to it, then waits up to the resolver's timeout for the neighbor to show up.
+func (r *Resolver) Resolve(ctx context.Context, ip net.IP, ifIndex int) (Neighbor, bool) {
+	if neighbor, ok := r.watcher.Lookup(ip, ifIndex); ok {
+		return neighbor, true
+	}
+
+	r.watcher.lock.RLock()
+	scope, ok := r.watcher.scope(ip, ifIndex)
+	r.watcher.lock.RUnlock()
+	if !ok {
+		return Neighbor{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	err := netns.Do(r.watcher.Namespace(), func() error {
+		return probe(ip, scope)
+	})
+	if err != nil {
+		return Neighbor{}, false
+	}
+
+	ticker := time.NewTicker(resolverPollInterval)
+	defer ticker.Stop()
+
+	for {
+		changed := r.watcher.Changed()
+		if neighbor, ok := r.watcher.Lookup(ip, ifIndex); ok {
+			return neighbor, true
+		}
+
+		select {
+		case <-changed:
+		case <-ticker.C:
+			r.watcher.ForcePoll()
+		case <-ctx.Done():
+			return Neighbor{}, false
+		}
+	}
+}
+
+// probe sends an empty datagram to ip, which the kernel can only do once it
+// has resolved ip's link layer address.
+func probe(ip net.IP, ifIndex int) error {
+	var family int
+	var sa unix.Sockaddr
+	if ip4 := ip.To4(); ip4 != nil {
+		family = unix.AF_INET
+		sa4 := &unix.SockaddrInet4{Port: probePort}
+		copy(sa4.Addr[:], ip4)
+		sa = sa4
+	} else {
+		family = unix.AF_INET6
+		sa6 := &unix.SockaddrInet6{Port: probePort, ZoneId: uint32(ifIndex)}
+		copy(sa6.Addr[:], ip.To16())
+		sa = sa6
+	}
+
+	fd, err := unix.Socket(family, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	if ifIndex != 0 {
+		if err := bindToInterface(fd, family, ifIndex); err != nil {
+			return err
+		}
+	}
+
+	return unix.Sendto(fd, nil, 0, sa)
+}
@@ -16,7 +16,11 @@ limitations under the License.
 
 package arp
 
-import "context"
+import (
+	"context"
+	"errors"
+	"strings"
+)
 
 type PollFunc func(context.Context, Entry)
 
@@ -27,3 +31,35 @@ func (e *Entry) InterfaceName() string {
 	}
 	return ret.Name
 }
+
+// DefaultStates are the states of entries that can be trusted to map an
+// address to the neighbor that holds it.
+const DefaultStates = Reachable | Stale | Delay | Probe | Permanent
+
+var stateNames = map[string]State{
+	"incomplete": Incomplete,
+	"reachable":  Reachable,
+	"stale":      Stale,
+	"delay":      Delay,
+	"probe":      Probe,
+	"failed":     Failed,
+	"noarp":      NoARP,
+	"permanent":  Permanent,
+}
+
+var errBadState = errors.New("Bad neighbor state")
+
+// ParseStates parses a set of state names, e.g. "reachable" or "stale", as
+// `ip neigh` prints them.
+func ParseStates(names []string) (State, error) {
+	var ret State
+	for _, name := range names {
+		state, ok := stateNames[strings.ToLower(name)]
+		if !ok {
+			return 0, errBadState
+		}
+		ret |= state
+	}
+
+	return ret, nil
+}
@@ -29,19 +29,55 @@ import (
 
 	"net"
 
+	"github.com/amari/cloud-metadata-server/internal/pkg/netns"
 	"golang.org/x/sys/unix"
 )
 
 type Entry struct {
-	Header          *RtMsghdrExt
+	Header *RtMsghdrExt
+	// One of RawIPAddr (ARP) or RawIP6Addr (NDP) is set.
 	RawIPAddr       *RawSockaddrInet4Arp
+	RawIP6Addr      *RawSockaddrInet6
 	RawDataLinkAddr *RawSockaddrDatalink
 }
 
 func (e *Entry) RemoteIP() net.IP {
+	if e.RawIP6Addr != nil {
+		return e.RawIP6Addr.RemoteIP()
+	}
 	return e.RawIPAddr.RemoteIP()
 }
 
+func (e *Entry) ifIndex() int {
+	return int(e.RawDataLinkAddr.Index)
+}
+
+// state approximates the Linux neighbor state from the route, which only
+// tells resolved and static entries apart.
+func (e *Entry) state() State {
+	if e.RawDataLinkAddr.Alen == 0 {
+		return Incomplete
+	}
+	if e.Header.Flags&syscall.RTF_STATIC != 0 {
+		return Permanent
+	}
+	return Reachable
+}
+
+// State mirrors the Linux neighbor states so filters work on both.
+type State int
+
+const (
+	Incomplete State = 0x01
+	Reachable  State = 0x02
+	Stale      State = 0x04
+	Delay      State = 0x08
+	Probe      State = 0x10
+	Failed     State = 0x20
+	NoARP      State = 0x40
+	Permanent  State = 0x80
+)
+
 func (e *Entry) HardwareAddr() net.HardwareAddr {
 	return e.RawDataLinkAddr.HardwareAddr()
 }
@@ -53,7 +89,13 @@ func (e *Entry) Interface() (*net.Interface, error) {
 // An Table is the system defined ARP table cache.
 type Table struct{}
 
-func NewTable() (*Table, error) {
+// NewTable opens the table of the system. There are no network namespaces
+// here, namespace must be empty.
+func NewTable(namespace string) (*Table, error) {
+	if namespace != "" {
+		return nil, netns.ErrUnsupported
+	}
+
 	return &Table{}, nil
 }
 
@@ -61,8 +103,16 @@ func (a *Table) Close() (err error) {
 	return nil
 }
 
-// Poll polls the system arp table
+// Poll polls the system arp and ndp tables
 func (a *Table) Poll(ctx context.Context, f PollFunc) (err error) {
+	if err := a.poll(ctx, mibInet4, f); err != nil {
+		return err
+	}
+
+	return a.poll(ctx, mibInet6, f)
+}
+
+func (a *Table) poll(ctx context.Context, mib []C.int, f PollFunc) (err error) {
 	// read the raw routing table via sysctl
 	var needed uintptr
 	if err := sysctl(mib, 6, nil, &needed, nil, 0); err != nil {
@@ -98,14 +148,22 @@ L:
 	for i < len(rawRoutingTableBuf) {
 		// cast &rawRoutingTable[i]	to *RtMsghdrExt
 		msgHdr := (*RtMsghdrExt)(unsafe.Pointer(&rawRoutingTableBuf[i]))
+		dst := unsafe.Pointer(uintptr(unsafe.Pointer(msgHdr)) + unsafe.Sizeof(RtMsghdrExt{}))
+
+		// sockaddr_inarp or sockaddr_in6, followed by a sockaddr_dl
+		entry := Entry{Header: msgHdr}
+		var dstLen uint8
+		switch mib[3] {
+		case syscall.AF_INET6:
+			entry.RawIP6Addr = (*RawSockaddrInet6)(dst)
+			dstLen = entry.RawIP6Addr.Len
+		default:
+			entry.RawIPAddr = (*RawSockaddrInet4Arp)(dst)
+			dstLen = entry.RawIPAddr.Len
+		}
+		entry.RawDataLinkAddr = (*RawSockaddrDatalink)((*unix.RawSockaddrDatalink)(unsafe.Pointer(uintptr(dst) + sockaddrSpace(dstLen))))
 
-		// sockaddr_inarp
-		inArpAddr := (*RawSockaddrInet4Arp)(unsafe.Pointer(uintptr(unsafe.Pointer(msgHdr)) + unsafe.Sizeof(RtMsghdrExt{})))
-
-		// sockaddr_dl
-		dlAddr := (*RawSockaddrDatalink)((*unix.RawSockaddrDatalink)(unsafe.Pointer(uintptr(unsafe.Pointer(inArpAddr)) + uintptr(inArpAddr.Len))))
-
-		f(ctx, Entry{msgHdr, inArpAddr, dlAddr})
+		f(ctx, entry)
 
 		i += int(msgHdr.MsgLen)
 	}
@@ -113,8 +171,20 @@ L:
 	return nil
 }
 
-// The mib for the system routing table.
-var mib = []C.int{syscall.CTL_NET, syscall.AF_ROUTE, 0, syscall.AF_INET, 9 /* syscall.NET_RT_DUMPX_FLAGS */, syscall.RTF_LLINFO}
+// The mibs for the system routing table's link layer entries.
+var (
+	mibInet4 = []C.int{syscall.CTL_NET, syscall.AF_ROUTE, 0, syscall.AF_INET, 9 /* syscall.NET_RT_DUMPX_FLAGS */, syscall.RTF_LLINFO}
+	mibInet6 = []C.int{syscall.CTL_NET, syscall.AF_ROUTE, 0, syscall.AF_INET6, 9 /* syscall.NET_RT_DUMPX_FLAGS */, syscall.RTF_LLINFO}
+)
+
+// sockaddrSpace is the space a sockaddr of length len takes up in a routing
+// message.
+func sockaddrSpace(len uint8) uintptr {
+	if len == 0 {
+		return 4
+	}
+	return (uintptr(len) + 3) &^ 3
+}
 
 func sysctl(mib []C.int, namelen uintptr, old *byte, oldlen *uintptr, new *byte, newlen uintptr) (err error) {
 	_, _, ep := syscall.Syscall6(syscall.SYS___SYSCTL, uintptr(unsafe.Pointer(&mib[0])), namelen, uintptr(unsafe.Pointer(old)), uintptr(unsafe.Pointer(oldlen)), uintptr(unsafe.Pointer(new)), newlen)
@@ -250,3 +320,24 @@ func (s *RawSockaddrInet4Arp) LocalIP() net.IP {
 func (s *RawSockaddrInet4Arp) RemoteIP() net.IP {
 	return net.IPv4(s.Addr[0], s.Addr[1], s.Addr[2], s.Addr[3])
 }
+
+type RawSockaddrInet6 struct {
+	Len      uint8
+	Family   uint8
+	Port     uint16
+	Flowinfo uint32
+	Addr     [16]byte
+	ScopeID  uint32
+}
+
+func (s *RawSockaddrInet6) RemoteIP() net.IP {
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, s.Addr[:])
+	// the kernel embeds the scope of link-local addresses in the second
+	// 16-bit word.
+	if ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		ip[2], ip[3] = 0, 0
+	}
+
+	return ip
+}
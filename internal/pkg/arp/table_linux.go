@@ -19,8 +19,11 @@ import (
 	"context"
 	"errors"
 	"net"
-	"unsafe"
+	"os"
+	"sync"
 
+	"github.com/amari/cloud-metadata-server/internal/pkg/netlink"
+	"github.com/amari/cloud-metadata-server/internal/pkg/netns"
 	"golang.org/x/sys/unix"
 )
 
@@ -34,6 +37,12 @@ type Entry struct {
 
 	Flags Flags
 	State State
+	// CacheInfo is when the entry was last confirmed, used and updated, if
+	// the kernel reported it.
+	CacheInfo    netlink.CacheInfo
+	HasCacheInfo bool
+	// VLAN is the VLAN ID of bridge forwarding database entries, 0 if none.
+	VLAN int
 }
 
 func (e *Entry) RemoteIP() net.IP {
@@ -48,6 +57,14 @@ func (e *Entry) RemoteIP() net.IP {
 	return nil
 }
 
+func (e *Entry) ifIndex() int {
+	return e.InterfaceIndex
+}
+
+func (e *Entry) state() State {
+	return e.State
+}
+
 func (e *Entry) HardwareAddr() net.HardwareAddr {
 	return e.LinkLayerAddr
 }
@@ -74,234 +91,332 @@ const (
 	Permanent  State = unix.NUD_PERMANENT
 )
 
+// The size of the buffer netlink datagrams are read into.
+const nlReadBufferSize = 1 << 15
+
+// The receive buffer requested for subscriptions, so bursts of changes don't
+// overrun the socket.
+const nlSubscriptionRcvBuf = 1 << 20
+
 // An Table is the system defined ARP table cache.
 type Table struct {
+	m         sync.Mutex
+	fd        int
+	seq       uint32
+	req       []byte
+	buf       []byte
+	dec       netlink.Decoder
+	namespace string
 }
 
-func NewTable() (*Table, error) {
-	return &Table{}, nil
+// NewTable opens the table of the named network namespace, or of the process
+// if namespace is empty.
+func NewTable(namespace string) (*Table, error) {
+	fd, err := openNetlinkSocket(namespace, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Table{
+		fd:        fd,
+		buf:       make([]byte, nlReadBufferSize),
+		namespace: namespace,
+	}, nil
 }
 
 func (t *Table) Close() (err error) {
-	return nil
-}
+	t.m.Lock()
+	defer t.m.Unlock()
 
-type request struct {
-	Nl unix.NlMsghdr
-	Rt unix.NdMsg
+	if t.fd < 0 {
+		return nil
+	}
+	err = unix.Close(t.fd)
+	t.fd = -1
+
+	return err
 }
 
-var (
-	errBadNlMsg = errors.New("Bad NlMsg")
-	errNlMsgErr = errors.New("NlMsg error")
-)
+var errClosed = errors.New("Table closed")
+
+// How many times a dump is started over when the table changes during it.
+const maxDumpAttempts = 3
+
+// ErrOverrun is returned by `Subscription.Receive` when the kernel dropped
+// notifications because they weren't read fast enough. The caller must poll
+// the whole table to catch up.
+var ErrOverrun = errors.New("Neighbor notifications overrun")
 
 // Poll polls the system arp table
 func (t *Table) Poll(ctx context.Context, f PollFunc) (err error) {
-	//fmt.Println("polling")
+	t.m.Lock()
+	defer t.m.Unlock()
 
-	// RTM_GETNEIGH
-	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM, unix.NETLINK_ROUTE)
-	if err != nil {
-		return err
+	if t.fd < 0 {
+		return errClosed
 	}
-	defer unix.Close(fd)
-	err = unix.Bind(fd, &unix.SockaddrNetlink{
-		Family: uint16(unix.AF_INET),
+
+	// entries are buffered so an interrupted dump reports nothing
+	var entries []Entry
+	err = t.consistentDump(unix.AF_UNSPEC, func() {
+		entries = entries[:0]
+	}, func(neigh *netlink.Neighbor) {
+		if isIPFamily(int(neigh.Family)) {
+			entries = append(entries, newEntry(neigh))
+		}
 	})
 	if err != nil {
-		panic(err)
 		return err
 	}
 
-	// send the request
-	reqBytes := make([]byte, int(nlMsgLength(uintptr(unix.SizeofNlMsghdr+unix.SizeofNdMsg))))
-	req := (*request)(unsafe.Pointer(&reqBytes[0]))
-	req.Nl.Len = uint32(nlMsgLength(uintptr(unix.SizeofNlMsghdr + unix.SizeofNdMsg)))
-	req.Nl.Flags = unix.NLM_F_REQUEST | unix.NLM_F_DUMP
-	req.Nl.Type = unix.RTM_GETNEIGH
-	req.Rt.State = unix.NUD_REACHABLE
-	req.Rt.Family = unix.AF_INET
-	req.Nl.Pid = uint32(unix.Getpid())
-	req.Nl.Seq = 0
-	_, err = unix.Write(fd, reqBytes)
-	if err != nil {
-		return err
+	for _, entry := range entries {
+		f(ctx, entry)
 	}
-	//fmt.Printf("sent the request. %v bytes written\n", bytesWritten)
 
-	// read the response
-	buf := make([]byte, 0, 1<<13)
-	tmpBuf := make([]byte, 1<<9)
-	bufLen := 0
+	return nil
+}
 
-	for {
-		//fmt.Println("reading a chunk")
-		len, err := unix.Read(fd, tmpBuf)
-		//fmt.Println("read a chunk")
-		if err != nil {
-			return err
+// consistentDump dumps the entries of family, starting over when the table
+// changes during the dump. reset is called before every attempt, f with each
+// entry. The caller must hold the lock.
+func (t *Table) consistentDump(family uint8, reset func(), f func(*netlink.Neighbor)) error {
+	for attempt := 1; ; attempt++ {
+		reset()
+		err := t.dump(family, func(msgType uint16, neigh *netlink.Neighbor) {
+			if msgType == netlink.TypeNewNeigh {
+				f(neigh)
+			}
+		})
+		if errors.Is(err, netlink.ErrDumpInterrupted) && attempt < maxDumpAttempts {
+			continue
 		}
 
-		nlmsg := (*unix.NlMsghdr)(unsafe.Pointer(&tmpBuf[0]))
-		bufLen += len
-		buf = append(buf, tmpBuf[:len]...)
+		return err
+	}
+}
 
-		if !nlMsgOK(nlmsg, bufLen) {
-			return errBadNlMsg
-		}
+// dump requests every neighbor entry of family and calls f with each of them
+// until the end of the dump. The caller must hold the lock.
+func (t *Table) dump(family uint8, f func(uint16, *netlink.Neighbor)) error {
+	// replies to an earlier, abandoned dump are told apart by sequence number
+	t.seq++
 
-		if nlmsg.Type == unix.NLMSG_ERROR {
-			return errNlMsgErr
-		}
-		if nlmsg.Type == unix.NLMSG_DONE {
-			break
-		}
-		if nlmsg.Flags&unix.NLM_F_MULTI == 0 {
-			//fmt.Println("end of the message")
-			break
-		}
+	t.req = netlink.AppendNeighborRequest(t.req[:0], t.seq, family)
+	if _, err := unix.Write(t.fd, t.req); err != nil {
+		return err
 	}
 
-	// parse the response
-	nlmsg := (*unix.NlMsghdr)(unsafe.Pointer(&buf[0]))
+	// read the response to the end of the dump even once it failed, the
+	// kernel refuses another dump on the socket until this one is read out
+	var dumpErr error
+	walk := func(msgType uint16, neigh *netlink.Neighbor) {
+		if dumpErr == nil {
+			f(msgType, neigh)
+		}
+	}
 	for {
-		// parse message
-		ndmsg := (*unix.NdMsg)(nlMsgData(nlmsg))
-
-		if !nlMsgOK(nlmsg, bufLen) {
-			//log.Println("no more netlink messages")
-			break
+		n, err := unix.Read(t.fd, t.buf)
+		if err == unix.EINTR {
+			continue
 		}
-
-		//fmt.Printf("%+v\n", nlmsg)
-		//fmt.Printf("%+v\n", ndmsg)
-
-		if nlmsg.Type == unix.NLMSG_ERROR {
-			return errNlMsgErr
+		if err != nil {
+			return err
 		}
 
-		attr := rtmRTA(unsafe.Pointer(ndmsg))
-		len := rtmPayload(nlmsg)
-
-		var entry Entry
-		entry.Family = int(ndmsg.Family)
-		entry.InterfaceIndex = int(ndmsg.Ifindex)
-
-		for {
-			if !rtaOK(attr, len) {
-				//log.Println("no more attributes")
-				break
-			}
-			// parse attribute
-			switch attr.Type {
-			case unix.NDA_UNSPEC:
-			case unix.NDA_LLADDR:
-				// link layer address
-				// RTA_DATA(attr), RTA_PAYLOAD(attr)
-				off := int(uintptr(rtaData(attr)) - uintptr(unsafe.Pointer(&buf[0])))
-				addrLen := int(rtaPayload(attr))
-				entry.LinkLayerAddr = buf[off : off+addrLen]
-			case unix.NDA_DST:
-				// destination address
-				// RTA_DATA(attr), RTA_PAYLOAD(attr)
-				off := int(uintptr(rtaData(attr)) - uintptr(unsafe.Pointer(&buf[0])))
-				addrLen := int(rtaPayload(attr))
-				entry.DestinationAddr = buf[off : off+addrLen]
-			case unix.NDA_CACHEINFO:
-			default:
+		done, err := walkNeighMessages(&t.dec, t.buf[:n], t.seq, walk)
+		if t.dec.Err() != nil {
+			// the end of the dump can't be found past a malformed
+			// datagram, abandon the socket and the dump with it
+			if err := t.reopen(); err != nil {
+				return err
 			}
-			// move to the next attribute
-			attr, len = rtaNext(attr, len)
+			return t.dec.Err()
+		}
+		if dumpErr == nil {
+			dumpErr = err
 		}
-		if ndmsg.Family == unix.AF_INET {
-			f(ctx, entry)
+		if done {
+			return dumpErr
 		}
+	}
+}
 
-		nlmsg, bufLen = nlMsgNext(nlmsg, bufLen)
+// reopen replaces the socket, which cancels the dump the kernel is running on
+// it. The caller must hold the lock.
+func (t *Table) reopen() error {
+	fd, err := openNetlinkSocket(t.namespace, 0)
+	if err != nil {
+		return err
 	}
+	unix.Close(t.fd)
+	t.fd = fd
 
 	return nil
 }
 
-func nlMsgOK(nlh *unix.NlMsghdr, len int) bool {
-	return (uintptr(len) >= uintptr(unix.SizeofNlMsghdr)) && (uintptr(nlh.Len) >= uintptr(unix.SizeofNlMsghdr)) && (uintptr(nlh.Len) <= uintptr(len))
-}
-
-func nlMsgAlign(len uintptr) uintptr {
-	a := uintptr(unix.NLMSG_ALIGNTO) - 1
-	b := len + uintptr(unix.NLMSG_ALIGNTO) - 1
+// An Update is a change to the neighbor table.
+type Update struct {
+	Entry
 
-	return b & ^a
+	// Deleted is set when the entry was removed from the table.
+	Deleted bool
 }
 
-func nlMsgNext(nlh *unix.NlMsghdr, len int) (*unix.NlMsghdr, int) {
-	a := nlMsgAlign(uintptr(nlh.Len))
-	newLen := len - int(a)
-	newPtr := (*unix.NlMsghdr)(unsafe.Pointer(uintptr(unsafe.Pointer(nlh)) + nlMsgAlign(a)))
+type UpdateFunc func(context.Context, Update)
 
-	//fmt.Printf("nlMsgNext(%p, %v) -> (%p, %v)\n", nlh, len, newPtr, newLen)
-
-	return newPtr, newLen
+// A Subscription receives changes to the neighbor table as the kernel makes
+// them, over a socket that stays open until it is closed.
+type Subscription struct {
+	file *os.File
+	buf  []byte
+	dec  netlink.Decoder
 }
 
-func nlMsgLength(len uintptr) uintptr {
-	return len + uintptr(unix.NLMSG_HDRLEN)
-}
+// Subscribe joins the RTNLGRP_NEIGH multicast group.
+func (t *Table) Subscribe() (*Subscription, error) {
+	fd, err := openNetlinkSocket(t.namespace, 1<<(unix.RTNLGRP_NEIGH-1))
+	if err != nil {
+		return nil, err
+	}
+	// best effort, the default is enough on quiet hosts
+	unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF, nlSubscriptionRcvBuf)
+	// hand the socket to the runtime poller so Close unblocks Receive
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
 
-func nlMsgSpace(len uintptr) uintptr {
-	return nlMsgAlign(nlMsgLength(len))
+	return &Subscription{
+		file: os.NewFile(uintptr(fd), "netlink"),
+		buf:  make([]byte, nlReadBufferSize),
+	}, nil
 }
 
-func nlMsgData(nlh *unix.NlMsghdr) unsafe.Pointer {
-	return unsafe.Pointer(uintptr(unsafe.Pointer(nlh)) + nlMsgLength(0))
+// Receive blocks until the kernel reports changes, then calls f with each
+// change to an ARP or NDP entry. It returns `ErrOverrun` if notifications
+// were lost.
+func (s *Subscription) Receive(ctx context.Context, f UpdateFunc) error {
+	return s.receive(func(msgType uint16, neigh *netlink.Neighbor) {
+		if !isIPFamily(int(neigh.Family)) {
+			return
+		}
+		f(ctx, Update{
+			Entry:   newEntry(neigh),
+			Deleted: msgType == netlink.TypeDelNeigh,
+		})
+	})
 }
 
-func nlMsgPayload(nlh *unix.NlMsghdr, len uintptr) uintptr {
-	return uintptr(nlh.Len) - nlMsgSpace(len)
-}
+func (s *Subscription) receive(f func(uint16, *netlink.Neighbor)) error {
+	n, err := s.file.Read(s.buf)
+	if errors.Is(err, unix.ENOBUFS) {
+		return ErrOverrun
+	}
+	if err != nil {
+		return err
+	}
 
-func rtmRTA(r unsafe.Pointer) *unix.RtAttr {
-	return (*unix.RtAttr)(unsafe.Pointer(uintptr(r) + nlMsgAlign(unix.SizeofRtMsg)))
-}
+	_, err = walkNeighMessages(&s.dec, s.buf[:n], 0, f)
+	if errors.Is(err, netlink.ErrOverrun) {
+		return ErrOverrun
+	}
 
-func rtmPayload(nlh *unix.NlMsghdr) uintptr {
-	return nlMsgPayload(nlh, uintptr(unix.SizeofRtMsg))
+	return err
 }
 
-func rtaOK(rta *unix.RtAttr, len uintptr) bool {
-	return (len >= uintptr(unix.SizeofRtAttr)) && (uintptr(rta.Len) >= uintptr(unix.SizeofRtAttr)) && (uintptr(rta.Len) <= len)
+func (s *Subscription) Close() error {
+	return s.file.Close()
 }
 
-func rtaAlign(len uintptr) uintptr {
-	a := uintptr(unix.RTA_ALIGNTO) - 1
-	b := len + uintptr(unix.RTA_ALIGNTO) - 1
-
-	return b & ^a
+// isIPFamily reports whether family holds ARP (AF_INET) or NDP (AF_INET6)
+// entries.
+func isIPFamily(family int) bool {
+	return family == unix.AF_INET || family == unix.AF_INET6
 }
 
-func rtaNext(rta *unix.RtAttr, len uintptr) (*unix.RtAttr, uintptr) {
-	a := rtaAlign(uintptr(rta.Len))
-	newLen := len - a
-	newPtr := (*unix.RtAttr)(unsafe.Pointer(uintptr(unsafe.Pointer(rta)) + rtaAlign(a)))
-
-	//fmt.Printf("rtaNext(%p, %v) -> (%p, %v)\n", rta, int(len), newPtr, int(newLen))
+// openNetlinkSocket opens a route socket in namespace. The socket stays there
+// whichever namespace it's used from.
+func openNetlinkSocket(namespace string, groups uint32) (int, error) {
+	var fd int
+	err := netns.Do(namespace, func() (err error) {
+		fd, err = unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+		return err
+	})
+	if err != nil {
+		return -1, err
+	}
+	err = unix.Bind(fd, &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: groups,
+	})
+	if err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
 
-	return newPtr, newLen
+	return fd, nil
 }
 
-func rtaLength(len uintptr) uintptr {
-	return rtaAlign(uintptr(unix.SizeofRtAttr)) + len
-}
+// walkNeighMessages calls f with every neighbor message in the datagram buf.
+// Unless seq is 0, messages with another sequence number are skipped. It
+// reports whether the end of a dump has been reached. A dump that was
+// interrupted or can't be decoded is still walked to its end, without calling
+// f, and the first error is returned with it. f must not keep the neighbor,
+// it aliases buf.
+func walkNeighMessages(dec *netlink.Decoder, buf []byte, seq uint32, f func(uint16, *netlink.Neighbor)) (done bool, err error) {
+	var neigh netlink.Neighbor
+
+	dec.Reset(buf)
+	for dec.Next() {
+		msg := dec.Message()
+		if seq != 0 && msg.Header.Seq != seq {
+			continue
+		}
+		if msg.Header.Flags&netlink.FlagDumpIntr != 0 && err == nil {
+			err = netlink.ErrDumpInterrupted
+		}
 
-func rtaSpace(len uintptr) uintptr {
-	return rtaAlign(rtaLength(len))
-}
+		switch msg.Header.Type {
+		case netlink.TypeError:
+			// an acknowledgement ends the reply too
+			if err == nil {
+				err = netlink.DecodeError(msg.Data)
+			}
+			return true, err
+		case netlink.TypeDone:
+			return true, err
+		case netlink.TypeOverrun:
+			return false, netlink.ErrOverrun
+		case netlink.TypeNewNeigh, netlink.TypeDelNeigh:
+			if err != nil {
+				break
+			}
+			if err = netlink.DecodeNeighbor(msg.Data, &neigh); err == nil {
+				f(msg.Header.Type, &neigh)
+			}
+		}
+		if seq != 0 && msg.Header.Flags&netlink.FlagMulti == 0 {
+			done = true
+		}
+	}
+	if err == nil {
+		err = dec.Err()
+	}
 
-func rtaData(rta *unix.RtAttr) unsafe.Pointer {
-	return unsafe.Pointer(uintptr(unsafe.Pointer(rta)) + rtaLength(0))
+	return done, err
 }
 
-func rtaPayload(rta *unix.RtAttr) uintptr {
-	return uintptr(rta.Len) - rtaLength(0)
+// newEntry copies neigh out of the buffer it was decoded from, which is
+// reused for the next read.
+func newEntry(neigh *netlink.Neighbor) Entry {
+	return Entry{
+		InterfaceIndex:  int(neigh.IfIndex),
+		Family:          int(neigh.Family),
+		DestinationAddr: append([]byte(nil), neigh.Dst...),
+		LinkLayerAddr:   append([]byte(nil), neigh.LLAddr...),
+		State:           State(neigh.State),
+		CacheInfo:       neigh.CacheInfo,
+		HasCacheInfo:    neigh.HasCacheInfo,
+		VLAN:            int(neigh.VLAN),
+	}
 }
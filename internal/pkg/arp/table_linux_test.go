@@ -0,0 +1,174 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package arp
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/amari/cloud-metadata-server/internal/pkg/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// fakeKernel answers neighbor dumps on one end of a socket pair the way the
+// kernel does: every message in its own datagram, each written only once the
+// previous one was read, the first one of the first dump flagged
+// NLM_F_DUMP_INTR, and EBUSY for a request that arrives while a dump is still
+// running.
+type fakeKernel struct {
+	fd       int
+	dump     []netlink.Message
+	requests int
+}
+
+func (k *fakeKernel) serve(t *testing.T) {
+	buf := make([]byte, nlReadBufferSize)
+	var seq uint32
+	var pending []netlink.Message
+	for {
+		if len(pending) > 0 {
+			// bytes written to the peer that it hasn't read yet
+			unread, err := unix.IoctlGetInt(k.fd, unix.SIOCOUTQ)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if unread == 0 {
+				msg := pending[0]
+				flags := msg.Header.Flags
+				if k.requests == 1 && len(pending) == len(k.dump) {
+					flags |= netlink.FlagDumpIntr
+				}
+				k.write(t, msg.Header.Type, flags, seq, msg.Data)
+				pending = pending[1:]
+			}
+		}
+
+		fds := []unix.PollFd{{Fd: int32(k.fd), Events: unix.POLLIN}}
+		if n, err := unix.Poll(fds, 1); err != nil && err != unix.EINTR {
+			t.Error(err)
+			return
+		} else if n == 0 {
+			continue
+		}
+		n, err := unix.Read(k.fd, buf)
+		if err != nil || n == 0 {
+			return
+		}
+		dec := netlink.NewDecoder(buf[:n])
+		if !dec.Next() {
+			t.Errorf("bad request: %v", dec.Err())
+			return
+		}
+		k.requests++
+		if len(pending) > 0 {
+			k.write(t, netlink.TypeError, 0, dec.Message().Header.Seq, busyError(dec.Message().Header.Seq))
+			continue
+		}
+		seq = dec.Message().Header.Seq
+		pending = k.dump
+	}
+}
+
+func (k *fakeKernel) write(t *testing.T, msgType, flags uint16, seq uint32, data []byte) {
+	b := netlink.AppendHeader(nil, netlink.Header{
+		Len:   uint32(netlink.HeaderLen + len(data)),
+		Type:  msgType,
+		Flags: flags,
+		Seq:   seq,
+	})
+	if _, err := unix.Write(k.fd, append(b, data...)); err != nil {
+		t.Error(err)
+	}
+}
+
+// busyError is the payload of the NLMSG_ERROR the kernel answers a dump
+// request with while another dump is running.
+func busyError(seq uint32) []byte {
+	errno := -int32(unix.EBUSY)
+	b := binary.LittleEndian.AppendUint32(nil, uint32(errno))
+	return netlink.AppendHeader(b, netlink.Header{
+		Len:   netlink.HeaderLen,
+		Type:  unix.RTM_GETNEIGH,
+		Flags: netlink.FlagDump,
+		Seq:   seq,
+	})
+}
+
+func TestPollRetriesInterruptedDump(t *testing.T) {
+	if binary.LittleEndian.Uint16(netlink.AppendHeader(nil, netlink.Header{Len: 1})) != 1 {
+		t.Skip("the fixtures are little-endian")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join("..", "netlink", "testdata", "neigh_dump.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dump []netlink.Message
+	for dec := netlink.NewDecoder(data); dec.Next(); {
+		dump = append(dump, dec.Message())
+	}
+	if len(dump) < 3 {
+		t.Fatalf("the fixture has %d messages, want a multipart dump", len(dump))
+	}
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &fakeKernel{fd: fds[1], dump: dump}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		k.serve(t)
+	}()
+	table := &Table{
+		fd:  fds[0],
+		buf: make([]byte, nlReadBufferSize),
+	}
+
+	var entries []Entry
+	err = table.Poll(context.Background(), func(ctx context.Context, entry Entry) {
+		entries = append(entries, entry)
+	})
+	table.Close()
+	<-stopped
+	unix.Close(fds[1])
+	if err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+
+	if k.requests != 2 {
+		t.Errorf("%d dumps requested, want 2", k.requests)
+	}
+	found := 0
+	for _, entry := range entries {
+		if entry.RemoteIP().Equal(net.ParseIP("10.99.0.2")) {
+			found++
+			if got := entry.HardwareAddr().String(); got != "52:54:00:aa:bb:01" {
+				t.Errorf("10.99.0.2 has lladdr %s", got)
+			}
+		}
+	}
+	if found != 1 {
+		t.Errorf("10.99.0.2 reported %d times, want once", found)
+	}
+}
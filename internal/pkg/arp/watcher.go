@@ -18,95 +18,340 @@ package arp
 import (
 	"context"
 	"net"
+	"strconv"
 	"sync"
 	"time"
+
+	"github.com/amari/cloud-metadata-server/internal/pkg/netns"
 )
 
+// A Neighbor is a host on a directly attached link.
+type Neighbor struct {
+	HardwareAddr net.HardwareAddr
+	// InterfaceIndex is the interface the neighbor was learned on.
+	InterfaceIndex int
+	State          State
+}
+
+// A Filter selects the neighbor entries a Watcher maps.
+type Filter struct {
+	// Interfaces, by name or index, that neighbors must have been learned
+	// on. Empty allows every interface.
+	Interfaces []string
+	// States is the set of acceptable states. Zero means DefaultStates.
+	States State
+	// Namespace is the named network namespace whose table is watched,
+	// empty for the namespace of the process. Interfaces are looked up there.
+	Namespace string
+}
+
 type Watcher struct {
-	hardwareAddrsByIP4 map[string]net.HardwareAddr
+	// an address can be a neighbor on several interfaces at once
+	neighborsByIP map[string][]Neighbor
 
 	table  *Table
-	lock   *sync.RWMutex
-	ticker *time.Ticker
+	filter Filter
+	// ifIndexes is the allowed set of interfaces, nil allows any. Names are
+	// resolved again on every full poll.
+	ifIndexes map[int]struct{}
+	lock      *sync.RWMutex
+	changed   chan struct{}
+	// update serializes full polls with incremental updates so a change is
+	// never overwritten by an older dump.
+	update *sync.Mutex
 	done   chan struct{}
+
+	watchState
 }
 
-func NewWatcher(d time.Duration) (*Watcher, error) {
-	//timer := time.NewTimer(period)
-	table, err := NewTable()
+// NewWatcher keeps a copy of the neighbor table entries that pass filter up to
+// date. Where the system reports changes as they happen d is only used if that
+// fails, otherwise the table is polled every d.
+func NewWatcher(d time.Duration, filter Filter) (*Watcher, error) {
+	table, err := NewTable(filter.Namespace)
 	if err != nil {
 		return nil, err
 	}
 
-	hardwareAddrsByIP4 := map[string]net.HardwareAddr{}
-
-	table.Poll(context.Background(), func(_ context.Context, entry Entry) {
-		hardwareAddrsByIP4[entry.RemoteIP().String()] = entry.HardwareAddr()
-	})
+	if filter.States == 0 {
+		filter.States = DefaultStates
+	}
 
 	watcher := &Watcher{
-		hardwareAddrsByIP4: hardwareAddrsByIP4,
-		table:              table,
-		lock:               &sync.RWMutex{},
-		ticker:             time.NewTicker(d),
-		done:               make(chan struct{}, 1),
-	}
-
-	go func(t *Table, w *Watcher) {
-		for {
-			select {
-			case <-watcher.ticker.C:
-				watcher.ForcePoll()
-			case <-watcher.done:
-				return
-			}
-		}
-	}(table, watcher)
+		neighborsByIP: map[string][]Neighbor{},
+		table:         table,
+		filter:        filter,
+		lock:          &sync.RWMutex{},
+		changed:       make(chan struct{}),
+		update:        &sync.Mutex{},
+		done:          make(chan struct{}, 1),
+	}
+
+	if err := watcher.watch(d); err != nil {
+		table.Close()
+		return nil, err
+	}
 
 	return watcher, nil
 }
 
 func (w *Watcher) Close() error {
-	w.ticker.Stop()
 	close(w.done)
+	w.stopWatching()
 
-	return nil
+	return w.table.Close()
+}
+
+// poll polls the table every d until the watcher is closed.
+func (w *Watcher) poll(d time.Duration) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.ForcePoll()
+		case <-w.done:
+			return
+		}
+	}
 }
 
 // used when there's a cache miss and we want to be sure
 func (w *Watcher) ForcePoll() error {
-	hardwareAddrsByIP4 := map[string]net.HardwareAddr{}
+	w.update.Lock()
+	defer w.update.Unlock()
+
+	// pick up interfaces that were created or renamed
+	var ifIndexes map[int]struct{}
+	err := netns.Do(w.filter.Namespace, func() error {
+		ifIndexes = resolveInterfaces(w.filter.Interfaces)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	neighborsByIP := map[string][]Neighbor{}
 
-	err := w.table.Poll(context.Background(), func(_ context.Context, entry Entry) {
-		hardwareAddrsByIP4[entry.RemoteIP().String()] = entry.HardwareAddr()
+	err = w.table.Poll(context.Background(), func(_ context.Context, entry Entry) {
+		if !w.allows(ifIndexes, &entry) {
+			return
+		}
+		key := entry.RemoteIP().String()
+		neighborsByIP[key] = append(neighborsByIP[key], newNeighbor(&entry))
 	})
 	if err != nil {
 		return err
 	}
 
 	w.lock.Lock()
-	w.hardwareAddrsByIP4 = hardwareAddrsByIP4
+	w.neighborsByIP = neighborsByIP
+	w.ifIndexes = ifIndexes
+	w.notify()
 	w.lock.Unlock()
 
 	return nil
 }
 
+// allows reports whether entry passes the filter.
+func (w *Watcher) allows(ifIndexes map[int]struct{}, entry *Entry) bool {
+	if len(entry.HardwareAddr()) == 0 || entry.state()&w.filter.States == 0 {
+		return false
+	}
+	if ifIndexes != nil {
+		if _, ok := ifIndexes[entry.ifIndex()]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (w *Watcher) HardwareAddrsByIP() map[string]net.HardwareAddr {
 	w.lock.RLock()
 	defer w.lock.RUnlock()
 
-	return w.hardwareAddrsByIP4
+	ret := make(map[string]net.HardwareAddr, len(w.neighborsByIP))
+	for ip, neighbors := range w.neighborsByIP {
+		ret[ip] = neighbors[0].HardwareAddr
+	}
+
+	return ret
+}
+
+// Lookup finds the IPv4 or IPv6 neighbor ip. If ifIndex names one of the
+// interfaces the filter allows, only neighbors learned on it are considered;
+// if it names another one, there is no neighbor. If it's 0 any allowed
+// interface will do. IPv6 link-local addresses are only unique on their link,
+// so they always need ifIndex.
+func (w *Watcher) Lookup(ip net.IP, ifIndex int) (Neighbor, bool) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	neighbors := w.neighborsByIP[ip.String()]
+
+	ifIndex, ok := w.scope(ip, ifIndex)
+	if !ok {
+		return Neighbor{}, false
+	}
+	if ifIndex == 0 {
+		if len(neighbors) == 0 {
+			return Neighbor{}, false
+		}
+		return neighbors[0], true
+	}
+
+	for _, neighbor := range neighbors {
+		if neighbor.InterfaceIndex == ifIndex {
+			return neighbor, true
+		}
+	}
+
+	return Neighbor{}, false
 }
 
-func (w *Watcher) GetHardwareAddrForIP4(ip net.IP) net.HardwareAddr {
-	key := ip.String()
+// scope returns the interface lookups of ip arriving on ifIndex are restricted
+// to, or 0 if any allowed interface will do. It reports false if ifIndex isn't
+// allowed: widening the scope would resolve against the neighbors of other
+// links. The caller must hold the lock.
+func (w *Watcher) scope(ip net.IP, ifIndex int) (int, bool) {
+	if w.ifIndexes != nil && ifIndex != 0 {
+		_, ok := w.ifIndexes[ifIndex]
+		return ifIndex, ok
+	}
+	if isScoped(ip) {
+		return ifIndex, true
+	}
+
+	return 0, true
+}
 
+// Changed returns a channel that is closed the next time a neighbor is added,
+// changed or removed.
+func (w *Watcher) Changed() <-chan struct{} {
 	w.lock.RLock()
 	defer w.lock.RUnlock()
 
-	if addr, ok := w.hardwareAddrsByIP4[key]; ok {
-		return addr
+	return w.changed
+}
+
+// notify wakes everyone waiting on Changed. The caller must hold the write
+// lock.
+func (w *Watcher) notify() {
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+// GetHardwareAddrForIP looks up the hardware address of an IPv4 or IPv6
+// neighbor. zone, the interface name or index, tells IPv6 link-local
+// addresses on different links apart.
+func (w *Watcher) GetHardwareAddrForIP(ip net.IP, zone string) net.HardwareAddr {
+	if neighbor, ok := w.Lookup(ip, ZoneToIfIndex(w.filter.Namespace, zone)); ok {
+		return neighbor.HardwareAddr
 	}
 
 	return nil
 }
+
+func newNeighbor(entry *Entry) Neighbor {
+	return Neighbor{
+		HardwareAddr:   entry.HardwareAddr(),
+		InterfaceIndex: entry.ifIndex(),
+		State:          entry.state(),
+	}
+}
+
+func isScoped(ip net.IP) bool {
+	return ip.To4() == nil && ip.IsLinkLocalUnicast()
+}
+
+// resolveInterfaces maps interface names and indexes to indexes. Interfaces
+// that don't exist (yet) are left out. It returns nil if names is empty.
+func resolveInterfaces(names []string) map[int]struct{} {
+	if len(names) == 0 {
+		return nil
+	}
+
+	ret := make(map[int]struct{}, len(names))
+	for _, name := range names {
+		if ifIndex := zoneToIfIndex(name); ifIndex != 0 {
+			ret[ifIndex] = struct{}{}
+		}
+	}
+
+	return ret
+}
+
+// ZoneToIfIndex maps an interface name or index, like the zone of an IPv6
+// address, to the index of an interface in the network namespace. It returns
+// 0 if there is no such interface.
+func ZoneToIfIndex(namespace string, zone string) int {
+	ret := 0
+	err := netns.Do(namespace, func() error {
+		ret = zoneToIfIndex(zone)
+		return nil
+	})
+	if err != nil {
+		return 0
+	}
+
+	return ret
+}
+
+// zoneToIfIndex is ZoneToIfIndex in the current network namespace.
+func zoneToIfIndex(zone string) int {
+	if zone == "" {
+		return 0
+	}
+	if ifIndex, err := strconv.Atoi(zone); err == nil {
+		return ifIndex
+	}
+	if ifi, err := net.InterfaceByName(zone); err == nil {
+		return ifi.Index
+	}
+
+	return 0
+}
+
+// Namespace is the network namespace the watcher's table belongs to.
+func (w *Watcher) Namespace() string {
+	return w.filter.Namespace
+}
+
+// LocalIfIndex returns the index of the interface in the network namespace
+// that has the local address ip, or 0 if there isn't exactly one.
+func LocalIfIndex(namespace string, ip net.IP) int {
+	var ifis []net.Interface
+	var addrsByIndex map[int][]net.Addr
+	err := netns.Do(namespace, func() (err error) {
+		ifis, err = net.Interfaces()
+		if err != nil {
+			return err
+		}
+		addrsByIndex = make(map[int][]net.Addr, len(ifis))
+		for _, ifi := range ifis {
+			if addrs, err := ifi.Addrs(); err == nil {
+				addrsByIndex[ifi.Index] = addrs
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0
+	}
+
+	ret := 0
+	for _, ifi := range ifis {
+		for _, addr := range addrsByIndex[ifi.Index] {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				if ret != 0 && ret != ifi.Index {
+					return 0
+				}
+				ret = ifi.Index
+			}
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,33 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package arp
+
+import "time"
+
+type watchState struct{}
+
+// watch polls the table every d.
+func (w *Watcher) watch(d time.Duration) error {
+	if err := w.ForcePoll(); err != nil {
+		return err
+	}
+
+	go w.poll(d)
+
+	return nil
+}
+
+func (w *Watcher) stopWatching() {}
@@ -0,0 +1,96 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package arp
+
+import (
+	"context"
+	"time"
+)
+
+type watchState struct {
+	subscription *Subscription
+}
+
+// watch applies changes to the table as the kernel reports them and only
+// polls the whole table when notifications were lost.
+func (w *Watcher) watch(d time.Duration) error {
+	subscription, err := w.table.Subscribe()
+	if err != nil {
+		return err
+	}
+	w.subscription = subscription
+
+	// subscribe first so nothing slips in between the dump and the updates
+	if err := w.ForcePoll(); err != nil {
+		subscription.Close()
+		return err
+	}
+
+	go func() {
+		for {
+			err := subscription.Receive(context.Background(), w.apply)
+
+			select {
+			case <-w.done:
+				return
+			default:
+			}
+
+			if err == ErrOverrun {
+				w.ForcePoll()
+			} else if err != nil {
+				// the subscription is broken, fall back to polling
+				w.poll(d)
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (w *Watcher) stopWatching() {
+	w.subscription.Close()
+}
+
+func (w *Watcher) apply(_ context.Context, update Update) {
+	w.update.Lock()
+	defer w.update.Unlock()
+
+	key := update.RemoteIP().String()
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	// drop the neighbor from the interface the update is about, then put it
+	// back if it's still acceptable
+	neighbors := w.neighborsByIP[key][:0:0]
+	for _, neighbor := range w.neighborsByIP[key] {
+		if neighbor.InterfaceIndex != update.ifIndex() {
+			neighbors = append(neighbors, neighbor)
+		}
+	}
+	if !update.Deleted && w.allows(w.ifIndexes, &update.Entry) {
+		neighbors = append(neighbors, newNeighbor(&update.Entry))
+	}
+
+	if len(neighbors) == 0 {
+		delete(w.neighborsByIP, key)
+	} else {
+		w.neighborsByIP[key] = neighbors
+	}
+	w.notify()
+}
@@ -0,0 +1,62 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package arp
+
+import (
+	"net"
+	"sync"
+	"testing"
+)
+
+func TestLookupScope(t *testing.T) {
+	const (
+		tenantA = 3 // allowed
+		tenantB = 4 // allowed
+		uplink  = 5 // not allowed
+	)
+	guestA, _ := net.ParseMAC("52:54:00:00:00:0a")
+	guestB, _ := net.ParseMAC("52:54:00:00:00:0b")
+
+	// the same address is a guest on each tenant's bridge
+	w := &Watcher{
+		neighborsByIP: map[string][]Neighbor{
+			"10.0.0.2": {
+				{HardwareAddr: guestA, InterfaceIndex: tenantA, State: Reachable},
+				{HardwareAddr: guestB, InterfaceIndex: tenantB, State: Reachable},
+			},
+		},
+		ifIndexes: map[int]struct{}{tenantA: {}, tenantB: {}},
+		lock:      &sync.RWMutex{},
+	}
+	ip := net.ParseIP("10.0.0.2")
+
+	for _, test := range []struct {
+		name    string
+		ifIndex int
+		want    net.HardwareAddr
+	}{
+		{"arrived on tenant A", tenantA, guestA},
+		{"arrived on tenant B", tenantB, guestB},
+		{"arrival unknown", 0, guestA},
+		{"arrived on a filtered out interface", uplink, nil},
+	} {
+		neighbor, ok := w.Lookup(ip, test.ifIndex)
+		if ok != (test.want != nil) || ok && neighbor.HardwareAddr.String() != test.want.String() {
+			t.Errorf("%s: got %v, %v; want %v", test.name, neighbor.HardwareAddr, ok, test.want)
+		}
+	}
+}
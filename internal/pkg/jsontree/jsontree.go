@@ -0,0 +1,115 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package jsontree navigates the generic values produced by decoding JSON
+// into an `interface{}`, for metadata APIs that let callers address any
+// node of a JSON document by path.
+package jsontree
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// FromValue converts v to its generic JSON representation. Numbers are kept
+// as `json.Number` so that large identifiers survive the round trip.
+func FromValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var ret interface{}
+	if err := decoder.Decode(&ret); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// Lookup resolves a slash separated path of object keys and array indices
+// relative to v. Empty path segments are ignored.
+func Lookup(v interface{}, path string) (interface{}, bool) {
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+
+		switch node := v.(type) {
+		case map[string]interface{}:
+			child, ok := node[name]
+			if !ok {
+				return nil, false
+			}
+			v = child
+		case []interface{}:
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+// Remove deletes the object member at path, if any.
+func Remove(v interface{}, path string) {
+	i := strings.LastIndex(path, "/")
+
+	parent, ok := Lookup(v, path[:i+1])
+	if !ok {
+		return
+	}
+
+	if m, ok := parent.(map[string]interface{}); ok {
+		delete(m, path[i+1:])
+	}
+}
+
+// IsLeaf reports whether v is neither an object nor an array.
+func IsLeaf(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	default:
+		return true
+	}
+}
+
+// Text renders a leaf as plain text. Strings are written unquoted, anything
+// else as JSON.
+func Text(v interface{}) string {
+	switch leaf := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return leaf
+	case json.Number:
+		return leaf.String()
+	default:
+		data, _ := json.Marshal(leaf)
+		return string(data)
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netlink
+
+import "time"
+
+// Neighbor attribute types, see <linux/neighbour.h>.
+const (
+	AttrDst       = 1
+	AttrLLAddr    = 2
+	AttrCacheInfo = 3
+	AttrProbes    = 4
+	AttrVLAN      = 5
+	AttrPort      = 6
+	AttrVNI       = 7
+	AttrIfIndex   = 8
+	AttrMaster    = 9
+)
+
+const (
+	// sizeof(struct ndmsg)
+	NeighLen = 12
+	// sizeof(struct rtattr)
+	attrHeaderLen = 4
+	// sizeof(struct nda_cacheinfo)
+	cacheInfoLen = 16
+)
+
+// The kernel reports times in USER_HZ clock ticks, 100 a second on every
+// architecture.
+const userHZ = 100
+
+// CacheInfo is the struct nda_cacheinfo of an entry. The times are how many
+// clock ticks ago the entry was confirmed, used and updated.
+type CacheInfo struct {
+	Confirmed uint32
+	Used      uint32
+	Updated   uint32
+	RefCount  uint32
+}
+
+// ConfirmedAgo is how long ago the neighbor was last confirmed reachable.
+func (c CacheInfo) ConfirmedAgo() time.Duration {
+	return ticksToDuration(c.Confirmed)
+}
+
+// UsedAgo is how long ago the entry was last used.
+func (c CacheInfo) UsedAgo() time.Duration {
+	return ticksToDuration(c.Used)
+}
+
+// UpdatedAgo is how long ago the entry last changed.
+func (c CacheInfo) UpdatedAgo() time.Duration {
+	return ticksToDuration(c.Updated)
+}
+
+func ticksToDuration(ticks uint32) time.Duration {
+	return time.Duration(ticks) * (time.Second / userHZ)
+}
+
+// A Neighbor is a struct ndmsg and the attributes that follow it. Dst and
+// LLAddr alias the buffer it was decoded from, copy them to keep them.
+type Neighbor struct {
+	Family  uint8
+	IfIndex int32
+	State   uint16
+	Flags   uint8
+	Type    uint8
+
+	Dst    []byte
+	LLAddr []byte
+
+	CacheInfo    CacheInfo
+	HasCacheInfo bool
+	// VLAN is the VLAN ID of bridge forwarding database entries.
+	VLAN    uint16
+	HasVLAN bool
+	// Master is the interface index of the bridge of a forwarding database
+	// entry, 0 if none.
+	Master int32
+}
+
+// DecodeNeighbor decodes the payload of an RTM_NEWNEIGH or RTM_DELNEIGH
+// message into n. Attributes it doesn't know are skipped.
+func DecodeNeighbor(data []byte, n *Neighbor) error {
+	if len(data) < NeighLen {
+		return ErrTruncated
+	}
+
+	*n = Neighbor{
+		Family:  data[0],
+		IfIndex: int32(byteOrder.Uint32(data[4:8])),
+		State:   byteOrder.Uint16(data[8:10]),
+		Flags:   data[10],
+		Type:    data[11],
+	}
+
+	attrs := data[NeighLen:]
+	for len(attrs) > 0 {
+		if len(attrs) < attrHeaderLen {
+			return ErrTruncated
+		}
+		attrLen := int(byteOrder.Uint16(attrs[0:2]))
+		attrType := byteOrder.Uint16(attrs[2:4])
+		if attrLen < attrHeaderLen {
+			return ErrMalformed
+		}
+		if attrLen > len(attrs) {
+			return ErrTruncated
+		}
+		payload := attrs[attrHeaderLen:attrLen]
+
+		// the top bits are the nested and byte order flags
+		switch attrType & 0x3fff {
+		case AttrDst:
+			n.Dst = payload
+		case AttrLLAddr:
+			n.LLAddr = payload
+		case AttrCacheInfo:
+			if len(payload) < cacheInfoLen {
+				return ErrMalformed
+			}
+			n.CacheInfo = CacheInfo{
+				Confirmed: byteOrder.Uint32(payload[0:4]),
+				Used:      byteOrder.Uint32(payload[4:8]),
+				Updated:   byteOrder.Uint32(payload[8:12]),
+				RefCount:  byteOrder.Uint32(payload[12:16]),
+			}
+			n.HasCacheInfo = true
+		case AttrVLAN:
+			if len(payload) < 2 {
+				return ErrMalformed
+			}
+			n.VLAN = byteOrder.Uint16(payload[0:2])
+			n.HasVLAN = true
+		case AttrMaster:
+			if len(payload) < 4 {
+				return ErrMalformed
+			}
+			n.Master = int32(byteOrder.Uint32(payload[0:4]))
+		}
+
+		next := align(attrLen)
+		if next > len(attrs) {
+			next = len(attrs)
+		}
+		attrs = attrs[next:]
+	}
+
+	return nil
+}
+
+// AppendNeighborRequest appends an RTM_GETNEIGH dump request for family to b.
+func AppendNeighborRequest(b []byte, seq uint32, family uint8) []byte {
+	b = AppendHeader(b, Header{
+		Len:   HeaderLen + NeighLen,
+		Type:  TypeGetNeigh,
+		Flags: FlagRequest | FlagDump,
+		Seq:   seq,
+	})
+	// struct ndmsg, everything but the family is a wildcard
+	b = append(b, family, 0, 0, 0)
+	b = append(b, 0, 0, 0, 0, 0, 0, 0, 0)
+
+	return b
+}
@@ -0,0 +1,208 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package netlink decodes the rtnetlink neighbor messages of Linux. It only
+// looks at the bytes it's given and never allocates, so it works on captured
+// messages without a kernel.
+package netlink
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// Netlink is in the byte order of the host.
+var byteOrder = binary.NativeEndian
+
+// Message types, see <linux/netlink.h> and <linux/rtnetlink.h>.
+const (
+	TypeNoop     = 0x1
+	TypeError    = 0x2
+	TypeDone     = 0x3
+	TypeOverrun  = 0x4
+	TypeNewNeigh = 0x1c
+	TypeDelNeigh = 0x1d
+	TypeGetNeigh = 0x1e
+)
+
+// Message flags.
+const (
+	FlagRequest  = 0x1
+	FlagMulti    = 0x2
+	FlagAck      = 0x4
+	FlagDumpIntr = 0x10
+	FlagDump     = 0x300
+)
+
+const (
+	// sizeof(struct nlmsghdr)
+	HeaderLen = 16
+	// sizeof(struct nlmsgerr) without the echoed request
+	errorLen = 4
+	alignTo  = 4
+)
+
+var (
+	// ErrTruncated means a length field points past the end of the buffer.
+	ErrTruncated = errors.New("Truncated netlink message")
+	// ErrMalformed means a length field is too small for what it describes.
+	ErrMalformed = errors.New("Malformed netlink message")
+	// ErrDumpInterrupted means the table changed during a dump, which is
+	// inconsistent and must be started over.
+	ErrDumpInterrupted = errors.New("Netlink dump interrupted")
+	// ErrOverrun means the kernel dropped messages.
+	ErrOverrun = errors.New("Netlink overrun")
+)
+
+// An Error is an NLMSG_ERROR reply to a request.
+type Error struct {
+	Errno syscall.Errno
+	// Seq is the sequence number of the request that failed.
+	Seq uint32
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("netlink request %d: %v", e.Seq, e.Errno)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Errno
+}
+
+// A Header is a struct nlmsghdr.
+type Header struct {
+	Len   uint32
+	Type  uint16
+	Flags uint16
+	Seq   uint32
+	Pid   uint32
+}
+
+// A Message is a header and the payload that follows it. Data aliases the
+// buffer the message was decoded from.
+type Message struct {
+	Header Header
+	Data   []byte
+}
+
+// A Decoder walks the messages of a datagram.
+type Decoder struct {
+	buf []byte
+	msg Message
+	err error
+}
+
+func NewDecoder(buf []byte) *Decoder {
+	return &Decoder{
+		buf: buf,
+	}
+}
+
+// Reset points the decoder at the next datagram, so it can be reused.
+func (d *Decoder) Reset(buf []byte) {
+	*d = Decoder{
+		buf: buf,
+	}
+}
+
+// Next decodes the next message, it returns false at the end of the datagram
+// or if the datagram is malformed, see Err.
+func (d *Decoder) Next() bool {
+	if d.err != nil || len(d.buf) == 0 {
+		return false
+	}
+	if len(d.buf) < HeaderLen {
+		d.err = ErrTruncated
+		return false
+	}
+
+	var h Header
+	h.Len = byteOrder.Uint32(d.buf[0:4])
+	h.Type = byteOrder.Uint16(d.buf[4:6])
+	h.Flags = byteOrder.Uint16(d.buf[6:8])
+	h.Seq = byteOrder.Uint32(d.buf[8:12])
+	h.Pid = byteOrder.Uint32(d.buf[12:16])
+	if h.Len < HeaderLen {
+		d.err = ErrMalformed
+		return false
+	}
+	if uint64(h.Len) > uint64(len(d.buf)) {
+		d.err = ErrTruncated
+		return false
+	}
+
+	d.msg = Message{
+		Header: h,
+		Data:   d.buf[HeaderLen:h.Len],
+	}
+	// the last message needn't be padded
+	next := align(int(h.Len))
+	if next > len(d.buf) {
+		next = len(d.buf)
+	}
+	d.buf = d.buf[next:]
+
+	return true
+}
+
+// Message is the message decoded by the last call to Next.
+func (d *Decoder) Message() Message {
+	return d.msg
+}
+
+// Err is the reason Next stopped early, nil at the end of the datagram.
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// DecodeError decodes the payload of an NLMSG_ERROR message. It returns nil
+// for acknowledgements, which are errors with errno 0.
+func DecodeError(data []byte) error {
+	if len(data) < errorLen {
+		return ErrTruncated
+	}
+	errno := -int32(byteOrder.Uint32(data[0:4]))
+	if errno == 0 {
+		return nil
+	}
+
+	e := &Error{
+		Errno: syscall.Errno(errno),
+	}
+	// the request is echoed back after the errno
+	if len(data) >= errorLen+HeaderLen {
+		e.Seq = byteOrder.Uint32(data[errorLen+8 : errorLen+12])
+	}
+
+	return e
+}
+
+// AppendHeader appends the encoding of h to b.
+func AppendHeader(b []byte, h Header) []byte {
+	b = byteOrder.AppendUint32(b, h.Len)
+	b = byteOrder.AppendUint16(b, h.Type)
+	b = byteOrder.AppendUint16(b, h.Flags)
+	b = byteOrder.AppendUint32(b, h.Seq)
+	b = byteOrder.AppendUint32(b, h.Pid)
+
+	return b
+}
+
+func align(n int) int {
+	return (n + alignTo - 1) &^ (alignTo - 1)
+}
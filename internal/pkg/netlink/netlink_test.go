@@ -0,0 +1,268 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package netlink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// The fixtures in testdata were captured from a little-endian kernel:
+//
+//	neigh_dump.bin      an RTM_GETNEIGH dump, NLM_F_MULTI parts then NLMSG_DONE
+//	fdb_dump.bin        the same for AF_BRIDGE, with NDA_MASTER
+//	newneigh.bin        an RTM_NEWNEIGH notification for 10.99.0.5
+//	delneigh.bin        the RTM_DELNEIGH for it
+//	error.bin           the NLMSG_ERROR (EINVAL) for a bad RTM_GETNEIGH
+//	truncated_attr.bin  newneigh.bin cut short inside NDA_LLADDR
+// The address families of the fixtures, as Linux numbers them; syscall has no
+// AF_BRIDGE elsewhere.
+const (
+	afInet   = 2
+	afBridge = 7
+)
+
+var fixtures = []string{
+	"neigh_dump.bin",
+	"fdb_dump.bin",
+	"newneigh.bin",
+	"delneigh.bin",
+	"error.bin",
+	"truncated_attr.bin",
+}
+
+func readFixture(tb testing.TB, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return data
+}
+
+func skipUnlessLittleEndian(tb testing.TB) {
+	if byteOrder.Uint16([]byte{1, 0}) != 1 {
+		tb.Skip("the fixtures are little-endian")
+	}
+}
+
+// decodeAll decodes every message of a datagram, and the neighbors among
+// them.
+func decodeAll(data []byte) ([]Message, []Neighbor, error) {
+	var messages []Message
+	var neighbors []Neighbor
+
+	d := NewDecoder(data)
+	for d.Next() {
+		m := d.Message()
+		messages = append(messages, m)
+		if m.Header.Type == TypeNewNeigh || m.Header.Type == TypeDelNeigh {
+			var n Neighbor
+			if err := DecodeNeighbor(m.Data, &n); err != nil {
+				return messages, neighbors, err
+			}
+			neighbors = append(neighbors, n)
+		}
+	}
+
+	return messages, neighbors, d.Err()
+}
+
+func TestDecodeDump(t *testing.T) {
+	skipUnlessLittleEndian(t)
+
+	messages, neighbors, err := decodeAll(readFixture(t, "neigh_dump.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := messages[len(messages)-1]
+	if last.Header.Type != TypeDone {
+		t.Errorf("dump ends with type %d, want NLMSG_DONE", last.Header.Type)
+	}
+	for _, m := range messages {
+		if m.Header.Flags&FlagMulti == 0 {
+			t.Errorf("message of type %d isn't NLM_F_MULTI", m.Header.Type)
+		}
+		if m.Header.Seq != 1 {
+			t.Errorf("message of type %d has seq %d, want 1", m.Header.Type, m.Header.Seq)
+		}
+	}
+
+	found := false
+	for _, n := range neighbors {
+		if net.IP(n.Dst).Equal(net.ParseIP("10.99.0.2")) {
+			found = true
+			if got := net.HardwareAddr(n.LLAddr).String(); got != "52:54:00:aa:bb:01" {
+				t.Errorf("10.99.0.2 has lladdr %s", got)
+			}
+			if n.Family != afInet || !n.HasCacheInfo {
+				t.Errorf("10.99.0.2 decoded as %+v", n)
+			}
+		}
+	}
+	if !found {
+		t.Error("10.99.0.2 not in the dump")
+	}
+}
+
+func TestDecodeFDBDump(t *testing.T) {
+	skipUnlessLittleEndian(t)
+
+	_, neighbors, err := decodeAll(readFixture(t, "fdb_dump.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range neighbors {
+		if net.HardwareAddr(n.LLAddr).String() != "52:54:00:aa:bb:03" {
+			continue
+		}
+		if n.Family != afBridge || n.Master == 0 || n.Master == n.IfIndex {
+			t.Errorf("52:54:00:aa:bb:03 decoded as %+v", n)
+		}
+		return
+	}
+	t.Error("52:54:00:aa:bb:03 not in the dump")
+}
+
+func TestDecodeNotifications(t *testing.T) {
+	skipUnlessLittleEndian(t)
+
+	for name, typ := range map[string]uint16{
+		"newneigh.bin": TypeNewNeigh,
+		"delneigh.bin": TypeDelNeigh,
+	} {
+		messages, neighbors, err := decodeAll(readFixture(t, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(messages) != 1 || messages[0].Header.Type != typ || len(neighbors) != 1 {
+			t.Fatalf("%s: decoded %d messages, %d neighbors", name, len(messages), len(neighbors))
+		}
+		n := neighbors[0]
+		if !net.IP(n.Dst).Equal(net.ParseIP("10.99.0.5")) {
+			t.Errorf("%s: dst %v", name, net.IP(n.Dst))
+		}
+		if typ == TypeNewNeigh && net.HardwareAddr(n.LLAddr).String() != "52:54:00:aa:bb:05" {
+			t.Errorf("%s: lladdr %v", name, net.HardwareAddr(n.LLAddr))
+		}
+	}
+}
+
+func TestDecodeErrorMessage(t *testing.T) {
+	skipUnlessLittleEndian(t)
+
+	messages, _, err := decodeAll(readFixture(t, "error.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Header.Type != TypeError {
+		t.Fatalf("decoded %+v", messages)
+	}
+
+	err = DecodeError(messages[0].Data)
+	var nlerr *Error
+	if !errors.As(err, &nlerr) || nlerr.Seq != 3 || !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("got %v, want EINVAL for request 3", err)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	skipUnlessLittleEndian(t)
+
+	// the message is whole but its attribute isn't
+	if _, _, err := decodeAll(readFixture(t, "truncated_attr.bin")); err != ErrTruncated {
+		t.Errorf("truncated attribute: got %v, want ErrTruncated", err)
+	}
+
+	// and a datagram cut short anywhere is caught by the decoder
+	data := readFixture(t, "newneigh.bin")
+	for i := 1; i < len(data); i++ {
+		d := NewDecoder(data[:i])
+		for d.Next() {
+		}
+		if d.Err() != ErrTruncated {
+			t.Errorf("cut to %d bytes: got %v, want ErrTruncated", i, d.Err())
+		}
+	}
+}
+
+// FuzzDecode checks the decoder never reads past a datagram, whatever it's
+// given.
+func FuzzDecode(f *testing.F) {
+	for _, name := range fixtures {
+		data := readFixture(f, name)
+		f.Add(data)
+		f.Add(data[:len(data)/2])
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		d := NewDecoder(data)
+		n := 0
+		for d.Next() {
+			m := d.Message()
+			if int(m.Header.Len) != HeaderLen+len(m.Data) {
+				t.Fatalf("header length %d, payload %d bytes", m.Header.Len, len(m.Data))
+			}
+			// every message takes at least a header, so this ends
+			if n += HeaderLen; n > len(data) {
+				t.Fatal("decoded more messages than fit")
+			}
+			switch m.Header.Type {
+			case TypeError:
+				DecodeError(m.Data)
+			case TypeNewNeigh, TypeDelNeigh:
+				var neigh Neighbor
+				DecodeNeighbor(m.Data, &neigh)
+			}
+		}
+	})
+}
+
+// FuzzDecodeNeighbor checks the attributes of a neighbor always alias its
+// payload.
+func FuzzDecodeNeighbor(f *testing.F) {
+	for _, name := range fixtures {
+		d := NewDecoder(readFixture(f, name))
+		for d.Next() {
+			if m := d.Message(); m.Header.Type == TypeNewNeigh || m.Header.Type == TypeDelNeigh {
+				f.Add(m.Data)
+			}
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var n Neighbor
+		if err := DecodeNeighbor(data, &n); err != nil {
+			return
+		}
+		for _, attr := range [][]byte{n.Dst, n.LLAddr} {
+			if len(attr) > 0 && !bytes.Contains(data, attr) {
+				t.Fatalf("attribute %x isn't in the payload", attr)
+			}
+		}
+		if binary.Size(n.CacheInfo) != cacheInfoLen {
+			t.Fatal("struct nda_cacheinfo changed size")
+		}
+	})
+}
@@ -0,0 +1,56 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package netns runs code inside named network namespaces, the ones
+// `ip netns` manages under /var/run/netns.
+package netns
+
+import (
+	"errors"
+	"net"
+)
+
+// Dir is where named network namespaces are bind mounted.
+const Dir = "/var/run/netns"
+
+var ErrUnsupported = errors.New("Network namespaces are not supported")
+
+// Do calls f in the network namespace name, so the sockets f opens belong to
+// it. f must not hand work off to other goroutines, they'd run in the
+// namespace of the process. An empty name is the namespace of the process.
+func Do(name string, f func() error) error {
+	if name == "" {
+		return f()
+	}
+
+	return do(name, f)
+}
+
+// A Listener is a listener opened in a named network namespace.
+type Listener struct {
+	net.Listener
+
+	// Namespace is empty for the namespace of the process.
+	Namespace string
+}
+
+// NewListener records that l was opened in the network namespace name.
+func NewListener(l net.Listener, name string) *Listener {
+	return &Listener{
+		Listener:  l,
+		Namespace: name,
+	}
+}
@@ -0,0 +1,331 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package proxyproto reads the PROXY protocol (v1 and v2) header load
+// balancers like HAProxy and Envoy prepend to connections, so the server sees
+// the original client instead of the proxy.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The longest v1 header, including the CRLF.
+const maxHeaderLenV1 = 107
+
+// The longest v2 address block accepted, TLVs included.
+const maxAddrLenV2 = 1 << 12
+
+var signatureV2 = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var (
+	errBadHeader = errors.New("Bad PROXY protocol header")
+	errClosed    = errors.New("Listener closed")
+)
+
+// A Listener accepts connections whose addresses are taken from the PROXY
+// protocol header. Only peers in the trusted set may send one, connections
+// from anyone else, or trusted peers that don't send a header, are passed
+// through untouched.
+type Listener struct {
+	net.Listener
+
+	trusted Trusted
+	timeout time.Duration
+
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewListener reads headers from connections accepted by l, giving each peer
+// up to timeout to send its header.
+func NewListener(l net.Listener, trusted Trusted, timeout time.Duration) *Listener {
+	pl := &Listener{
+		Listener: l,
+		trusted:  trusted,
+		timeout:  timeout,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error),
+		done:     make(chan struct{}),
+	}
+
+	go pl.acceptLoop()
+
+	return pl
+}
+
+// Accept implements `net.Listener`
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, errClosed
+	}
+}
+
+// Close implements `net.Listener`
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+
+	return l.Listener.Close()
+}
+
+func (l *Listener) acceptLoop() {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.done:
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+
+		// a slow peer must not hold up everyone else
+		go l.handshake(c)
+	}
+}
+
+func (l *Listener) handshake(c net.Conn) {
+	addr, ok := c.RemoteAddr().(*net.TCPAddr)
+	if !ok || !l.trusted.Contains(addr.IP) {
+		l.deliver(c)
+		return
+	}
+
+	c.SetReadDeadline(time.Now().Add(l.timeout))
+	r := bufio.NewReader(c)
+	remoteAddr, localAddr, err := readHeader(r)
+	c.SetReadDeadline(time.Time{})
+	if err != nil {
+		c.Close()
+		return
+	}
+
+	l.deliver(&Conn{
+		Conn:       c,
+		r:          r,
+		remoteAddr: remoteAddr,
+		localAddr:  localAddr,
+	})
+}
+
+func (l *Listener) deliver(c net.Conn) {
+	select {
+	case l.conns <- c:
+	case <-l.done:
+		c.Close()
+	}
+}
+
+// A Conn is a connection that arrived through a proxy.
+type Conn struct {
+	net.Conn
+
+	// r holds whatever was read past the header
+	r          *bufio.Reader
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// ProxyAddr is the address of the proxy itself.
+func (c *Conn) ProxyAddr() net.Addr {
+	return c.Conn.RemoteAddr()
+}
+
+// RemoteAddr is the client's address as reported by the proxy.
+func (c *Conn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr is the address the client connected to as reported by the proxy.
+func (c *Conn) LocalAddr() net.Addr {
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// readHeader reads a v1 or v2 header from r. It returns nil addresses if there
+// is no header, or the header doesn't carry addresses (UNKNOWN, LOCAL).
+func readHeader(r *bufio.Reader) (remoteAddr, localAddr net.Addr, err error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch b[0] {
+	case 'P':
+		if b, err := r.Peek(6); err != nil || string(b) != "PROXY " {
+			return nil, nil, nil
+		}
+		return readHeaderV1(r)
+	case signatureV2[0]:
+		if b, err := r.Peek(len(signatureV2)); err != nil || !bytes.Equal(b, signatureV2) {
+			return nil, nil, nil
+		}
+		return readHeaderV2(r)
+	default:
+		return nil, nil, nil
+	}
+}
+
+// readHeaderV1 reads "PROXY <TCP4|TCP6|UNKNOWN> <src> <dst> <sport> <dport>\r\n".
+func readHeaderV1(r *bufio.Reader) (remoteAddr, localAddr net.Addr, err error) {
+	var line []byte
+	for len(line) < maxHeaderLenV1 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, errBadHeader
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, errBadHeader
+	}
+
+	src, err := parseTCPAddrV1(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := parseTCPAddrV1(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return src, dst, nil
+}
+
+func parseTCPAddrV1(ipStr string, portStr string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return nil, errBadHeader
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, errBadHeader
+	}
+
+	return &net.TCPAddr{
+		IP:   ip,
+		Port: int(port),
+	}, nil
+}
+
+// readHeaderV2 reads the binary header: the signature, version and command,
+// address family and protocol, the length of what follows and the addresses.
+func readHeaderV2(r *bufio.Reader) (remoteAddr, localAddr net.Addr, err error) {
+	var hdr [16]byte
+	if _, err := readFull(r, hdr[:]); err != nil {
+		return nil, nil, err
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, nil, errBadHeader
+	}
+	command := hdr[12] & 0x0f
+	family := hdr[13] >> 4
+	length := int(binary.BigEndian.Uint16(hdr[14:16]))
+	if length > maxAddrLenV2 {
+		return nil, nil, errBadHeader
+	}
+
+	addrs := make([]byte, length)
+	if _, err := readFull(r, addrs); err != nil {
+		return nil, nil, err
+	}
+
+	switch command {
+	case 0x0: // LOCAL, e.g. the proxy's own health checks
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, errBadHeader
+	}
+
+	var ipLen int
+	switch family {
+	case 0x1: // AF_INET
+		ipLen = net.IPv4len
+	case 0x2: // AF_INET6
+		ipLen = net.IPv6len
+	default:
+		return nil, nil, nil
+	}
+	if length < 2*ipLen+4 {
+		return nil, nil, errBadHeader
+	}
+
+	src := &net.TCPAddr{
+		IP:   net.IP(append([]byte(nil), addrs[:ipLen]...)),
+		Port: int(binary.BigEndian.Uint16(addrs[2*ipLen:])),
+	}
+	dst := &net.TCPAddr{
+		IP:   net.IP(append([]byte(nil), addrs[ipLen:2*ipLen]...)),
+		Port: int(binary.BigEndian.Uint16(addrs[2*ipLen+2:])),
+	}
+
+	return src, dst, nil
+}
+
+func readFull(r *bufio.Reader, b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		m, err := r.Read(b[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
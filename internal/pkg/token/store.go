@@ -0,0 +1,90 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package token issues short lived session tokens for metadata APIs that
+// require a handshake before serving requests.
+package token
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+// A Store issues session tokens that are bound to the data-link address of
+// the caller they were minted for.
+type Store struct {
+	lock     *sync.Mutex
+	sessions map[string]session
+}
+
+type session struct {
+	dataLinkAddr string
+	expires      time.Time
+}
+
+func NewStore() *Store {
+	return &Store{
+		lock:     &sync.Mutex{},
+		sessions: map[string]session{},
+	}
+}
+
+// Issue mints a new token for dataLinkAddr that expires after ttl.
+func (s *Store) Issue(dataLinkAddr string, ttl time.Duration) (string, error) {
+	buf := make([]byte, 42)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// drop expired sessions while we hold the lock
+	for k, v := range s.sessions {
+		if now.After(v.expires) {
+			delete(s.sessions, k)
+		}
+	}
+
+	s.sessions[token] = session{
+		dataLinkAddr: dataLinkAddr,
+		expires:      now.Add(ttl),
+	}
+
+	return token, nil
+}
+
+// Validate reports whether token is unexpired and was issued to dataLinkAddr.
+func (s *Store) Validate(token string, dataLinkAddr string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	v, ok := s.sessions[token]
+	if !ok {
+		return false
+	}
+	if time.Now().After(v.expires) {
+		delete(s.sessions, token)
+		return false
+	}
+
+	return v.dataLinkAddr == dataLinkAddr
+}
@@ -0,0 +1,96 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package apiserver serves the administrative API. It isn't meant to be
+// reachable by guests.
+package apiserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/store"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type HTTPServer struct {
+	*core.Server
+
+	router *mux.Router
+	store  store.Store
+}
+
+// NewHTTPServer creates an API server for the store s.
+func NewHTTPServer(c *core.Server, s store.Store) *HTTPServer {
+	srv := &HTTPServer{
+		Server: c.WithLoggerFields(zap.String("endpoint", "api")),
+		router: mux.NewRouter(),
+		store:  s,
+	}
+
+	srv.router.HandleFunc("/v1/conflicts", srv.getConflicts).Methods("GET")
+	srv.router.HandleFunc("/v1/cache", srv.getCacheStats).Methods("GET")
+
+	return srv
+}
+
+func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+// getConflicts serves the data-link addresses more than one document claims
+// as the same kind.
+func (s *HTTPServer) getConflicts(w http.ResponseWriter, r *http.Request) {
+	lister, ok := s.store.(store.ConflictLister)
+	if !ok {
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+		return
+	}
+
+	conflicts, err := lister.ListConflicts(r.Context())
+	if err != nil {
+		s.Log().Error("failed to list conflicts", zap.NamedError("error", err))
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, conflicts)
+}
+
+// getCacheStats serves the hits, misses and evictions of the document cache.
+func (s *HTTPServer) getCacheStats(w http.ResponseWriter, r *http.Request) {
+	reporter, ok := s.store.(store.CacheStatsReporter)
+	if !ok {
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+		return
+	}
+
+	s.writeJSON(w, reporter.CacheStats())
+}
+
+func (s *HTTPServer) writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		s.Log().Error("failed to encode response", zap.NamedError("error", err))
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
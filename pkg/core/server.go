@@ -31,8 +31,11 @@ func NewServer(core *zapcore.Core) (*Server, error) {
 	return nil, nil
 }
 
+// NewNopServer creates a server that logs nothing.
 func NewNopServer() (*Server, error) {
-	return nil, nil
+	return &Server{
+		log: zap.NewNop(),
+	}, nil
 }
 
 func NewDevelopmentServer(options ...zap.Option) (*Server, error) {
@@ -0,0 +1,140 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/amari/cloud-metadata-server/internal/pkg/arp"
+)
+
+// ErrUnverified is returned when a caller's data-link address doesn't live
+// behind the port of the bridge it's pinned to.
+var ErrUnverified = errors.New("Data-link addr not verified by the bridge")
+
+// A BridgeResolver checks the answers of another resolver against the
+// forwarding database of the bridge a request arrived on, refusing addresses
+// that moved to another port, e.g. because a guest spoofed another's MAC, or
+// that live behind a port other than the one the request came through.
+type BridgeResolver struct {
+	resolver Resolver
+	watchers map[string]*arp.FDBWatcher
+	// neighbors tell which port a caller is behind
+	neighbors map[string]*arp.Watcher
+}
+
+// NewBridgeResolver watches the bridges and neighbor tables of each of
+// namespaces, see `arp.NewFDBWatcher` and `arp.NewWatcher`, to check the
+// answers of r.
+func NewBridgeResolver(r Resolver, d time.Duration, namespaces []string) (*BridgeResolver, error) {
+	br := &BridgeResolver{
+		resolver:  r,
+		watchers:  make(map[string]*arp.FDBWatcher, len(namespaces)),
+		neighbors: make(map[string]*arp.Watcher, len(namespaces)),
+	}
+
+	for _, namespace := range namespaces {
+		if _, ok := br.watchers[namespace]; ok {
+			continue
+		}
+
+		w, err := arp.NewFDBWatcher(d, namespace)
+		if err != nil {
+			br.Close()
+			return nil, err
+		}
+		br.watchers[namespace] = w
+
+		nw, err := arp.NewWatcher(d, arp.Filter{Namespace: namespace})
+		if err != nil {
+			br.Close()
+			return nil, err
+		}
+		br.neighbors[namespace] = nw
+	}
+
+	return br, nil
+}
+
+func (r *BridgeResolver) Close() error {
+	var err error
+	for _, w := range r.watchers {
+		if cerr := w.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	for _, w := range r.neighbors {
+		if cerr := w.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// Resolve implements `Resolver`. Callers that didn't arrive on a bridge are
+// left to the other resolver.
+//
+// The port a request arrived through is the one the bridge learned the
+// caller's neighbor entry behind: the host answers through that entry, so a
+// caller anywhere else can't complete the connection.
+func (r *BridgeResolver) Resolve(ctx context.Context, caller Caller) (net.HardwareAddr, error) {
+	w, ok := r.watchers[caller.Namespace]
+	if !ok || !w.IsBridge(caller.IfIndex) {
+		return r.resolver.Resolve(ctx, caller)
+	}
+
+	addr, err := r.resolver.Resolve(ctx, caller)
+	if err != nil {
+		return nil, err
+	}
+
+	port, ok := r.port(w, addr, caller.IfIndex)
+	if !ok {
+		return nil, ErrUnverified
+	}
+
+	nw := r.neighbors[caller.Namespace]
+	neighbor, ok := nw.Lookup(caller.IP, caller.IfIndex)
+	if !ok {
+		nw.ForcePoll()
+		if neighbor, ok = nw.Lookup(caller.IP, caller.IfIndex); !ok {
+			return nil, ErrUnverified
+		}
+	}
+	if arrivalPort, ok := r.port(w, neighbor.HardwareAddr, caller.IfIndex); !ok || arrivalPort != port {
+		return nil, ErrUnverified
+	}
+
+	return addr, nil
+}
+
+// port returns the port of bridgeIndex addr is pinned behind, see
+// `arp.FDBWatcher.Port`.
+func (r *BridgeResolver) port(w *arp.FDBWatcher, addr net.HardwareAddr, bridgeIndex int) (int, bool) {
+	if port, ok := w.Port(addr, bridgeIndex); ok {
+		return port, true
+	}
+
+	// the guest may be newer than the last update
+	w.ForcePoll()
+
+	return w.Port(addr, bridgeIndex)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package identity works out which guest a metadata request came from.
+package identity
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// A Caller is the remote end of a metadata request.
+type Caller struct {
+	IP net.IP
+	// IfIndex is the interface the request arrived on, 0 if unknown.
+	IfIndex int
+	// Namespace is the named network namespace the request arrived in,
+	// empty for the namespace of the process. IP and IfIndex only mean
+	// something there.
+	Namespace string
+}
+
+// A Resolver identifies the data-link address of a caller.
+type Resolver interface {
+	Resolve(ctx context.Context, caller Caller) (net.HardwareAddr, error)
+}
+
+var ErrNotFound = errors.New("Not found")
+
+// A Chain tries each resolver in priority order and returns the first
+// data-link address found.
+type Chain []Resolver
+
+// Resolve implements `Resolver`
+func (c Chain) Resolve(ctx context.Context, caller Caller) (net.HardwareAddr, error) {
+	for _, resolver := range c {
+		addr, err := resolver.Resolve(ctx, caller)
+		if err != nil {
+			continue
+		}
+
+		return addr, nil
+	}
+
+	return nil, ErrNotFound
+}
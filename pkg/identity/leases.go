@@ -0,0 +1,306 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// A LeaseFormat is a DHCP server's lease file format.
+type LeaseFormat int
+
+const (
+	// LeaseFormatDnsmasq is dnsmasq's dnsmasq.leases, one lease per line.
+	LeaseFormatDnsmasq LeaseFormat = iota
+	// LeaseFormatDhcpd is ISC dhcpd's dhcpd.leases, a journal of lease
+	// blocks.
+	LeaseFormatDhcpd
+)
+
+// A Lease is an address handed out by a DHCP server.
+type Lease struct {
+	IP           net.IP
+	HardwareAddr net.HardwareAddr
+	Hostname     string
+	// Expiry is the zero time for leases that never expire.
+	Expiry time.Time
+}
+
+// Expired reports whether the lease has run out at t.
+func (l *Lease) Expired(t time.Time) bool {
+	return !l.Expiry.IsZero() && !t.Before(l.Expiry)
+}
+
+// A LeaseFileResolver identifies callers by the unexpired leases a DHCP
+// server handed out. The file is read again whenever it changes, and its
+// leases are forgotten when it is removed.
+type LeaseFileResolver struct {
+	path   string
+	format LeaseFormat
+
+	doneCh  chan struct{}
+	watcher *fsnotify.Watcher
+
+	m          *sync.RWMutex
+	leasesByIP map[string]Lease
+}
+
+func NewLeaseFileResolver(path string, format LeaseFormat) (*LeaseFileResolver, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// DHCP servers replace the file by renaming a new one over it, so watch
+	// the directory rather than the file
+	if err := w.Add(filepath.Dir(path)); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	r := &LeaseFileResolver{
+		path:    path,
+		format:  format,
+		doneCh:  make(chan struct{}),
+		watcher: w,
+		m:       &sync.RWMutex{},
+	}
+
+	if err := r.load(); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	go func(r *LeaseFileResolver) {
+		defer r.watcher.Close()
+		for {
+			select {
+			case <-r.doneCh:
+				return
+			case event := <-r.watcher.Events:
+				if event.Name != r.path {
+					continue
+				}
+				// a file removed or renamed away takes its leases with it,
+				// one renamed over it brings new ones
+				if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) != 0 {
+					// keep serving the last good copy if the file can't be read
+					r.load()
+				}
+			case <-r.watcher.Errors:
+			}
+		}
+	}(r)
+
+	return r, nil
+}
+
+func (r *LeaseFileResolver) Close() error {
+	close(r.doneCh)
+
+	return nil
+}
+
+// Lease returns the unexpired lease of ip.
+func (r *LeaseFileResolver) Lease(ip net.IP) (Lease, bool) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	lease, ok := r.leasesByIP[ip.String()]
+	if !ok || lease.Expired(time.Now()) {
+		return Lease{}, false
+	}
+
+	return lease, true
+}
+
+// Resolve implements `Resolver`
+func (r *LeaseFileResolver) Resolve(ctx context.Context, caller Caller) (net.HardwareAddr, error) {
+	if caller.Namespace != "" {
+		return nil, ErrNotFound
+	}
+	if lease, ok := r.Lease(caller.IP); ok {
+		return lease.HardwareAddr, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+func (r *LeaseFileResolver) load() error {
+	f, err := os.Open(r.path)
+	if os.IsNotExist(err) {
+		r.m.Lock()
+		r.leasesByIP = nil
+		r.m.Unlock()
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var leases []Lease
+	switch r.format {
+	case LeaseFormatDhcpd:
+		leases, err = parseDhcpdLeases(f)
+	default:
+		leases, err = parseDnsmasqLeases(f)
+	}
+	if err != nil {
+		return err
+	}
+
+	// later leases for an address replace earlier ones
+	leasesByIP := make(map[string]Lease, len(leases))
+	for _, lease := range leases {
+		leasesByIP[lease.IP.String()] = lease
+	}
+
+	r.m.Lock()
+	r.leasesByIP = leasesByIP
+	r.m.Unlock()
+
+	return nil
+}
+
+// parseDnsmasqLeases parses lines of "<expiry> <mac> <ip> <hostname>
+// <client-id>", where an expiry of 0 never expires and a hostname of "*" is
+// unknown. DHCPv6 leases carry an IAID instead of a MAC and are skipped.
+func parseDnsmasqLeases(rd io.Reader) ([]Lease, error) {
+	var ret []Lease
+
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		addr, err := net.ParseMAC(fields[1])
+		if err != nil {
+			continue
+		}
+		ip := net.ParseIP(fields[2])
+		if ip == nil {
+			continue
+		}
+
+		lease := Lease{
+			IP:           ip,
+			HardwareAddr: addr,
+		}
+		if fields[3] != "*" {
+			lease.Hostname = fields[3]
+		}
+		if expiry != 0 {
+			lease.Expiry = time.Unix(expiry, 0)
+		}
+		ret = append(ret, lease)
+	}
+
+	return ret, scanner.Err()
+}
+
+var errBadDhcpdTime = errors.New("Bad dhcpd time")
+
+// parseDhcpdLeases parses "lease <ip> { ... }" blocks. The file is a journal,
+// so a later block for an address replaces an earlier one; leases that aren't
+// active are returned as already expired.
+func parseDhcpdLeases(rd io.Reader) ([]Lease, error) {
+	var ret []Lease
+
+	var lease *Lease
+	active := true
+
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// drop the terminator and any comment after it
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 3 && fields[0] == "lease" && fields[2] == "{":
+			lease, active = &Lease{IP: net.ParseIP(fields[1])}, true
+		case lease == nil:
+			// outside of a lease block
+		case len(fields) == 3 && fields[0] == "hardware" && fields[1] == "ethernet":
+			lease.HardwareAddr, _ = net.ParseMAC(fields[2])
+		case len(fields) == 3 && fields[0] == "binding" && fields[1] == "state":
+			active = fields[2] == "active"
+		case len(fields) >= 2 && fields[0] == "ends":
+			expiry, err := parseDhcpdTime(fields[1:])
+			if err != nil {
+				// a later block replaces an earlier one, so the lease
+				// can't just be dropped
+				expiry = time.Unix(0, 0)
+			}
+			lease.Expiry = expiry
+		case len(fields) >= 2 && fields[0] == "client-hostname":
+			lease.Hostname = strings.Trim(strings.TrimPrefix(line, "client-hostname"), ` "`)
+		case line == "}":
+			if lease.IP != nil && lease.HardwareAddr != nil {
+				if !active {
+					lease.Expiry = time.Unix(0, 0)
+				}
+				ret = append(ret, *lease)
+			}
+			lease = nil
+		}
+	}
+
+	return ret, scanner.Err()
+}
+
+// parseDhcpdTime parses "never", "<weekday> <yyyy/mm/dd> <hh:mm:ss>" in UTC or
+// "epoch <seconds>". The zero time is returned for "never".
+func parseDhcpdTime(fields []string) (time.Time, error) {
+	switch {
+	case len(fields) == 1 && fields[0] == "never":
+		return time.Time{}, nil
+	case len(fields) >= 2 && fields[0] == "epoch":
+		secs, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(secs, 0), nil
+	case len(fields) >= 3:
+		return time.Parse("2006/01/02 15:04:05", fields[1]+" "+fields[2])
+	}
+
+	return time.Time{}, errBadDhcpdTime
+}
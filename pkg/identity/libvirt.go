@@ -0,0 +1,181 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// How often a LibvirtResolver may rescan its directory on a miss, in case a
+// change wasn't reported.
+const libvirtRescanInterval = time.Second
+
+// A LibvirtResolver identifies callers by the interfaces in libvirt/QEMU
+// domain XML, e.g. /etc/libvirt/qemu or the live state in
+// /var/run/libvirt/qemu. Only interfaces with an <ip address=.../> element
+// can be matched. The directory is scanned again whenever a domain file
+// changes, so a destroyed domain's addresses aren't handed to the next guest
+// that gets its IP.
+type LibvirtResolver struct {
+	dir string
+
+	doneCh  chan struct{}
+	watcher *fsnotify.Watcher
+
+	m                 *sync.Mutex
+	scanned           time.Time
+	hardwareAddrsByIP map[string]net.HardwareAddr
+}
+
+func NewLibvirtResolver(dir string) (*LibvirtResolver, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Add(dir); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	r := &LibvirtResolver{
+		dir:     dir,
+		doneCh:  make(chan struct{}),
+		watcher: w,
+		m:       &sync.Mutex{},
+	}
+
+	if err := r.scan(); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	go func(r *LibvirtResolver) {
+		defer r.watcher.Close()
+		for {
+			select {
+			case <-r.doneCh:
+				return
+			case event := <-r.watcher.Events:
+				if !strings.HasSuffix(event.Name, ".xml") {
+					continue
+				}
+			case <-r.watcher.Errors:
+				// events may have been dropped
+			}
+			r.m.Lock()
+			r.scan()
+			r.m.Unlock()
+		}
+	}(r)
+
+	return r, nil
+}
+
+func (r *LibvirtResolver) Close() error {
+	close(r.doneCh)
+
+	return nil
+}
+
+// Resolve implements `Resolver`
+func (r *LibvirtResolver) Resolve(ctx context.Context, caller Caller) (net.HardwareAddr, error) {
+	if caller.Namespace != "" {
+		return nil, ErrNotFound
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	key := caller.IP.String()
+	if addr, ok := r.hardwareAddrsByIP[key]; ok {
+		return addr, nil
+	}
+	// domains come and go, look again unless we just did
+	if time.Since(r.scanned) >= libvirtRescanInterval && r.scan() == nil {
+		if addr, ok := r.hardwareAddrsByIP[key]; ok {
+			return addr, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+type libvirtInterface struct {
+	MAC struct {
+		Address string `xml:"address,attr"`
+	} `xml:"mac"`
+	IPs []struct {
+		Address string `xml:"address,attr"`
+	} `xml:"ip"`
+}
+
+// libvirtDomainFile is either a <domain> or the <domstatus> wrapping one.
+type libvirtDomainFile struct {
+	Interfaces []libvirtInterface `xml:"devices>interface"`
+	Domain     *struct {
+		Interfaces []libvirtInterface `xml:"devices>interface"`
+	} `xml:"domain"`
+}
+
+func (r *LibvirtResolver) scan() error {
+	paths, err := filepath.Glob(filepath.Join(r.dir, "*.xml"))
+	if err != nil {
+		return err
+	}
+
+	hardwareAddrsByIP := map[string]net.HardwareAddr{}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		var file libvirtDomainFile
+		if err := xml.Unmarshal(data, &file); err != nil {
+			continue
+		}
+		interfaces := file.Interfaces
+		if file.Domain != nil {
+			interfaces = append(interfaces, file.Domain.Interfaces...)
+		}
+
+		for _, iface := range interfaces {
+			addr, err := net.ParseMAC(iface.MAC.Address)
+			if err != nil {
+				continue
+			}
+			for _, ipAddr := range iface.IPs {
+				if ip := net.ParseIP(ipAddr.Address); ip != nil {
+					hardwareAddrsByIP[ip.String()] = addr
+				}
+			}
+		}
+	}
+
+	r.hardwareAddrsByIP = hardwareAddrsByIP
+	r.scanned = time.Now()
+
+	return nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/amari/cloud-metadata-server/internal/pkg/arp"
+)
+
+// A NeighborResolver identifies on-link callers by the kernel neighbor table
+// (ARP and NDP) of the network namespace they called from.
+type NeighborResolver struct {
+	watchers map[string]*arp.Watcher
+	// probers is empty unless active probing is enabled
+	probers map[string]*arp.Resolver
+}
+
+// NewNeighborResolver watches the neighbor table of each of namespaces, see
+// `arp.NewWatcher`. The empty name is the namespace of the process. If
+// probeTimeout is non-zero, callers missing from the table are actively
+// probed for up to probeTimeout before giving up.
+func NewNeighborResolver(d time.Duration, f arp.Filter, probeTimeout time.Duration, namespaces []string) (*NeighborResolver, error) {
+	r := &NeighborResolver{
+		watchers: make(map[string]*arp.Watcher, len(namespaces)),
+		probers:  make(map[string]*arp.Resolver, len(namespaces)),
+	}
+
+	for _, namespace := range namespaces {
+		if _, ok := r.watchers[namespace]; ok {
+			continue
+		}
+
+		f.Namespace = namespace
+		w, err := arp.NewWatcher(d, f)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.watchers[namespace] = w
+
+		if probeTimeout > 0 {
+			r.probers[namespace] = arp.NewResolver(w, probeTimeout)
+		}
+	}
+
+	return r, nil
+}
+
+func (r *NeighborResolver) Close() error {
+	var err error
+	for _, w := range r.watchers {
+		if cerr := w.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// Resolve implements `Resolver`
+func (r *NeighborResolver) Resolve(ctx context.Context, caller Caller) (net.HardwareAddr, error) {
+	watcher, ok := r.watchers[caller.Namespace]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	neighbor, ok := watcher.Lookup(caller.IP, caller.IfIndex)
+	if !ok {
+		watcher.ForcePoll()
+		neighbor, ok = watcher.Lookup(caller.IP, caller.IfIndex)
+	}
+	if prober, probing := r.probers[caller.Namespace]; !ok && probing {
+		neighbor, ok = prober.Resolve(ctx, caller.IP, caller.IfIndex)
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return neighbor.HardwareAddr, nil
+}
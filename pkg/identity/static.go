@@ -0,0 +1,67 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package identity
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+var (
+	errBadIP  = errors.New("Bad IP address")
+	errBadMAC = errors.New("Bad MAC address")
+)
+
+// A StaticResolver identifies callers by a fixed IP to MAC map, e.g. for
+// routed guests that aren't in the neighbor table.
+type StaticResolver struct {
+	hardwareAddrsByIP map[string]net.HardwareAddr
+}
+
+// NewStaticResolver parses a map of IP addresses to MAC addresses.
+func NewStaticResolver(m map[string]string) (*StaticResolver, error) {
+	hardwareAddrsByIP := make(map[string]net.HardwareAddr, len(m))
+	for ipStr, macStr := range m {
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			return nil, errBadIP
+		}
+		addr, err := net.ParseMAC(macStr)
+		if err != nil {
+			return nil, errBadMAC
+		}
+		hardwareAddrsByIP[ip.String()] = addr
+	}
+
+	return &StaticResolver{
+		hardwareAddrsByIP: hardwareAddrsByIP,
+	}, nil
+}
+
+// Resolve implements `Resolver`
+func (r *StaticResolver) Resolve(ctx context.Context, caller Caller) (net.HardwareAddr, error) {
+	// the map can't tell tenants with overlapping addresses apart
+	if caller.Namespace != "" {
+		return nil, ErrNotFound
+	}
+	if addr, ok := r.hardwareAddrsByIP[caller.IP.String()]; ok {
+		return addr, nil
+	}
+
+	return nil, ErrNotFound
+}
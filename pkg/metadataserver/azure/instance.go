@@ -0,0 +1,253 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+
+	"github.com/amari/cloud-metadata-server/pkg/models/microsoft/azure/v1"
+)
+
+// The JSON documents served by IMDS. Unlike the document model, every field
+// is always present, as an empty string if need be.
+
+type instanceV1 struct {
+	Compute computeV1 `json:"compute"`
+	Network networkV1 `json:"network"`
+}
+
+type computeV1 struct {
+	AzEnvironment     string        `json:"azEnvironment"`
+	Location          string        `json:"location"`
+	Name              string        `json:"name"`
+	Offer             string        `json:"offer"`
+	OSProfile         osProfileV1   `json:"osProfile"`
+	OSType            string        `json:"osType"`
+	Provider          string        `json:"provider"`
+	PublicKeys        []publicKeyV1 `json:"publicKeys"`
+	Publisher         string        `json:"publisher"`
+	ResourceGroupName string        `json:"resourceGroupName"`
+	ResourceID        string        `json:"resourceId"`
+	SKU               string        `json:"sku"`
+	SubscriptionID    string        `json:"subscriptionId"`
+	Tags              string        `json:"tags"`
+	TagsList          []tagV1       `json:"tagsList"`
+	UserData          string        `json:"userData"`
+	Version           string        `json:"version"`
+	VMID              string        `json:"vmId"`
+	VMSize            string        `json:"vmSize"`
+	Zone              string        `json:"zone"`
+}
+
+type osProfileV1 struct {
+	AdminUsername                 string `json:"adminUsername"`
+	ComputerName                  string `json:"computerName"`
+	DisablePasswordAuthentication string `json:"disablePasswordAuthentication"`
+}
+
+type publicKeyV1 struct {
+	KeyData string `json:"keyData"`
+	Path    string `json:"path"`
+}
+
+type tagV1 struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type networkV1 struct {
+	Interface []interfaceV1 `json:"interface"`
+}
+
+type interfaceV1 struct {
+	IPv4       ipConfigV1 `json:"ipv4"`
+	IPv6       ipConfigV1 `json:"ipv6"`
+	MacAddress string     `json:"macAddress"`
+}
+
+type ipConfigV1 struct {
+	IPAddress []ipAddressV1 `json:"ipAddress"`
+	Subnet    []subnetV1    `json:"subnet,omitempty"`
+}
+
+type ipAddressV1 struct {
+	PrivateIPAddress string `json:"privateIpAddress"`
+	PublicIPAddress  string `json:"publicIpAddress"`
+}
+
+type subnetV1 struct {
+	Address string `json:"address"`
+	Prefix  string `json:"prefix"`
+}
+
+type scheduledEventsV1 struct {
+	DocumentIncarnation uint               `json:"DocumentIncarnation"`
+	Events              []scheduledEventV1 `json:"Events"`
+}
+
+type scheduledEventV1 struct {
+	EventID           string   `json:"EventId"`
+	EventType         string   `json:"EventType"`
+	ResourceType      string   `json:"ResourceType"`
+	Resources         []string `json:"Resources"`
+	EventStatus       string   `json:"EventStatus"`
+	NotBefore         string   `json:"NotBefore"`
+	Description       string   `json:"Description"`
+	EventSource       string   `json:"EventSource"`
+	DurationInSeconds int      `json:"DurationInSeconds"`
+}
+
+func newInstanceV1(instance *azure.Instance) *instanceV1 {
+	compute := &instance.Compute
+
+	ret := &instanceV1{
+		Compute: computeV1{
+			AzEnvironment: defaultString(compute.AzEnvironment, "AzurePublicCloud"),
+			Location:      compute.Location,
+			Name:          compute.Name,
+			Offer:         compute.Offer,
+			OSProfile: osProfileV1{
+				AdminUsername:                 compute.OSProfile.AdminUsername,
+				ComputerName:                  defaultString(compute.OSProfile.ComputerName, compute.Name),
+				DisablePasswordAuthentication: boolString(compute.OSProfile.DisablePasswordAuthentication),
+			},
+			OSType:            compute.OSType,
+			Provider:          "Microsoft.Compute",
+			PublicKeys:        []publicKeyV1{},
+			Publisher:         compute.Publisher,
+			ResourceGroupName: compute.ResourceGroupName,
+			ResourceID:        compute.ResourceID,
+			SKU:               compute.SKU,
+			SubscriptionID:    compute.SubscriptionID,
+			TagsList:          []tagV1{},
+			UserData:          base64.StdEncoding.EncodeToString([]byte(compute.UserData)),
+			Version:           compute.Version,
+			VMID:              compute.VMID,
+			VMSize:            compute.VMSize,
+			Zone:              compute.Zone,
+		},
+		Network: networkV1{
+			Interface: []interfaceV1{},
+		},
+	}
+
+	for _, publicKey := range compute.PublicKeys {
+		ret.Compute.PublicKeys = append(ret.Compute.PublicKeys, publicKeyV1{
+			KeyData: publicKey.KeyData,
+			Path:    publicKey.Path,
+		})
+	}
+
+	names := make([]string, 0, len(compute.Tags))
+	for name := range compute.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tags := make([]string, 0, len(names))
+	for _, name := range names {
+		tags = append(tags, name+":"+compute.Tags[name])
+		ret.Compute.TagsList = append(ret.Compute.TagsList, tagV1{Name: name, Value: compute.Tags[name]})
+	}
+	ret.Compute.Tags = strings.Join(tags, ";")
+
+	for _, networkInterface := range instance.NetworkInterfaces {
+		ret.Network.Interface = append(ret.Network.Interface, interfaceV1{
+			IPv4: ipConfigV1{
+				IPAddress: newIPAddressesV1(networkInterface.IPv4),
+				Subnet:    newSubnetsV1(networkInterface.IPv4Subnets),
+			},
+			IPv6: ipConfigV1{
+				IPAddress: newIPAddressesV1(networkInterface.IPv6),
+				Subnet:    newSubnetsV1(networkInterface.IPv6Subnets),
+			},
+			// Azure formats MAC addresses as upper case hex digits without
+			// separators.
+			MacAddress: strings.ToUpper(strings.Replace(networkInterface.Mac.HumanReadableString(), ":", "", -1)),
+		})
+	}
+
+	return ret
+}
+
+func newIPAddressesV1(addrs []azure.IPAddress) []ipAddressV1 {
+	ret := make([]ipAddressV1, 0, len(addrs))
+	for _, addr := range addrs {
+		ret = append(ret, ipAddressV1{
+			PrivateIPAddress: addr.Private,
+			PublicIPAddress:  addr.Public,
+		})
+	}
+	return ret
+}
+
+func newSubnetsV1(subnets []azure.Subnet) []subnetV1 {
+	if len(subnets) == 0 {
+		return nil
+	}
+	ret := make([]subnetV1, 0, len(subnets))
+	for _, subnet := range subnets {
+		ret = append(ret, subnetV1{
+			Address: subnet.Address,
+			Prefix:  subnet.Prefix,
+		})
+	}
+	return ret
+}
+
+func newScheduledEventsV1(instance *azure.Instance) *scheduledEventsV1 {
+	ret := &scheduledEventsV1{
+		DocumentIncarnation: instance.ScheduledEvents.DocumentIncarnation,
+		Events:              []scheduledEventV1{},
+	}
+
+	for _, event := range instance.ScheduledEvents.Events {
+		resources := event.Resources
+		if len(resources) == 0 {
+			resources = []string{instance.Compute.Name}
+		}
+		ret.Events = append(ret.Events, scheduledEventV1{
+			EventID:           event.EventID,
+			EventType:         event.EventType,
+			ResourceType:      defaultString(event.ResourceType, "VirtualMachine"),
+			Resources:         resources,
+			EventStatus:       defaultString(event.EventStatus, "Scheduled"),
+			NotBefore:         event.NotBefore,
+			Description:       event.Description,
+			EventSource:       defaultString(event.EventSource, "Platform"),
+			DurationInSeconds: event.DurationInSeconds,
+		})
+	}
+
+	return ret
+}
+
+func defaultString(s string, d string) string {
+	if s == "" {
+		return d
+	}
+	return s
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
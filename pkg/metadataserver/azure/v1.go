@@ -0,0 +1,361 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/amari/cloud-metadata-server/internal/pkg/jsontree"
+	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/route"
+	"github.com/amari/cloud-metadata-server/pkg/models/microsoft/azure/v1"
+	"go.uber.org/zap"
+
+	"github.com/amari/cloud-metadata-server/pkg/store"
+	"github.com/gorilla/mux"
+)
+
+const TypeURIV1 = azure.TypeURI
+
+// The api-versions accepted by `/metadata/instance`, oldest first.
+var instanceVersionsV1 = [...]string{
+	"2017-03-01",
+	"2017-04-02",
+	"2017-08-01",
+	"2017-10-01",
+	"2017-12-01",
+	"2018-02-01",
+	"2018-04-02",
+	"2018-10-01",
+	"2019-02-01",
+	"2019-03-11",
+	"2019-04-30",
+	"2019-06-01",
+	"2019-06-04",
+	"2019-08-01",
+	"2019-08-15",
+	"2019-11-01",
+	"2020-06-01",
+	"2020-07-15",
+	"2020-09-01",
+	"2020-10-01",
+	"2020-12-01",
+	"2021-01-01",
+	"2021-02-01",
+}
+
+// The api-versions accepted by `/metadata/scheduledevents`, oldest first.
+var scheduledEventsVersionsV1 = [...]string{
+	"2017-03-01",
+	"2017-08-01",
+	"2017-11-01",
+	"2019-01-01",
+	"2019-08-01",
+	"2020-07-01",
+}
+
+// The api-version that introduced each of the instance fields that older
+// clients do not know about.
+var instanceFieldVersionsV1 = map[string]string{
+	"compute/osProfile": "2020-06-01",
+	"compute/tagsList":  "2019-06-04",
+	"compute/userData":  "2021-01-01",
+}
+
+// The number of versions suggested in "newest-versions" when a request
+// names an unknown api-version.
+const newestVersionsCountV1 = 3
+
+type EndpointV1 struct {
+	*core.Server
+	*httpEndpointV1
+
+	router *mux.Router
+}
+
+// Store implements `Endpoint`
+func (e *EndpointV1) Store() store.Store {
+	return e.httpEndpointV1.store
+}
+
+// Routes implements `HTTPEndpoint`
+func (e *EndpointV1) Routes() []route.Route {
+	return []route.Route{
+		{PathPrefix: "/metadata/instance"},
+		{PathPrefix: "/metadata/versions"},
+		{PathPrefix: "/metadata/scheduledevents"},
+	}
+}
+
+func (e *EndpointV1) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// check that the header is set!
+	addr := r.Header.Get("X-Remote-Data-Link-Addr")
+	if addr == "" {
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	// IMDS only answers requests that can't have been forwarded on behalf
+	// of someone else.
+	if r.Header.Get("Metadata") != "true" {
+		writeErrorV1(w, http.StatusBadRequest, "Bad request. Required metadata header not specified", nil)
+		return
+	}
+	if _, ok := r.Header["X-Forwarded-For"]; ok {
+		writeErrorV1(w, http.StatusForbidden, "Forbidden. Request contains an X-Forwarded-For header", nil)
+		return
+	}
+
+	e.router.ServeHTTP(w, r)
+}
+
+func NewEndpointV1(core *core.Server, s store.Store) *EndpointV1 {
+	endpoint := &httpEndpointV1{
+		Server: core,
+		store:  s,
+	}
+
+	router := mux.NewRouter()
+
+	// configure router here!
+	router.NotFoundHandler = http.HandlerFunc(notFoundHandlerV1)
+	router.StrictSlash(false)
+
+	router.HandleFunc("/metadata/versions", endpoint.getVersions).Methods("GET")
+	router.HandleFunc("/metadata/instance", endpoint.getInstanceMetadata).Methods("GET")
+	router.HandleFunc("/metadata/instance/{path:.*}", endpoint.getInstanceMetadata).Methods("GET")
+	router.HandleFunc("/metadata/scheduledevents", endpoint.getScheduledEvents).Methods("GET")
+	router.HandleFunc("/metadata/scheduledevents", endpoint.postScheduledEvents).Methods("POST")
+
+	return &EndpointV1{
+		core,
+		endpoint,
+		router,
+	}
+}
+
+type httpEndpointV1 struct {
+	*core.Server
+
+	store store.Store
+}
+
+func (e *httpEndpointV1) logger(r *http.Request) *zap.Logger {
+	return e.Log().With(
+		zap.String("datalink_addr", r.Header.Get("X-Remote-Data-Link-Addr")),
+		zap.String("request_path", r.URL.String()),
+		zap.String("schema", TypeURIV1),
+	)
+}
+
+func (e *httpEndpointV1) getInstance(r *http.Request) (*azure.Instance, error) {
+	d, err := e.store.GetDocument(r.Context(), r.Header.Get("X-Remote-Data-Link-Addr"), TypeURIV1)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, ok := d.Contents.(*azure.Instance)
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	return instance, nil
+}
+
+// checkAPIVersion writes an error and returns false unless the request names
+// one of versions.
+func checkAPIVersion(w http.ResponseWriter, r *http.Request, versions []string) (string, bool) {
+	newest := make([]string, 0, newestVersionsCountV1)
+	for i := len(versions) - 1; i >= 0 && len(newest) < newestVersionsCountV1; i-- {
+		newest = append(newest, versions[i])
+	}
+
+	apiVersion := r.URL.Query().Get("api-version")
+	if apiVersion == "" {
+		writeErrorV1(w, http.StatusBadRequest, "Bad request. api-version was not specified in the request. For more information refer to aka.ms/azureimds", newest)
+		return "", false
+	}
+
+	for _, version := range versions {
+		if version == apiVersion {
+			return apiVersion, true
+		}
+	}
+
+	writeErrorV1(w, http.StatusBadRequest, "Bad request. api-version is invalid or was not specified in the request. For more information refer to aka.ms/azureimds", newest)
+	return "", false
+}
+
+func (e *httpEndpointV1) getVersions(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	if _, err := e.getInstance(r); err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	writeJSONV1(w, map[string][]string{"apiVersions": instanceVersionsV1[:]})
+
+	l.Info("", zap.Int("status", 200))
+}
+
+func (e *httpEndpointV1) getInstanceMetadata(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	apiVersion, ok := checkAPIVersion(w, r, instanceVersionsV1[:])
+	if !ok {
+		l.Error("bad api-version", zap.String("api_version", r.URL.Query().Get("api-version")))
+		return
+	}
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	tree, err := jsontree.FromValue(newInstanceV1(instance))
+	if err != nil {
+		l.Error("failed to encode document", zap.NamedError("error", err))
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	for path, version := range instanceFieldVersionsV1 {
+		if apiVersion < version {
+			jsontree.Remove(tree, path)
+		}
+	}
+
+	node, ok := jsontree.Lookup(tree, mux.Vars(r)["path"])
+	if !ok {
+		l.Error("bad attribute")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	// leaves are only served as text, everything else only as JSON
+	switch format := r.URL.Query().Get("format"); {
+	case format == "text" && jsontree.IsLeaf(node):
+		writeV1(w, "text/plain; charset=utf-8", []byte(jsontree.Text(node)))
+	case format == "text":
+		writeErrorV1(w, http.StatusBadRequest, "Bad request. Query parameter format=text is only supported for leaf nodes. For more information refer to aka.ms/azureimds", nil)
+		return
+	case format != "" && format != "json":
+		writeErrorV1(w, http.StatusBadRequest, "Bad request. Query parameter format is invalid. For more information refer to aka.ms/azureimds", nil)
+		return
+	case jsontree.IsLeaf(node):
+		writeErrorV1(w, http.StatusBadRequest, "Bad request. Query parameter format=json is not supported for leaf nodes, use format=text. For more information refer to aka.ms/azureimds", nil)
+		return
+	default:
+		writeJSONV1(w, node)
+	}
+
+	l.Info("", zap.Int("status", 200))
+}
+
+func (e *httpEndpointV1) getScheduledEvents(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	if _, ok := checkAPIVersion(w, r, scheduledEventsVersionsV1[:]); !ok {
+		l.Error("bad api-version", zap.String("api_version", r.URL.Query().Get("api-version")))
+		return
+	}
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	writeJSONV1(w, newScheduledEventsV1(instance))
+
+	l.Info("", zap.Int("status", 200))
+}
+
+type startRequestsV1 struct {
+	StartRequests []struct {
+		EventID string `json:"EventId"`
+	} `json:"StartRequests"`
+}
+
+// postScheduledEvents accepts the approval of scheduled events. Events are
+// static documents, so approving one has no effect.
+func (e *httpEndpointV1) postScheduledEvents(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	if _, ok := checkAPIVersion(w, r, scheduledEventsVersionsV1[:]); !ok {
+		l.Error("bad api-version", zap.String("api_version", r.URL.Query().Get("api-version")))
+		return
+	}
+
+	if _, err := e.getInstance(r); err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	var body startRequestsV1
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		l.Error("bad request body", zap.NamedError("error", err))
+		writeErrorV1(w, http.StatusBadRequest, "Bad request. Request body is invalid", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	l.Info("", zap.Int("status", 200))
+}
+
+func writeV1(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func writeJSONV1(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	writeV1(w, "application/json; charset=utf-8", data)
+}
+
+type errorV1 struct {
+	Error          string   `json:"error"`
+	NewestVersions []string `json:"newest-versions,omitempty"`
+}
+
+// writeErrorV1 writes an error body the way IMDS does.
+func writeErrorV1(w http.ResponseWriter, status int, message string, newestVersions []string) {
+	data, _ := json.Marshal(&errorV1{
+		Error:          message,
+		NewestVersions: newestVersions,
+	})
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func notFoundHandlerV1(w http.ResponseWriter, r *http.Request) {
+	writeErrorV1(w, http.StatusNotFound, "Not found", nil)
+}
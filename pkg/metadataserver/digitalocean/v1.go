@@ -23,6 +23,7 @@ import (
 	"strconv"
 
 	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/route"
 	"github.com/amari/cloud-metadata-server/pkg/models/digitalocean/v1"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
@@ -45,6 +46,13 @@ func (e *EndpointV1) Store() store.Store {
 	return e.httpEndpointV1.store
 }
 
+// Routes implements `HTTPEndpoint`
+func (e *EndpointV1) Routes() []route.Route {
+	return []route.Route{
+		{PathPrefix: "/metadata/v1"},
+	}
+}
+
 func (e *EndpointV1) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// check that the header is set!
 	addr := r.Header.Get("X-Remote-Data-Link-Addr")
@@ -0,0 +1,55 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ec2
+
+import (
+	"net/http"
+
+	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/models/amazonaws/ec2/v1"
+	"github.com/gorilla/mux"
+)
+
+// An InstanceFunc returns the EC2 view of the document for the caller of r.
+type InstanceFunc func(r *http.Request) (*ec2.Instance, error)
+
+// NewCompatHandler returns a handler serving the EC2 compatible `meta-data`
+// and `user-data` tree that other metadata services (e.g. OpenStack) expose
+// next to their own API. Unlike `EndpointV1`, it does not support IMDSv2
+// sessions. schema is the kind of the documents instance reads from and is
+// only used for logging.
+func NewCompatHandler(core *core.Server, schema string, instance InstanceFunc) http.Handler {
+	endpoint := &httpEndpointV1{
+		Server:   core,
+		schema:   schema,
+		instance: instance,
+	}
+
+	router := mux.NewRouter()
+
+	router.NotFoundHandler = http.HandlerFunc(notFoundHandlerV1)
+	router.StrictSlash(false)
+
+	router.HandleFunc("/", endpoint.getVersionIndex).Methods("GET")
+	router.HandleFunc("/"+versionPatternV1, endpoint.getIndex).Methods("GET")
+	router.HandleFunc("/"+versionPatternV1+"/", endpoint.getIndex).Methods("GET")
+	router.HandleFunc("/"+versionPatternV1+"/meta-data", endpoint.getMetaData).Methods("GET")
+	router.HandleFunc("/"+versionPatternV1+"/meta-data/{path:.*}", endpoint.getMetaData).Methods("GET")
+	router.HandleFunc("/"+versionPatternV1+"/user-data", endpoint.getUserData).Methods("GET")
+
+	return router
+}
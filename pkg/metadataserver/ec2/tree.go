@@ -0,0 +1,243 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ec2
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/amari/cloud-metadata-server/pkg/models/amazonaws/ec2/v1"
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+)
+
+// A metadataNode is either a leaf holding a value or a directory of named
+// children, mirroring the layout of the EC2 `meta-data` category tree.
+type metadataNode struct {
+	value    string
+	isDir    bool
+	children []metadataEntry
+}
+
+type metadataEntry struct {
+	name string
+	// label replaces the name in the parent's listing (e.g. "0=my-key").
+	label string
+	node  *metadataNode
+}
+
+func newMetadataDir() *metadataNode {
+	return &metadataNode{isDir: true}
+}
+
+// addLeaf adds a leaf to the directory unless its value is empty.
+func (n *metadataNode) addLeaf(name string, value string) {
+	if value == "" {
+		return
+	}
+	n.children = append(n.children, metadataEntry{name: name, node: &metadataNode{value: value}})
+}
+
+// addDir adds a sub-directory unless it has no children.
+func (n *metadataNode) addDir(name string, dir *metadataNode) {
+	n.addLabeledDir(name, "", dir)
+}
+
+func (n *metadataNode) addLabeledDir(name string, label string, dir *metadataNode) {
+	if len(dir.children) == 0 {
+		return
+	}
+	n.children = append(n.children, metadataEntry{name: name, label: label, node: dir})
+}
+
+// lookup resolves a slash separated path relative to n. Like EC2, a
+// directory may be requested with or without a trailing slash, but a leaf
+// may not.
+func (n *metadataNode) lookup(path string) (*metadataNode, bool) {
+	trailingSlash := strings.HasSuffix(path, "/")
+	path = strings.Trim(path, "/")
+
+	node := n
+	if path != "" {
+	L:
+		for _, name := range strings.Split(path, "/") {
+			if !node.isDir {
+				return nil, false
+			}
+			for _, child := range node.children {
+				if child.name == name {
+					node = child.node
+					continue L
+				}
+			}
+			return nil, false
+		}
+	}
+
+	if trailingSlash && !node.isDir {
+		return nil, false
+	}
+
+	return node, true
+}
+
+// String returns the value of a leaf or the listing of a directory.
+func (n *metadataNode) String() string {
+	if !n.isDir {
+		return n.value
+	}
+
+	lines := make([]string, 0, len(n.children))
+	for _, child := range n.children {
+		switch {
+		case child.label != "":
+			lines = append(lines, child.label)
+		case child.node.isDir:
+			lines = append(lines, child.name+"/")
+		default:
+			lines = append(lines, child.name)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func newMetaDataTree(instance *ec2.Instance) *metadataNode {
+	root := newMetadataDir()
+
+	root.addLeaf("ami-id", instance.ImageID)
+	root.addLeaf("ami-launch-index", strconv.FormatUint(uint64(instance.LaunchIndex), 10))
+	root.addDir("block-device-mapping", newBlockDeviceMappingTree(instance.BlockDeviceMapping))
+	root.addLeaf("hostname", instance.Hostname)
+	root.addLeaf("instance-action", "none")
+	root.addLeaf("instance-id", instance.ID)
+	root.addLeaf("instance-type", instance.InstanceType)
+	root.addLeaf("local-hostname", instance.LocalHostname)
+	root.addLeaf("local-ipv4", ipv4String(instance.LocalIPv4))
+	if primary := instance.PrimaryNetworkInterface(); primary != nil {
+		root.addLeaf("mac", primary.Mac.HumanReadableString())
+	}
+	root.addDir("network", newNetworkTree(instance.NetworkInterfaces))
+
+	placement := newMetadataDir()
+	placement.addLeaf("availability-zone", instance.Placement.AvailabilityZone)
+	placement.addLeaf("availability-zone-id", instance.Placement.AvailabilityZoneID)
+	placement.addLeaf("region", instance.Placement.Region)
+	root.addDir("placement", placement)
+
+	root.addLeaf("public-hostname", instance.PublicHostname)
+	root.addLeaf("public-ipv4", ipv4String(instance.PublicIPv4))
+
+	publicKeys := newMetadataDir()
+	for i, publicKey := range instance.PublicKeys {
+		key := newMetadataDir()
+		key.addLeaf("openssh-key", publicKey.OpenSSHKey)
+		id := strconv.Itoa(i)
+		publicKeys.addLabeledDir(id, id+"="+publicKey.Name, key)
+	}
+	root.addDir("public-keys", publicKeys)
+
+	root.addLeaf("reservation-id", instance.ReservationID)
+	root.addLeaf("security-groups", strings.Join(instance.SecurityGroups, "\n"))
+
+	services := newMetadataDir()
+	services.addLeaf("domain", instance.Services.Domain)
+	services.addLeaf("partition", instance.Services.Partition)
+	root.addDir("services", services)
+
+	return root
+}
+
+func newBlockDeviceMappingTree(mapping ec2.BlockDeviceMapping) *metadataNode {
+	dir := newMetadataDir()
+
+	names := make([]string, 0, len(mapping))
+	for name := range mapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		dir.addLeaf(name, mapping[name])
+	}
+
+	return dir
+}
+
+func newNetworkTree(networkInterfaces []ec2.NetworkInterface) *metadataNode {
+	macs := newMetadataDir()
+
+	for i := range networkInterfaces {
+		networkInterface := &networkInterfaces[i]
+		mac := networkInterface.Mac.HumanReadableString()
+
+		dir := newMetadataDir()
+		dir.addLeaf("device-number", strconv.FormatUint(uint64(networkInterface.DeviceNumber), 10))
+		dir.addLeaf("interface-id", networkInterface.InterfaceID)
+		dir.addLeaf("ipv6s", ipv6Lines(networkInterface.IPv6s))
+		dir.addLeaf("local-hostname", networkInterface.LocalHostname)
+		dir.addLeaf("local-ipv4s", ipv4Lines(networkInterface.LocalIPv4s))
+		dir.addLeaf("mac", mac)
+		dir.addLeaf("owner-id", networkInterface.OwnerID)
+		dir.addLeaf("public-hostname", networkInterface.PublicHostname)
+		dir.addLeaf("public-ipv4s", ipv4Lines(networkInterface.PublicIPv4s))
+		dir.addLeaf("security-group-ids", strings.Join(networkInterface.SecurityGroupIDs, "\n"))
+		dir.addLeaf("security-groups", strings.Join(networkInterface.SecurityGroups, "\n"))
+		dir.addLeaf("subnet-id", networkInterface.SubnetID)
+		dir.addLeaf("subnet-ipv4-cidr-block", networkInterface.SubnetIPv4CIDRBlock)
+		dir.addLeaf("subnet-ipv6-cidr-blocks", strings.Join(networkInterface.SubnetIPv6CIDRBlocks, "\n"))
+		dir.addLeaf("vpc-id", networkInterface.VPCID)
+		if len(networkInterface.VPCIPv4CIDRBlocks) > 0 {
+			dir.addLeaf("vpc-ipv4-cidr-block", networkInterface.VPCIPv4CIDRBlocks[0])
+		}
+		dir.addLeaf("vpc-ipv4-cidr-blocks", strings.Join(networkInterface.VPCIPv4CIDRBlocks, "\n"))
+		dir.addLeaf("vpc-ipv6-cidr-blocks", strings.Join(networkInterface.VPCIPv6CIDRBlocks, "\n"))
+
+		macs.addDir(mac, dir)
+	}
+
+	interfaces := newMetadataDir()
+	interfaces.addDir("macs", macs)
+
+	network := newMetadataDir()
+	network.addDir("interfaces", interfaces)
+
+	return network
+}
+
+func ipv4String(addr model.IPv4) string {
+	if len(addr) == 0 {
+		return ""
+	}
+	return addr.String()
+}
+
+func ipv4Lines(addrs []model.IPv4) string {
+	lines := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		lines = append(lines, addr.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func ipv6Lines(addrs []model.IPv6) string {
+	lines := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		lines = append(lines, addr.String())
+	}
+	return strings.Join(lines, "\n")
+}
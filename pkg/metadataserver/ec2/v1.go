@@ -0,0 +1,347 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ec2
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amari/cloud-metadata-server/internal/pkg/token"
+	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/route"
+	"github.com/amari/cloud-metadata-server/pkg/models/amazonaws/ec2/v1"
+	"go.uber.org/zap"
+
+	"github.com/amari/cloud-metadata-server/pkg/store"
+	"github.com/gorilla/mux"
+)
+
+const TypeURIV1 = ec2.TypeURI
+
+// The metadata API versions that are accepted in place of "latest".
+var versionsV1 = [...]string{
+	"1.0",
+	"2007-01-19",
+	"2007-03-01",
+	"2007-08-29",
+	"2007-10-10",
+	"2007-12-15",
+	"2008-02-01",
+	"2008-09-01",
+	"2009-04-04",
+	"2011-01-01",
+	"2011-05-01",
+	"2012-01-12",
+	"2014-02-25",
+	"2014-11-05",
+	"2015-10-20",
+	"2016-04-19",
+	"2016-06-30",
+	"2016-09-02",
+	"2018-03-28",
+	"2018-08-17",
+	"2018-09-24",
+	"2019-10-01",
+	"latest",
+}
+
+const versionPatternV1 = "{version:(?:latest|1\\.0|[0-9]{4}-[0-9]{2}-[0-9]{2})}"
+
+const (
+	tokenHeaderV1    = "X-aws-ec2-metadata-token"
+	tokenTTLHeaderV1 = "X-aws-ec2-metadata-token-ttl-seconds"
+	maxTokenTTLV1    = 21600
+)
+
+type EndpointV1 struct {
+	*core.Server
+	*httpEndpointV1
+
+	router *mux.Router
+}
+
+// Store implements `Endpoint`
+func (e *EndpointV1) Store() store.Store {
+	return e.httpEndpointV1.store
+}
+
+// Routes implements `HTTPEndpoint`
+func (e *EndpointV1) Routes() []route.Route {
+	return []route.Route{
+		{PathPrefix: "/latest"},
+		{PathPrefix: "/"},
+	}
+}
+
+func (e *EndpointV1) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// check that the header is set!
+	addr := r.Header.Get("X-Remote-Data-Link-Addr")
+	if addr == "" {
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	e.router.ServeHTTP(w, r)
+}
+
+func NewEndpointV1(core *core.Server, s store.Store) *EndpointV1 {
+	endpoint := &httpEndpointV1{
+		Server:   core,
+		schema:   TypeURIV1,
+		instance: storeInstanceFuncV1(s),
+		store:    s,
+		tokens:   token.NewStore(),
+	}
+
+	router := mux.NewRouter()
+
+	// configure router here!
+	router.NotFoundHandler = http.HandlerFunc(notFoundHandlerV1)
+	router.StrictSlash(false)
+
+	router.HandleFunc("/latest/api/token", endpoint.putToken).Methods("PUT")
+
+	router.HandleFunc("/", endpoint.authorize(endpoint.getVersionIndex)).Methods("GET")
+	router.HandleFunc("/"+versionPatternV1, endpoint.authorize(endpoint.getIndex)).Methods("GET")
+	router.HandleFunc("/"+versionPatternV1+"/", endpoint.authorize(endpoint.getIndex)).Methods("GET")
+	router.HandleFunc("/"+versionPatternV1+"/meta-data", endpoint.authorize(endpoint.getMetaData)).Methods("GET")
+	router.HandleFunc("/"+versionPatternV1+"/meta-data/{path:.*}", endpoint.authorize(endpoint.getMetaData)).Methods("GET")
+	router.HandleFunc("/"+versionPatternV1+"/user-data", endpoint.authorize(endpoint.getUserData)).Methods("GET")
+
+	return &EndpointV1{
+		core,
+		endpoint,
+		router,
+	}
+}
+
+type httpEndpointV1 struct {
+	*core.Server
+
+	schema   string
+	instance InstanceFunc
+	store    store.Store
+	tokens   *token.Store
+}
+
+func (e *httpEndpointV1) logger(r *http.Request) *zap.Logger {
+	return e.Log().With(
+		zap.String("datalink_addr", r.Header.Get("X-Remote-Data-Link-Addr")),
+		zap.String("request_path", r.URL.String()),
+		zap.String("schema", e.schema),
+	)
+}
+
+func (e *httpEndpointV1) getInstance(r *http.Request) (*ec2.Instance, error) {
+	return e.instance(r)
+}
+
+// storeInstanceFuncV1 looks up the caller's `amazonaws.com/ec2/v1` document.
+func storeInstanceFuncV1(s store.Store) InstanceFunc {
+	return func(r *http.Request) (*ec2.Instance, error) {
+		d, err := s.GetDocument(r.Context(), r.Header.Get("X-Remote-Data-Link-Addr"), TypeURIV1)
+		if err != nil {
+			return nil, err
+		}
+
+		instance, ok := d.Contents.(*ec2.Instance)
+		if !ok {
+			return nil, store.ErrNotFound
+		}
+
+		return instance, nil
+	}
+}
+
+// putToken starts an IMDSv2 session for the caller.
+func (e *httpEndpointV1) putToken(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	if _, err := e.getInstance(r); err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	// tokens must not be handed out through a proxy
+	if r.Header.Get("X-Forwarded-For") != "" {
+		l.Error("refusing to issue a token to a forwarded request")
+		forbiddenHandlerV1(w, r)
+		return
+	}
+
+	ttl, err := strconv.ParseUint(r.Header.Get(tokenTTLHeaderV1), 10, 32)
+	if err != nil || ttl == 0 || ttl > maxTokenTTLV1 {
+		l.Error("bad token ttl", zap.String("ttl", r.Header.Get(tokenTTLHeaderV1)))
+		badRequestHandlerV1(w, r)
+		return
+	}
+
+	t, err := e.tokens.Issue(r.Header.Get("X-Remote-Data-Link-Addr"), time.Duration(ttl)*time.Second)
+	if err != nil {
+		l.Error("failed to issue token", zap.NamedError("error", err))
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(tokenTTLHeaderV1, strconv.FormatUint(ttl, 10))
+	writeTextV1(w, t)
+
+	l.Info("", zap.Int("status", 200))
+}
+
+// authorize checks the IMDSv2 session token, if any, before calling next.
+// Requests without a token are only accepted when the document does not
+// require one.
+func (e *httpEndpointV1) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := e.logger(r)
+
+		instance, err := e.getInstance(r)
+		if err != nil {
+			l.Error("document not found")
+			notFoundHandlerV1(w, r)
+			return
+		}
+
+		t := r.Header.Get(tokenHeaderV1)
+		if t == "" {
+			if instance.MetadataOptions.TokensRequired() {
+				l.Error("missing session token")
+				unauthorizedHandlerV1(w, r)
+				return
+			}
+		} else if !e.tokens.Validate(t, r.Header.Get("X-Remote-Data-Link-Addr")) {
+			l.Error("invalid session token")
+			unauthorizedHandlerV1(w, r)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (e *httpEndpointV1) getVersionIndex(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	if _, err := e.getInstance(r); err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	writeTextV1(w, strings.Join(versionsV1[:], "\n"))
+
+	l.Info("", zap.Int("status", 200))
+}
+
+func (e *httpEndpointV1) getIndex(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	index := []string{"meta-data"}
+	if instance.UserData != "" {
+		index = append(index, "user-data")
+	}
+	writeTextV1(w, strings.Join(index, "\n"))
+
+	l.Info("", zap.Int("status", 200))
+}
+
+func (e *httpEndpointV1) getMetaData(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	path := mux.Vars(r)["path"]
+	node, ok := newMetaDataTree(instance).lookup(path)
+	if !ok {
+		l.Error("bad attribute")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	writeTextV1(w, node.String())
+
+	l.Info("", zap.Int("status", 200))
+}
+
+func (e *httpEndpointV1) getUserData(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	if instance.UserData == "" {
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, instance.UserData)
+
+	l.Info("", zap.Int("status", 200))
+}
+
+func writeTextV1(w http.ResponseWriter, s string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, s)
+}
+
+func badRequestHandlerV1(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusBadRequest)
+	fmt.Fprint(w, "Bad Request")
+}
+
+func unauthorizedHandlerV1(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusUnauthorized)
+	fmt.Fprint(w, "Unauthorized")
+}
+
+func forbiddenHandlerV1(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusForbidden)
+	fmt.Fprint(w, "Forbidden")
+}
+
+func notFoundHandlerV1(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprint(w, "Not Found")
+}
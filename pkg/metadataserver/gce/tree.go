@@ -0,0 +1,332 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/amari/cloud-metadata-server/pkg/models/googleapis/compute/v1"
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+)
+
+// lines is a leaf value that is rendered one element per line as text and
+// as an array as JSON.
+type lines []string
+
+// A metadataNode is either a leaf holding a value or a directory of named
+// children, mirroring the layout of the GCE metadata server.
+type metadataNode struct {
+	value interface{}
+	isDir bool
+	// isList directories have children named "0", "1", ... and render as a
+	// JSON array.
+	isList bool
+	// rawKeys directories hold user defined keys that must not be converted
+	// to camel case (e.g. attributes).
+	rawKeys  bool
+	children []metadataEntry
+}
+
+type metadataEntry struct {
+	name string
+	node *metadataNode
+}
+
+func newMetadataDir() *metadataNode {
+	return &metadataNode{isDir: true}
+}
+
+func newMetadataList() *metadataNode {
+	return &metadataNode{isDir: true, isList: true}
+}
+
+// addLeaf adds a leaf to the directory unless its value is empty.
+func (n *metadataNode) addLeaf(name string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return
+		}
+	case lines:
+		if len(v) == 0 {
+			return
+		}
+	case []string:
+		if v == nil {
+			v = []string{}
+		}
+		value = v
+	}
+	n.children = append(n.children, metadataEntry{name: name, node: &metadataNode{value: value}})
+}
+
+func (n *metadataNode) addDir(name string, dir *metadataNode) {
+	n.children = append(n.children, metadataEntry{name: name, node: dir})
+}
+
+// lookup resolves a slash separated path relative to n.
+func (n *metadataNode) lookup(path string) (*metadataNode, bool) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return n, true
+	}
+
+	node := n
+L:
+	for _, name := range strings.Split(path, "/") {
+		if !node.isDir {
+			return nil, false
+		}
+		for _, child := range node.children {
+			if child.name == name {
+				node = child.node
+				continue L
+			}
+		}
+		return nil, false
+	}
+
+	return node, true
+}
+
+// names returns the listing of a directory.
+func (n *metadataNode) names() []string {
+	ret := make([]string, 0, len(n.children))
+	for _, child := range n.children {
+		if child.node.isDir {
+			ret = append(ret, child.name+"/")
+		} else {
+			ret = append(ret, child.name)
+		}
+	}
+	return ret
+}
+
+// text renders a leaf as text.
+func (n *metadataNode) text() string {
+	switch v := n.value.(type) {
+	case string:
+		return v
+	case lines:
+		return strings.Join(v, "\n") + "\n"
+	case []string:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// jsonValue renders n and all of its descendants as a JSON compatible value.
+func (n *metadataNode) jsonValue() interface{} {
+	if !n.isDir {
+		if v, ok := n.value.(lines); ok {
+			return []string(v)
+		}
+		return n.value
+	}
+
+	if n.isList {
+		ret := make([]interface{}, 0, len(n.children))
+		for _, child := range n.children {
+			ret = append(ret, child.node.jsonValue())
+		}
+		return ret
+	}
+
+	ret := make(map[string]interface{}, len(n.children))
+	for _, child := range n.children {
+		key := child.name
+		if !n.rawKeys {
+			key = camelCase(key)
+		}
+		ret[key] = child.node.jsonValue()
+	}
+	return ret
+}
+
+// flatten renders n and all of its descendants as "path value" lines.
+func (n *metadataNode) flatten(prefix string, out *[]string) {
+	if !n.isDir {
+		*out = append(*out, prefix+" "+strings.TrimSuffix(n.text(), "\n"))
+		return
+	}
+	for _, child := range n.children {
+		name := child.name
+		if prefix != "" {
+			name = prefix + "/" + name
+		}
+		child.node.flatten(name, out)
+	}
+}
+
+func camelCase(s string) string {
+	parts := strings.Split(s, "-")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+func newRootTree(instance *compute.Instance) *metadataNode {
+	root := newMetadataDir()
+	root.addDir("instance", newInstanceTree(instance))
+	root.addDir("project", newProjectTree(&instance.Project))
+	return root
+}
+
+func newInstanceTree(instance *compute.Instance) *metadataNode {
+	dir := newMetadataDir()
+
+	dir.addDir("attributes", newAttributesTree(instance.Attributes))
+	dir.addLeaf("cpu-platform", instance.CPUPlatform)
+	dir.addLeaf("description", instance.Description)
+
+	disks := newMetadataList()
+	for i, disk := range instance.Disks {
+		d := newMetadataDir()
+		d.addLeaf("device-name", disk.DeviceName)
+		d.addLeaf("index", uint64(i))
+		d.addLeaf("mode", defaultString(disk.Mode, "READ_WRITE"))
+		d.addLeaf("type", defaultString(disk.Type, "PERSISTENT"))
+		disks.addDir(strconv.Itoa(i), d)
+	}
+	dir.addDir("disks", disks)
+
+	dir.addLeaf("hostname", instance.Hostname)
+	dir.addLeaf("id", instance.ID)
+	dir.addLeaf("image", instance.Image)
+	dir.addLeaf("machine-type", instance.MachineType)
+	dir.addLeaf("name", instance.Name)
+
+	networkInterfaces := newMetadataList()
+	for i := range instance.NetworkInterfaces {
+		networkInterfaces.addDir(strconv.Itoa(i), newNetworkInterfaceTree(&instance.NetworkInterfaces[i]))
+	}
+	dir.addDir("network-interfaces", networkInterfaces)
+
+	serviceAccounts := newMetadataDir()
+	serviceAccounts.rawKeys = true
+	for i, serviceAccount := range instance.ServiceAccounts {
+		sa := newMetadataDir()
+		aliases := serviceAccount.Aliases
+		if i == 0 && len(aliases) == 0 {
+			aliases = []string{"default"}
+		}
+		sa.addLeaf("aliases", lines(aliases))
+		sa.addLeaf("email", serviceAccount.Email)
+		sa.addLeaf("scopes", lines(serviceAccount.Scopes))
+		if i == 0 {
+			serviceAccounts.addDir("default", sa)
+		}
+		serviceAccounts.addDir(serviceAccount.Email, sa)
+	}
+	dir.addDir("service-accounts", serviceAccounts)
+
+	dir.addLeaf("tags", instance.Tags)
+	dir.addLeaf("zone", instance.Zone)
+
+	return dir
+}
+
+func newNetworkInterfaceTree(networkInterface *compute.NetworkInterface) *metadataNode {
+	dir := newMetadataDir()
+
+	accessConfigs := newMetadataList()
+	for i, accessConfig := range networkInterface.AccessConfigs {
+		ac := newMetadataDir()
+		ac.addLeaf("external-ip", ipv4String(accessConfig.ExternalIP))
+		ac.addLeaf("type", defaultString(accessConfig.Type, "ONE_TO_ONE_NAT"))
+		accessConfigs.addDir(strconv.Itoa(i), ac)
+	}
+	dir.addDir("access-configs", accessConfigs)
+
+	dir.addLeaf("dns-servers", ipv4Lines(networkInterface.DNSServers))
+
+	forwardedIPs := newMetadataList()
+	for i, ip := range networkInterface.ForwardedIPs {
+		forwardedIPs.addLeaf(strconv.Itoa(i), ip.String())
+	}
+	dir.addDir("forwarded-ips", forwardedIPs)
+
+	dir.addLeaf("gateway", ipv4String(networkInterface.Gateway))
+	dir.addLeaf("ip", ipv4String(networkInterface.IP))
+	dir.addLeaf("mac", networkInterface.Mac.HumanReadableString())
+	if networkInterface.MTU != 0 {
+		dir.addLeaf("mtu", uint64(networkInterface.MTU))
+	}
+	dir.addLeaf("network", networkInterface.Network)
+	if len(networkInterface.Subnetmask) != 0 {
+		dir.addLeaf("subnetmask", networkInterface.Subnetmask.String())
+	}
+
+	return dir
+}
+
+func newProjectTree(project *compute.Project) *metadataNode {
+	dir := newMetadataDir()
+	dir.addDir("attributes", newAttributesTree(project.Attributes))
+	dir.addLeaf("numeric-project-id", project.NumericID)
+	dir.addLeaf("project-id", project.ID)
+	return dir
+}
+
+func newAttributesTree(attributes map[string]string) *metadataNode {
+	dir := newMetadataDir()
+	dir.rawKeys = true
+
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		// attribute values may legitimately be empty
+		dir.children = append(dir.children, metadataEntry{name: k, node: &metadataNode{value: attributes[k]}})
+	}
+
+	return dir
+}
+
+func defaultString(s string, d string) string {
+	if s == "" {
+		return d
+	}
+	return s
+}
+
+func ipv4String(addr model.IPv4) string {
+	if len(addr) == 0 {
+		return ""
+	}
+	return addr.String()
+}
+
+func ipv4Lines(addrs []model.IPv4) lines {
+	ret := make(lines, 0, len(addrs))
+	for _, addr := range addrs {
+		ret = append(ret, addr.String())
+	}
+	return ret
+}
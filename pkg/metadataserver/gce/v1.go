@@ -0,0 +1,328 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gce
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/route"
+	"github.com/amari/cloud-metadata-server/pkg/models/googleapis/compute/v1"
+	"go.uber.org/zap"
+
+	"github.com/amari/cloud-metadata-server/pkg/store"
+	"github.com/gorilla/mux"
+)
+
+const TypeURIV1 = compute.TypeURI
+
+const metadataFlavorHeaderV1 = "Metadata-Flavor"
+
+var (
+	errBadAltV1           = errors.New("Bad alt")
+	errMovedPermanentlyV1 = errors.New("Moved permanently")
+)
+
+type EndpointV1 struct {
+	*core.Server
+	*httpEndpointV1
+
+	router *mux.Router
+}
+
+// Store implements `Endpoint`
+func (e *EndpointV1) Store() store.Store {
+	return e.httpEndpointV1.store
+}
+
+// Routes implements `HTTPEndpoint`
+func (e *EndpointV1) Routes() []route.Route {
+	return []route.Route{
+		{PathPrefix: "/computeMetadata"},
+		{PathPrefix: "/", Header: metadataFlavorHeaderV1, HeaderValue: "Google"},
+	}
+}
+
+func (e *EndpointV1) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// check that the header is set!
+	addr := r.Header.Get("X-Remote-Data-Link-Addr")
+	if addr == "" {
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	// the metadata server only answers requests that can't have been
+	// forwarded on behalf of someone else.
+	if r.Header.Get(metadataFlavorHeaderV1) != "Google" {
+		forbiddenHandlerV1(w, r, "Missing Metadata-Flavor:Google header.")
+		return
+	}
+	if _, ok := r.Header["X-Forwarded-For"]; ok {
+		forbiddenHandlerV1(w, r, "Request contains an X-Forwarded-For header.")
+		return
+	}
+
+	e.router.ServeHTTP(w, r)
+}
+
+func NewEndpointV1(core *core.Server, s store.Store) *EndpointV1 {
+	endpoint := &httpEndpointV1{
+		Server: core,
+		store:  s,
+	}
+
+	router := mux.NewRouter()
+
+	// configure router here!
+	router.NotFoundHandler = http.HandlerFunc(notFoundHandlerV1)
+	router.StrictSlash(false)
+
+	router.HandleFunc("/", endpoint.getRootIndex).Methods("GET")
+	router.HandleFunc("/computeMetadata/", endpoint.getVersionIndex).Methods("GET")
+	router.HandleFunc("/computeMetadata/v1", endpoint.getMetadata).Methods("GET")
+	router.HandleFunc("/computeMetadata/v1/{path:.*}", endpoint.getMetadata).Methods("GET")
+
+	return &EndpointV1{
+		core,
+		endpoint,
+		router,
+	}
+}
+
+type httpEndpointV1 struct {
+	*core.Server
+
+	store store.Store
+}
+
+func (e *httpEndpointV1) logger(r *http.Request) *zap.Logger {
+	return e.Log().With(
+		zap.String("datalink_addr", r.Header.Get("X-Remote-Data-Link-Addr")),
+		zap.String("request_path", r.URL.String()),
+		zap.String("schema", TypeURIV1),
+	)
+}
+
+func (e *httpEndpointV1) getInstance(r *http.Request) (*compute.Instance, error) {
+	d, err := e.store.GetDocument(r.Context(), r.Header.Get("X-Remote-Data-Link-Addr"), TypeURIV1)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, ok := d.Contents.(*compute.Instance)
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	return instance, nil
+}
+
+func (e *httpEndpointV1) getRootIndex(w http.ResponseWriter, r *http.Request) {
+	writeV1(w, "application/text", []byte("computeMetadata/\n"))
+}
+
+func (e *httpEndpointV1) getVersionIndex(w http.ResponseWriter, r *http.Request) {
+	writeV1(w, "application/text", []byte("v1/\n"))
+}
+
+func (e *httpEndpointV1) getMetadata(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	query := r.URL.Query()
+
+	waitForChange := query.Get("wait_for_change") == "true"
+	lastETag := query.Get("last_etag")
+	var timeout <-chan time.Time
+	if v := query.Get("timeout_sec"); waitForChange && v != "" {
+		timeoutSec, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || timeoutSec == 0 {
+			l.Error("bad timeout_sec", zap.String("timeout_sec", v))
+			badRequestHandlerV1(w, r)
+			return
+		}
+		timer := time.NewTimer(time.Duration(timeoutSec) * time.Second)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	notifier, _ := e.store.(store.Notifier)
+	if notifier == nil {
+		// nothing would ever wake us, serve what there is now
+		waitForChange = false
+	}
+
+	for {
+		// subscribe before reading so that no change can slip in between
+		var changed <-chan struct{}
+		if waitForChange {
+			changed = notifier.Changed(r.Header.Get("X-Remote-Data-Link-Addr"))
+		}
+
+		body, contentType, err := e.renderMetadata(r)
+		switch err {
+		case nil:
+		case errMovedPermanentlyV1:
+			u := *r.URL
+			u.Path += "/"
+			w.Header().Set(metadataFlavorHeaderV1, "Google")
+			http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+			return
+		case errBadAltV1:
+			l.Error("bad request", zap.NamedError("error", err))
+			badRequestHandlerV1(w, r)
+			return
+		default:
+			l.Error("document not found", zap.NamedError("error", err))
+			notFoundHandlerV1(w, r)
+			return
+		}
+
+		etag := etagV1(body)
+
+		if !waitForChange || (lastETag != "" && lastETag != etag) {
+			w.Header().Set("ETag", etag)
+			writeV1(w, contentType, body)
+			l.Info("", zap.Int("status", 200))
+			return
+		}
+
+		// without a last_etag we wait for a change from what the guest
+		// would have seen right now.
+		lastETag = etag
+
+		select {
+		case <-changed:
+		case <-timeout:
+			w.Header().Set("ETag", etag)
+			writeV1(w, contentType, body)
+			l.Info("", zap.Int("status", 200))
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// renderMetadata resolves the request against the caller's document.
+func (e *httpEndpointV1) renderMetadata(r *http.Request) ([]byte, string, error) {
+	instance, err := e.getInstance(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	node, ok := newRootTree(instance).lookup(mux.Vars(r)["path"])
+	if !ok {
+		return nil, "", store.ErrNotFound
+	}
+
+	query := r.URL.Query()
+	recursive := query.Get("recursive") == "true"
+	trailingSlash := strings.HasSuffix(r.URL.Path, "/")
+
+	if !node.isDir && trailingSlash {
+		return nil, "", store.ErrNotFound
+	}
+	if node.isDir && !recursive && !trailingSlash {
+		return nil, "", errMovedPermanentlyV1
+	}
+
+	return renderV1(node, recursive, query.Get("alt"))
+}
+
+// renderV1 serializes node the way the GCE metadata server does: directory
+// listings and leaves default to text, recursive listings default to JSON.
+func renderV1(node *metadataNode, recursive bool, alt string) ([]byte, string, error) {
+	if alt == "" {
+		if recursive && node.isDir {
+			alt = "json"
+		} else {
+			alt = "text"
+		}
+	}
+
+	switch alt {
+	case "json":
+		var v interface{}
+		if node.isDir && !recursive {
+			v = node.names()
+		} else {
+			v = node.jsonValue()
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, "", err
+		}
+		return data, "application/json", nil
+	case "text":
+		var s string
+		switch {
+		case !node.isDir:
+			s = node.text()
+		case recursive:
+			var out []string
+			node.flatten("", &out)
+			s = strings.Join(out, "\n") + "\n"
+		default:
+			s = strings.Join(node.names(), "\n") + "\n"
+		}
+		return []byte(s), "application/text", nil
+	default:
+		return nil, "", errBadAltV1
+	}
+}
+
+// etagV1 derives an ETag from the content of a response.
+func etagV1(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:8])
+}
+
+func writeV1(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set(metadataFlavorHeaderV1, "Google")
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func badRequestHandlerV1(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(metadataFlavorHeaderV1, "Google")
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusBadRequest)
+	fmt.Fprint(w, "Bad Request")
+}
+
+func forbiddenHandlerV1(w http.ResponseWriter, r *http.Request, reason string) {
+	w.Header().Set(metadataFlavorHeaderV1, "Google")
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusForbidden)
+	fmt.Fprint(w, reason)
+}
+
+func notFoundHandlerV1(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(metadataFlavorHeaderV1, "Google")
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprint(w, "Not Found")
+}
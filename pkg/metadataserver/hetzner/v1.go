@@ -0,0 +1,343 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hetzner
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/route"
+	"github.com/amari/cloud-metadata-server/pkg/models/hetzner/v1"
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/amari/cloud-metadata-server/pkg/store"
+	"github.com/gorilla/mux"
+)
+
+const TypeURIV1 = hetzner.TypeURI
+
+type EndpointV1 struct {
+	*core.Server
+	*httpEndpointV1
+
+	router *mux.Router
+}
+
+// Store implements `Endpoint`
+func (e *EndpointV1) Store() store.Store {
+	return e.httpEndpointV1.store
+}
+
+// Routes implements `HTTPEndpoint`
+func (e *EndpointV1) Routes() []route.Route {
+	return []route.Route{
+		{PathPrefix: "/hetzner/v1"},
+	}
+}
+
+func (e *EndpointV1) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// check that the header is set!
+	addr := r.Header.Get("X-Remote-Data-Link-Addr")
+	if addr == "" {
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	e.router.ServeHTTP(w, r)
+}
+
+func NewEndpointV1(core *core.Server, s store.Store) *EndpointV1 {
+	endpoint := &httpEndpointV1{
+		Server: core,
+		store:  s,
+	}
+
+	router := mux.NewRouter()
+
+	// configure router here!
+	router.NotFoundHandler = http.HandlerFunc(notFoundHandlerV1)
+	router.StrictSlash(false)
+
+	router.HandleFunc("/hetzner/v1/metadata", endpoint.getMetadata).Methods("GET")
+	router.HandleFunc("/hetzner/v1/metadata/private-networks", endpoint.getPrivateNetworks).Methods("GET")
+	router.HandleFunc("/hetzner/v1/metadata/{key}", endpoint.getMetadataKey).Methods("GET")
+	router.HandleFunc("/hetzner/v1/userdata", endpoint.getUserData).Methods("GET")
+
+	return &EndpointV1{
+		core,
+		endpoint,
+		router,
+	}
+}
+
+type httpEndpointV1 struct {
+	*core.Server
+
+	store store.Store
+}
+
+func (e *httpEndpointV1) logger(r *http.Request) *zap.Logger {
+	return e.Log().With(
+		zap.String("datalink_addr", r.Header.Get("X-Remote-Data-Link-Addr")),
+		zap.String("request_path", r.URL.String()),
+		zap.String("schema", TypeURIV1),
+	)
+}
+
+func (e *httpEndpointV1) getServer(r *http.Request) (*hetzner.Server, error) {
+	d, err := e.store.GetDocument(r.Context(), r.Header.Get("X-Remote-Data-Link-Addr"), TypeURIV1)
+	if err != nil {
+		return nil, err
+	}
+
+	server, ok := d.Contents.(*hetzner.Server)
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	return server, nil
+}
+
+type metadataV1 struct {
+	AvailabilityZone string          `yaml:"availability-zone"`
+	Hostname         string          `yaml:"hostname"`
+	InstanceID       uint64          `yaml:"instance-id"`
+	LocalIPv4        string          `yaml:"local-ipv4"`
+	NetworkConfig    networkConfigV1 `yaml:"network-config"`
+	PublicIPv4       string          `yaml:"public-ipv4"`
+	PublicKeys       []string        `yaml:"public-keys"`
+	Region           string          `yaml:"region"`
+	VendorData       string          `yaml:"vendor_data"`
+}
+
+// networkConfigV1 is a cloud-init network configuration (version 1).
+type networkConfigV1 struct {
+	Config  []networkConfigEntryV1 `yaml:"config"`
+	Version int                    `yaml:"version"`
+}
+
+type networkConfigEntryV1 struct {
+	MacAddress string     `yaml:"mac_address"`
+	Name       string     `yaml:"name"`
+	Subnets    []subnetV1 `yaml:"subnets"`
+	Type       string     `yaml:"type"`
+}
+
+type subnetV1 struct {
+	Address string `yaml:"address,omitempty"`
+	Gateway string `yaml:"gateway,omitempty"`
+	IPv4    bool   `yaml:"ipv4,omitempty"`
+	IPv6    bool   `yaml:"ipv6,omitempty"`
+	Type    string `yaml:"type"`
+}
+
+type privateNetworkV1 struct {
+	IP           string   `yaml:"ip"`
+	AliasIPs     []string `yaml:"alias_ips"`
+	InterfaceNum uint     `yaml:"interface_num"`
+	MacAddress   string   `yaml:"mac_address"`
+	NetworkID    uint64   `yaml:"network_id"`
+	NetworkName  string   `yaml:"network_name"`
+	Network      string   `yaml:"network"`
+	Subnet       string   `yaml:"subnet"`
+	Gateway      string   `yaml:"gateway"`
+}
+
+func newMetadataV1(server *hetzner.Server) *metadataV1 {
+	ret := &metadataV1{
+		AvailabilityZone: server.AvailabilityZone,
+		Hostname:         server.Hostname,
+		InstanceID:       server.ID,
+		NetworkConfig: networkConfigV1{
+			Config:  []networkConfigEntryV1{},
+			Version: 1,
+		},
+		PublicIPv4: ipv4String(server.PublicIPv4),
+		PublicKeys: server.PublicKeys,
+		Region:     server.Region,
+		VendorData: string(server.VendorData),
+	}
+	if ret.PublicKeys == nil {
+		ret.PublicKeys = []string{}
+	}
+
+	for i, networkInterface := range server.NetworkInterfaces {
+		entry := networkConfigEntryV1{
+			MacAddress: networkInterface.Mac.HumanReadableString(),
+			Name:       networkInterface.Name,
+			Subnets: []subnetV1{
+				{IPv4: true, Type: "dhcp"},
+			},
+			Type: "physical",
+		}
+		if entry.Name == "" {
+			entry.Name = fmt.Sprintf("eth%d", i)
+		}
+		if networkInterface.IPv6 != "" {
+			entry.Subnets = append(entry.Subnets, subnetV1{
+				Address: networkInterface.IPv6,
+				Gateway: networkInterface.IPv6Gateway,
+				IPv6:    true,
+				Type:    "static",
+			})
+		}
+		ret.NetworkConfig.Config = append(ret.NetworkConfig.Config, entry)
+	}
+
+	return ret
+}
+
+func newPrivateNetworksV1(server *hetzner.Server) []privateNetworkV1 {
+	ret := make([]privateNetworkV1, 0, len(server.PrivateNetworks))
+
+	for _, privateNetwork := range server.PrivateNetworks {
+		aliasIPs := make([]string, 0, len(privateNetwork.AliasIPs))
+		for _, ip := range privateNetwork.AliasIPs {
+			aliasIPs = append(aliasIPs, ip.String())
+		}
+		ret = append(ret, privateNetworkV1{
+			IP:           ipv4String(privateNetwork.IP),
+			AliasIPs:     aliasIPs,
+			InterfaceNum: privateNetwork.InterfaceNum,
+			MacAddress:   privateNetwork.Mac.HumanReadableString(),
+			NetworkID:    privateNetwork.NetworkID,
+			NetworkName:  privateNetwork.NetworkName,
+			Network:      privateNetwork.Network,
+			Subnet:       privateNetwork.Subnet,
+			Gateway:      ipv4String(privateNetwork.Gateway),
+		})
+	}
+
+	return ret
+}
+
+func (e *httpEndpointV1) getMetadata(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	server, err := e.getServer(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	e.writeYAML(w, r, newMetadataV1(server))
+}
+
+// getMetadataKey serves a single key of the metadata document: scalars as
+// text, anything else as YAML.
+func (e *httpEndpointV1) getMetadataKey(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	server, err := e.getServer(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	var node yaml.Node
+	if err := node.Encode(newMetadataV1(server)); err != nil {
+		l.Error("failed to encode document", zap.NamedError("error", err))
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	key := mux.Vars(r)["key"]
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != key {
+			continue
+		}
+
+		value := node.Content[i+1]
+		if value.Kind == yaml.ScalarNode {
+			writeV1(w, []byte(value.Value))
+			l.Info("", zap.Int("status", 200))
+		} else {
+			e.writeYAML(w, r, value)
+		}
+		return
+	}
+
+	l.Error("bad attribute")
+	notFoundHandlerV1(w, r)
+}
+
+func (e *httpEndpointV1) getPrivateNetworks(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	server, err := e.getServer(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	e.writeYAML(w, r, newPrivateNetworksV1(server))
+}
+
+func (e *httpEndpointV1) getUserData(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	server, err := e.getServer(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	writeV1(w, []byte(server.UserData))
+
+	l.Info("", zap.Int("status", 200))
+}
+
+func (e *httpEndpointV1) writeYAML(w http.ResponseWriter, r *http.Request, v interface{}) {
+	l := e.logger(r)
+
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		l.Error("failed to encode document", zap.NamedError("error", err))
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	writeV1(w, data)
+
+	l.Info("", zap.Int("status", 200))
+}
+
+func ipv4String(addr model.IPv4) string {
+	if len(addr) == 0 {
+		return ""
+	}
+	return addr.String()
+}
+
+func writeV1(w http.ResponseWriter, body []byte) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func notFoundHandlerV1(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprint(w, "Not Found")
+}
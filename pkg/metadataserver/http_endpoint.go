@@ -16,10 +16,17 @@ limitations under the License.
 
 package metadataserver
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/route"
+)
 
 type HTTPEndpoint interface {
 	Endpoint
 
 	http.Handler
+
+	// Routes lists the request shapes the endpoint owns.
+	Routes() []route.Route
 }
@@ -0,0 +1,462 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package linode
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amari/cloud-metadata-server/internal/pkg/jsontree"
+	"github.com/amari/cloud-metadata-server/internal/pkg/token"
+	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/route"
+	"github.com/amari/cloud-metadata-server/pkg/models/linode/v1"
+	"go.uber.org/zap"
+
+	"github.com/amari/cloud-metadata-server/pkg/store"
+	"github.com/gorilla/mux"
+)
+
+const TypeURIV1 = linode.TypeURI
+
+const (
+	tokenHeaderV1        = "Metadata-Token"
+	tokenExpiryHeaderV1  = "Metadata-Token-Expiry-Seconds"
+	defaultTokenExpiryV1 = 3600
+	maxTokenExpiryV1     = 86400
+)
+
+type EndpointV1 struct {
+	*core.Server
+	*httpEndpointV1
+
+	router *mux.Router
+}
+
+// Store implements `Endpoint`
+func (e *EndpointV1) Store() store.Store {
+	return e.httpEndpointV1.store
+}
+
+// Routes implements `HTTPEndpoint`
+func (e *EndpointV1) Routes() []route.Route {
+	return []route.Route{
+		{PathPrefix: "/v1/token"},
+		{PathPrefix: "/v1/instance"},
+		{PathPrefix: "/v1/network"},
+		{PathPrefix: "/v1/ssh-keys"},
+		{PathPrefix: "/v1/user-data"},
+	}
+}
+
+func (e *EndpointV1) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// check that the header is set!
+	addr := r.Header.Get("X-Remote-Data-Link-Addr")
+	if addr == "" {
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	e.router.ServeHTTP(w, r)
+}
+
+func NewEndpointV1(core *core.Server, s store.Store) *EndpointV1 {
+	endpoint := &httpEndpointV1{
+		Server: core,
+		store:  s,
+		tokens: token.NewStore(),
+	}
+
+	router := mux.NewRouter()
+
+	// configure router here!
+	router.NotFoundHandler = http.HandlerFunc(notFoundHandlerV1)
+	router.StrictSlash(false)
+
+	router.HandleFunc("/v1/token", endpoint.putToken).Methods("PUT")
+	router.HandleFunc("/v1/instance", endpoint.authorize(endpoint.getInstanceMetadata)).Methods("GET")
+	router.HandleFunc("/v1/network", endpoint.authorize(endpoint.getNetwork)).Methods("GET")
+	router.HandleFunc("/v1/ssh-keys", endpoint.authorize(endpoint.getSSHKeys)).Methods("GET")
+	router.HandleFunc("/v1/user-data", endpoint.authorize(endpoint.getUserData)).Methods("GET")
+
+	return &EndpointV1{
+		core,
+		endpoint,
+		router,
+	}
+}
+
+type httpEndpointV1 struct {
+	*core.Server
+
+	store  store.Store
+	tokens *token.Store
+}
+
+func (e *httpEndpointV1) logger(r *http.Request) *zap.Logger {
+	return e.Log().With(
+		zap.String("datalink_addr", r.Header.Get("X-Remote-Data-Link-Addr")),
+		zap.String("request_path", r.URL.String()),
+		zap.String("schema", TypeURIV1),
+	)
+}
+
+func (e *httpEndpointV1) getInstance(r *http.Request) (*linode.Instance, error) {
+	d, err := e.store.GetDocument(r.Context(), r.Header.Get("X-Remote-Data-Link-Addr"), TypeURIV1)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, ok := d.Contents.(*linode.Instance)
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	return instance, nil
+}
+
+// putToken starts a session for the caller.
+func (e *httpEndpointV1) putToken(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	if _, err := e.getInstance(r); err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	expiry := uint64(defaultTokenExpiryV1)
+	if v := r.Header.Get(tokenExpiryHeaderV1); v != "" {
+		var err error
+		expiry, err = strconv.ParseUint(v, 10, 32)
+		if err != nil || expiry == 0 || expiry > maxTokenExpiryV1 {
+			l.Error("bad token expiry", zap.String("expiry", v))
+			writeErrorV1(w, http.StatusBadRequest, "Invalid "+tokenExpiryHeaderV1)
+			return
+		}
+	}
+
+	t, err := e.tokens.Issue(r.Header.Get("X-Remote-Data-Link-Addr"), time.Duration(expiry)*time.Second)
+	if err != nil {
+		l.Error("failed to issue token", zap.NamedError("error", err))
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	if acceptsJSON(r) {
+		writeJSONV1(w, []string{t})
+	} else {
+		writeV1(w, "text/plain", []byte(t))
+	}
+
+	l.Info("", zap.Int("status", 200))
+}
+
+// authorize checks the session token before calling next.
+func (e *httpEndpointV1) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := e.logger(r)
+
+		if !e.tokens.Validate(r.Header.Get(tokenHeaderV1), r.Header.Get("X-Remote-Data-Link-Addr")) {
+			l.Error("invalid session token")
+			writeErrorV1(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+type instanceV1 struct {
+	Backups  backupsV1 `json:"backups"`
+	HostUUID string    `json:"host_uuid"`
+	ID       uint64    `json:"id"`
+	Label    string    `json:"label"`
+	Region   string    `json:"region"`
+	Specs    specsV1   `json:"specs"`
+	Tags     []string  `json:"tags"`
+	Type     string    `json:"type"`
+}
+
+type backupsV1 struct {
+	Enabled bool    `json:"enabled"`
+	Status  *string `json:"status"`
+}
+
+type specsV1 struct {
+	Disk     uint `json:"disk"`
+	GPUs     uint `json:"gpus"`
+	Memory   uint `json:"memory"`
+	Transfer uint `json:"transfer"`
+	VCPUs    uint `json:"vcpus"`
+}
+
+type networkV1 struct {
+	Interfaces []interfaceV1 `json:"interfaces"`
+	IPv4       ipv4V1        `json:"ipv4"`
+	IPv6       ipv6V1        `json:"ipv6"`
+}
+
+type interfaceV1 struct {
+	IPAMAddress *string `json:"ipam_address"`
+	Label       *string `json:"label"`
+	Purpose     string  `json:"purpose"`
+}
+
+type ipv4V1 struct {
+	Private []string `json:"private"`
+	Public  []string `json:"public"`
+	Shared  []string `json:"shared"`
+}
+
+type ipv6V1 struct {
+	LinkLocal    string   `json:"link_local"`
+	Ranges       []string `json:"ranges"`
+	SharedRanges []string `json:"shared_ranges"`
+	SLAAC        string   `json:"slaac"`
+}
+
+type sshKeysV1 struct {
+	Users map[string][]string `json:"users"`
+}
+
+func (e *httpEndpointV1) getInstanceMetadata(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	m := &instanceV1{
+		Backups: backupsV1{
+			Enabled: instance.Backups.Enabled,
+		},
+		HostUUID: instance.HostUUID,
+		ID:       instance.ID,
+		Label:    instance.Label,
+		Region:   instance.Region,
+		Specs: specsV1{
+			Disk:     instance.Specs.Disk,
+			GPUs:     instance.Specs.GPUs,
+			Memory:   instance.Specs.Memory,
+			Transfer: instance.Specs.Transfer,
+			VCPUs:    instance.Specs.VCPUs,
+		},
+		Tags: nonNilStrings(instance.Tags),
+		Type: instance.Type,
+	}
+	if instance.Backups.Status != "" {
+		m.Backups.Status = &instance.Backups.Status
+	}
+
+	e.writeDocument(w, r, m)
+}
+
+func (e *httpEndpointV1) getNetwork(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	m := &networkV1{
+		Interfaces: []interfaceV1{},
+		IPv4: ipv4V1{
+			Private: nonNilStrings(instance.IPv4.Private),
+			Public:  nonNilStrings(instance.IPv4.Public),
+			Shared:  nonNilStrings(instance.IPv4.Shared),
+		},
+		IPv6: ipv6V1{
+			LinkLocal:    instance.IPv6.LinkLocal,
+			Ranges:       nonNilStrings(instance.IPv6.Ranges),
+			SharedRanges: nonNilStrings(instance.IPv6.SharedRanges),
+			SLAAC:        instance.IPv6.SLAAC,
+		},
+	}
+	for i := range instance.NetworkInterfaces {
+		networkInterface := &instance.NetworkInterfaces[i]
+		n := interfaceV1{
+			Purpose: networkInterface.Purpose,
+		}
+		if n.Purpose == "" {
+			n.Purpose = "public"
+		}
+		if networkInterface.Label != "" {
+			n.Label = &networkInterface.Label
+		}
+		if networkInterface.IPAMAddress != "" {
+			n.IPAMAddress = &networkInterface.IPAMAddress
+		}
+		m.Interfaces = append(m.Interfaces, n)
+	}
+
+	e.writeDocument(w, r, m)
+}
+
+func (e *httpEndpointV1) getSSHKeys(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	m := &sshKeysV1{
+		Users: instance.SSHKeys,
+	}
+	if m.Users == nil {
+		m.Users = map[string][]string{}
+	}
+
+	e.writeDocument(w, r, m)
+}
+
+// getUserData serves the user data base64 encoded, like Linode does.
+func (e *httpEndpointV1) getUserData(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	writeV1(w, "text/plain", []byte(base64.StdEncoding.EncodeToString([]byte(instance.UserData))))
+
+	l.Info("", zap.Int("status", 200))
+}
+
+// writeDocument writes v as JSON if the caller accepts it, otherwise as
+// "key: value" lines with dotted keys.
+func (e *httpEndpointV1) writeDocument(w http.ResponseWriter, r *http.Request, v interface{}) {
+	l := e.logger(r)
+
+	if acceptsJSON(r) {
+		writeJSONV1(w, v)
+		l.Info("", zap.Int("status", 200))
+		return
+	}
+
+	tree, err := jsontree.FromValue(v)
+	if err != nil {
+		l.Error("failed to encode document", zap.NamedError("error", err))
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	var lines []string
+	flattenV1("", tree, &lines)
+	writeV1(w, "text/plain", []byte(strings.Join(lines, "\n")))
+
+	l.Info("", zap.Int("status", 200))
+}
+
+// flattenV1 renders objects with dotted keys and lists of leaves as space
+// separated values.
+func flattenV1(prefix string, v interface{}, out *[]string) {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(node))
+		for k := range node {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if prefix != "" {
+				flattenV1(prefix+"."+k, node[k], out)
+			} else {
+				flattenV1(k, node[k], out)
+			}
+		}
+	case []interface{}:
+		values := make([]string, 0, len(node))
+		for i, child := range node {
+			if !jsontree.IsLeaf(child) {
+				flattenV1(prefix+"."+strconv.Itoa(i), child, out)
+				continue
+			}
+			values = append(values, jsontree.Text(child))
+		}
+		if len(values) > 0 || len(node) == 0 {
+			*out = append(*out, prefix+": "+strings.Join(values, " "))
+		}
+	default:
+		*out = append(*out, prefix+": "+jsontree.Text(node))
+	}
+}
+
+func acceptsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func writeV1(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func writeJSONV1(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	writeV1(w, "application/json", data)
+}
+
+type errorV1 struct {
+	Reason string `json:"reason"`
+}
+
+// writeErrorV1 writes an error body the way the Linode API does.
+func writeErrorV1(w http.ResponseWriter, status int, reason string) {
+	data, _ := json.Marshal(map[string][]errorV1{
+		"errors": {{Reason: reason}},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func notFoundHandlerV1(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprint(w, "Not Found")
+}
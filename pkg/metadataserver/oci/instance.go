@@ -0,0 +1,178 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"encoding/base64"
+	"strings"
+
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+	"github.com/amari/cloud-metadata-server/pkg/models/oraclecloud/v2"
+)
+
+// The JSON documents served by IMDS.
+
+type instanceV2 struct {
+	AvailabilityDomain  string                       `json:"availabilityDomain"`
+	FaultDomain         string                       `json:"faultDomain,omitempty"`
+	CompartmentID       string                       `json:"compartmentId"`
+	DisplayName         string                       `json:"displayName"`
+	Hostname            string                       `json:"hostname"`
+	ID                  string                       `json:"id"`
+	Image               string                       `json:"image"`
+	Metadata            map[string]string            `json:"metadata"`
+	Region              string                       `json:"region"`
+	CanonicalRegionName string                       `json:"canonicalRegionName"`
+	OCIAdName           string                       `json:"ociAdName,omitempty"`
+	RegionInfo          *regionInfoV2                `json:"regionInfo,omitempty"`
+	Shape               string                       `json:"shape"`
+	ShapeConfig         *shapeConfigV2               `json:"shapeConfig,omitempty"`
+	State               string                       `json:"state"`
+	TimeCreated         int64                        `json:"timeCreated"`
+	FreeformTags        map[string]string            `json:"freeformTags,omitempty"`
+	DefinedTags         map[string]map[string]string `json:"definedTags,omitempty"`
+}
+
+type regionInfoV2 struct {
+	RealmKey             string `json:"realmKey"`
+	RealmDomainComponent string `json:"realmDomainComponent"`
+	RegionKey            string `json:"regionKey"`
+	RegionIdentifier     string `json:"regionIdentifier"`
+}
+
+type shapeConfigV2 struct {
+	OCPUs                     float64 `json:"ocpus"`
+	MemoryInGBs               float64 `json:"memoryInGBs"`
+	NetworkingBandwidthInGbps float64 `json:"networkingBandwidthInGbps,omitempty"`
+	MaxVNICAttachments        uint    `json:"maxVnicAttachments,omitempty"`
+}
+
+type vnicV2 struct {
+	VNICID          string `json:"vnicId"`
+	PrivateIP       string `json:"privateIp"`
+	VLANTag         uint   `json:"vlanTag"`
+	MacAddr         string `json:"macAddr"`
+	VirtualRouterIP string `json:"virtualRouterIp"`
+	SubnetCIDRBlock string `json:"subnetCidrBlock"`
+	NICIndex        uint   `json:"nicIndex"`
+}
+
+type identityV2 struct {
+	Cert         string `json:"cert.pem,omitempty"`
+	Key          string `json:"key.pem,omitempty"`
+	Intermediate string `json:"intermediate.pem,omitempty"`
+}
+
+func newInstanceV2(instance *oraclecloud.Instance) *instanceV2 {
+	ret := &instanceV2{
+		AvailabilityDomain:  instance.AvailabilityDomain,
+		FaultDomain:         instance.FaultDomain,
+		CompartmentID:       instance.CompartmentID,
+		DisplayName:         instance.DisplayName,
+		Hostname:            instance.Hostname,
+		ID:                  instance.ID,
+		Image:               instance.Image,
+		Metadata:            map[string]string{},
+		Region:              instance.Region,
+		CanonicalRegionName: instance.CanonicalRegionName,
+		Shape:               instance.Shape,
+		State:               defaultString(instance.State, "Running"),
+		TimeCreated:         instance.TimeCreated,
+		FreeformTags:        instance.FreeformTags,
+		DefinedTags:         instance.DefinedTags,
+	}
+
+	// the availability domain is prefixed with the tenancy's name, e.g.
+	// "Uocm:PHX-AD-1"
+	if i := strings.LastIndex(instance.AvailabilityDomain, ":"); i >= 0 {
+		ret.OCIAdName = strings.ToLower(instance.AvailabilityDomain[i+1:])
+	}
+
+	if instance.RegionInfo != (oraclecloud.RegionInfo{}) {
+		ret.RegionInfo = &regionInfoV2{
+			RealmKey:             instance.RegionInfo.RealmKey,
+			RealmDomainComponent: instance.RegionInfo.RealmDomainComponent,
+			RegionKey:            instance.RegionInfo.RegionKey,
+			RegionIdentifier:     instance.RegionInfo.RegionIdentifier,
+		}
+	}
+
+	if instance.ShapeConfig != (oraclecloud.ShapeConfig{}) {
+		ret.ShapeConfig = &shapeConfigV2{
+			OCPUs:                     instance.ShapeConfig.OCPUs,
+			MemoryInGBs:               instance.ShapeConfig.MemoryInGBs,
+			NetworkingBandwidthInGbps: instance.ShapeConfig.NetworkingBandwidthInGbps,
+			MaxVNICAttachments:        instance.ShapeConfig.MaxVNICAttachments,
+		}
+	}
+
+	for k, v := range instance.Metadata {
+		ret.Metadata[k] = v
+	}
+	if len(instance.SSHAuthorizedKeys) > 0 {
+		ret.Metadata["ssh_authorized_keys"] = strings.Join(instance.SSHAuthorizedKeys, "\n")
+	}
+	if instance.UserData != "" {
+		ret.Metadata["user_data"] = base64.StdEncoding.EncodeToString([]byte(instance.UserData))
+	}
+
+	return ret
+}
+
+func newVNICsV2(instance *oraclecloud.Instance) []vnicV2 {
+	ret := make([]vnicV2, 0, len(instance.VNICs))
+
+	for i, vnic := range instance.VNICs {
+		nicIndex := vnic.NICIndex
+		if nicIndex == 0 {
+			nicIndex = uint(i)
+		}
+		ret = append(ret, vnicV2{
+			VNICID:          vnic.ID,
+			PrivateIP:       ipv4String(vnic.PrivateIP),
+			VLANTag:         vnic.VLANTag,
+			MacAddr:         strings.ToUpper(vnic.Mac.HumanReadableString()),
+			VirtualRouterIP: ipv4String(vnic.VirtualRouterIP),
+			SubnetCIDRBlock: vnic.SubnetCIDRBlock,
+			NICIndex:        nicIndex,
+		})
+	}
+
+	return ret
+}
+
+func newIdentityV2(instance *oraclecloud.Instance) *identityV2 {
+	return &identityV2{
+		Cert:         instance.Identity.Cert,
+		Key:          instance.Identity.Key,
+		Intermediate: instance.Identity.Intermediate,
+	}
+}
+
+func defaultString(s string, d string) string {
+	if s == "" {
+		return d
+	}
+	return s
+}
+
+func ipv4String(addr model.IPv4) string {
+	if len(addr) == 0 {
+		return ""
+	}
+	return addr.String()
+}
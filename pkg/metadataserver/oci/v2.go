@@ -0,0 +1,221 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/amari/cloud-metadata-server/internal/pkg/jsontree"
+	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/route"
+	"github.com/amari/cloud-metadata-server/pkg/models/oraclecloud/v2"
+	"go.uber.org/zap"
+
+	"github.com/amari/cloud-metadata-server/pkg/store"
+	"github.com/gorilla/mux"
+)
+
+const TypeURIV2 = oraclecloud.TypeURI
+
+const authorizationV2 = "Bearer Oracle"
+
+type EndpointV2 struct {
+	*core.Server
+	*httpEndpointV2
+
+	router *mux.Router
+}
+
+// Store implements `Endpoint`
+func (e *EndpointV2) Store() store.Store {
+	return e.httpEndpointV2.store
+}
+
+// Routes implements `HTTPEndpoint`
+func (e *EndpointV2) Routes() []route.Route {
+	return []route.Route{
+		{PathPrefix: "/opc"},
+	}
+}
+
+func (e *EndpointV2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// check that the header is set!
+	addr := r.Header.Get("X-Remote-Data-Link-Addr")
+	if addr == "" {
+		notFoundHandlerV2(w, r)
+		return
+	}
+
+	e.router.ServeHTTP(w, r)
+}
+
+func NewEndpointV2(core *core.Server, s store.Store) *EndpointV2 {
+	endpoint := &httpEndpointV2{
+		Server: core,
+		store:  s,
+	}
+
+	router := mux.NewRouter()
+
+	// configure router here!
+	router.NotFoundHandler = http.HandlerFunc(notFoundHandlerV2)
+	router.StrictSlash(false)
+
+	// v2 requires the authorization header, v1 is served as is for older
+	// images.
+	for _, version := range []string{"v1", "v2"} {
+		handler := endpoint.getMetadata
+		if version == "v2" {
+			handler = endpoint.authorize(handler)
+		}
+		router.HandleFunc("/opc/"+version+"/{category:(?:instance|vnics|identity)}", handler).Methods("GET")
+		router.HandleFunc("/opc/"+version+"/{category:(?:instance|vnics|identity)}/{path:.*}", handler).Methods("GET")
+	}
+
+	return &EndpointV2{
+		core,
+		endpoint,
+		router,
+	}
+}
+
+type httpEndpointV2 struct {
+	*core.Server
+
+	store store.Store
+}
+
+func (e *httpEndpointV2) logger(r *http.Request) *zap.Logger {
+	return e.Log().With(
+		zap.String("datalink_addr", r.Header.Get("X-Remote-Data-Link-Addr")),
+		zap.String("request_path", r.URL.String()),
+		zap.String("schema", TypeURIV2),
+	)
+}
+
+func (e *httpEndpointV2) getInstance(r *http.Request) (*oraclecloud.Instance, error) {
+	d, err := e.store.GetDocument(r.Context(), r.Header.Get("X-Remote-Data-Link-Addr"), TypeURIV2)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, ok := d.Contents.(*oraclecloud.Instance)
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	return instance, nil
+}
+
+// authorize checks the headers IMDSv2 requires before calling next.
+func (e *httpEndpointV2) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := e.logger(r)
+
+		if r.Header.Get("Authorization") != authorizationV2 {
+			l.Error("missing authorization header")
+			unauthorizedHandlerV2(w, r)
+			return
+		}
+
+		// requests must not have been forwarded on behalf of someone else
+		for _, header := range []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Host"} {
+			if _, ok := r.Header[header]; ok {
+				l.Error("refusing forwarded request", zap.String("header", header))
+				forbiddenHandlerV2(w, r)
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+func (e *httpEndpointV2) getMetadata(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV2(w, r)
+		return
+	}
+
+	var v interface{}
+	switch mux.Vars(r)["category"] {
+	case "instance":
+		v = newInstanceV2(instance)
+	case "vnics":
+		v = newVNICsV2(instance)
+	case "identity":
+		v = newIdentityV2(instance)
+	}
+
+	tree, err := jsontree.FromValue(v)
+	if err != nil {
+		l.Error("failed to encode document", zap.NamedError("error", err))
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	node, ok := jsontree.Lookup(tree, mux.Vars(r)["path"])
+	if !ok {
+		l.Error("bad attribute")
+		notFoundHandlerV2(w, r)
+		return
+	}
+
+	if jsontree.IsLeaf(node) {
+		writeV2(w, "text/plain", []byte(jsontree.Text(node)))
+	} else {
+		data, err := json.MarshalIndent(node, "", "  ")
+		if err != nil {
+			l.Error("failed to encode document", zap.NamedError("error", err))
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		writeV2(w, "application/json", data)
+	}
+
+	l.Info("", zap.Int("status", 200))
+}
+
+func writeV2(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func unauthorizedHandlerV2(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusUnauthorized)
+	fmt.Fprint(w, "Unauthorized")
+}
+
+func forbiddenHandlerV2(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusForbidden)
+	fmt.Fprint(w, "Forbidden")
+}
+
+func notFoundHandlerV2(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprint(w, "Not Found")
+}
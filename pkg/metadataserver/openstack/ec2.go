@@ -0,0 +1,81 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"net"
+
+	ec2v1 "github.com/amari/cloud-metadata-server/pkg/models/amazonaws/ec2/v1"
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+	"github.com/amari/cloud-metadata-server/pkg/models/openstack/v1"
+)
+
+// ec2InstanceV1 projects an OpenStack instance onto the subset of the EC2
+// metadata that nova serves from its EC2 compatible API.
+func ec2InstanceV1(instance *openstack.Instance) *ec2v1.Instance {
+	ret := &ec2v1.Instance{
+		ID:            instance.UUID,
+		ImageID:       instance.ImageID,
+		LaunchIndex:   instance.LaunchIndex,
+		InstanceType:  instance.Flavor,
+		Hostname:      instance.Hostname,
+		LocalHostname: instance.Hostname,
+		Placement: ec2v1.Placement{
+			AvailabilityZone: instance.AvailabilityZone,
+		},
+		UserData: ec2v1.UserData(instance.UserData),
+	}
+
+	for _, publicKey := range instance.PublicKeys {
+		ret.PublicKeys = append(ret.PublicKeys, ec2v1.PublicKey{
+			Name:       publicKey.Name,
+			OpenSSHKey: publicKey.Data,
+		})
+	}
+
+	for i, link := range instance.NetworkData.Links {
+		networkInterface := ec2v1.NetworkInterface{
+			Mac:           link.EthernetMacAddress,
+			DeviceNumber:  uint(i),
+			InterfaceID:   link.VifID,
+			LocalHostname: instance.Hostname,
+		}
+
+		for _, network := range instance.NetworkData.Networks {
+			if network.Link != link.ID {
+				continue
+			}
+
+			ip := net.ParseIP(network.IPAddress)
+			switch {
+			case ip == nil:
+			case ip.To4() != nil:
+				networkInterface.LocalIPv4s = append(networkInterface.LocalIPv4s, model.IPv4(ip.To4()))
+			default:
+				networkInterface.IPv6s = append(networkInterface.IPv6s, model.IPv6(ip))
+			}
+		}
+
+		if i == 0 && len(networkInterface.LocalIPv4s) > 0 {
+			ret.LocalIPv4 = networkInterface.LocalIPv4s[0]
+		}
+
+		ret.NetworkInterfaces = append(ret.NetworkInterfaces, networkInterface)
+	}
+
+	return ret
+}
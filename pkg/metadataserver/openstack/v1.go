@@ -0,0 +1,369 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/ec2"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/route"
+	ec2v1 "github.com/amari/cloud-metadata-server/pkg/models/amazonaws/ec2/v1"
+	"github.com/amari/cloud-metadata-server/pkg/models/openstack/v1"
+	"go.uber.org/zap"
+
+	"github.com/amari/cloud-metadata-server/pkg/store"
+	"github.com/gorilla/mux"
+)
+
+const TypeURIV1 = openstack.TypeURI
+
+// The OpenStack metadata API versions that are accepted in place of "latest".
+var versionsV1 = [...]string{
+	"2012-08-10",
+	"2013-04-04",
+	"2013-10-17",
+	"2015-10-15",
+	"2016-06-30",
+	"2016-10-06",
+	"2017-02-22",
+	"2018-08-27",
+	"latest",
+}
+
+const versionPatternV1 = "{version:(?:latest|[0-9]{4}-[0-9]{2}-[0-9]{2})}"
+
+// The size, in bytes, of the random_seed handed out in meta_data.json.
+const randomSeedSizeV1 = 512
+
+type EndpointV1 struct {
+	*core.Server
+	*httpEndpointV1
+
+	router *mux.Router
+}
+
+// Store implements `Endpoint`
+func (e *EndpointV1) Store() store.Store {
+	return e.httpEndpointV1.store
+}
+
+// Routes implements `HTTPEndpoint`
+func (e *EndpointV1) Routes() []route.Route {
+	return []route.Route{
+		{PathPrefix: "/openstack"},
+		// the EC2 compatible API
+		{PathPrefix: "/"},
+	}
+}
+
+func (e *EndpointV1) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// check that the header is set!
+	addr := r.Header.Get("X-Remote-Data-Link-Addr")
+	if addr == "" {
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	e.router.ServeHTTP(w, r)
+}
+
+func NewEndpointV1(core *core.Server, s store.Store) *EndpointV1 {
+	endpoint := &httpEndpointV1{
+		Server: core,
+		store:  s,
+	}
+
+	router := mux.NewRouter()
+
+	// configure router here!
+	router.NotFoundHandler = http.HandlerFunc(notFoundHandlerV1)
+	router.StrictSlash(false)
+
+	router.HandleFunc("/openstack", endpoint.getVersionIndex).Methods("GET")
+	router.HandleFunc("/openstack/", endpoint.getVersionIndex).Methods("GET")
+	router.HandleFunc("/openstack/"+versionPatternV1, endpoint.getIndex).Methods("GET")
+	router.HandleFunc("/openstack/"+versionPatternV1+"/", endpoint.getIndex).Methods("GET")
+	router.HandleFunc("/openstack/"+versionPatternV1+"/meta_data.json", endpoint.getMetaData).Methods("GET")
+	router.HandleFunc("/openstack/"+versionPatternV1+"/network_data.json", endpoint.getNetworkData).Methods("GET")
+	router.HandleFunc("/openstack/"+versionPatternV1+"/vendor_data.json", endpoint.getVendorData).Methods("GET")
+	router.HandleFunc("/openstack/"+versionPatternV1+"/vendor_data2.json", endpoint.getVendorData2).Methods("GET")
+	router.HandleFunc("/openstack/"+versionPatternV1+"/user_data", endpoint.getUserData).Methods("GET")
+
+	// everything else is the EC2 compatible API
+	router.PathPrefix("/").Handler(ec2.NewCompatHandler(core, TypeURIV1, endpoint.getEC2Instance))
+
+	return &EndpointV1{
+		core,
+		endpoint,
+		router,
+	}
+}
+
+type httpEndpointV1 struct {
+	*core.Server
+
+	store store.Store
+}
+
+func (e *httpEndpointV1) logger(r *http.Request) *zap.Logger {
+	return e.Log().With(
+		zap.String("datalink_addr", r.Header.Get("X-Remote-Data-Link-Addr")),
+		zap.String("request_path", r.URL.String()),
+		zap.String("schema", TypeURIV1),
+	)
+}
+
+func (e *httpEndpointV1) getInstance(r *http.Request) (*openstack.Instance, error) {
+	d, err := e.store.GetDocument(r.Context(), r.Header.Get("X-Remote-Data-Link-Addr"), TypeURIV1)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, ok := d.Contents.(*openstack.Instance)
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	return instance, nil
+}
+
+func (e *httpEndpointV1) getEC2Instance(r *http.Request) (*ec2v1.Instance, error) {
+	instance, err := e.getInstance(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return ec2InstanceV1(instance), nil
+}
+
+func (e *httpEndpointV1) getVersionIndex(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	if _, err := e.getInstance(r); err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	writeV1(w, "text/plain", []byte(strings.Join(versionsV1[:], "\n")))
+
+	l.Info("", zap.Int("status", 200))
+}
+
+func (e *httpEndpointV1) getIndex(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	index := []string{"meta_data.json", "network_data.json"}
+	if instance.UserData != "" {
+		index = append(index, "user_data")
+	}
+	index = append(index, "vendor_data.json", "vendor_data2.json")
+	writeV1(w, "text/plain", []byte(strings.Join(index, "\n")))
+
+	l.Info("", zap.Int("status", 200))
+}
+
+type metaDataV1 struct {
+	UUID             string            `json:"uuid"`
+	Name             string            `json:"name"`
+	Hostname         string            `json:"hostname"`
+	AvailabilityZone string            `json:"availability_zone"`
+	ProjectID        string            `json:"project_id"`
+	LaunchIndex      uint              `json:"launch_index"`
+	Meta             map[string]string `json:"meta,omitempty"`
+	PublicKeys       map[string]string `json:"public_keys,omitempty"`
+	Keys             []keyV1           `json:"keys,omitempty"`
+	Devices          []interface{}     `json:"devices"`
+	RandomSeed       string            `json:"random_seed"`
+}
+
+type keyV1 struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Data string `json:"data"`
+}
+
+func (e *httpEndpointV1) getMetaData(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	seed := make([]byte, randomSeedSizeV1)
+	if _, err := rand.Read(seed); err != nil {
+		l.Error("failed to generate random seed", zap.NamedError("error", err))
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	m := metaDataV1{
+		UUID:             instance.UUID,
+		Name:             instance.Name,
+		Hostname:         instance.Hostname,
+		AvailabilityZone: instance.AvailabilityZone,
+		ProjectID:        instance.ProjectID,
+		LaunchIndex:      instance.LaunchIndex,
+		Meta:             instance.Meta,
+		Devices:          []interface{}{},
+		RandomSeed:       base64.StdEncoding.EncodeToString(seed),
+	}
+	for _, publicKey := range instance.PublicKeys {
+		if m.PublicKeys == nil {
+			m.PublicKeys = map[string]string{}
+		}
+		m.PublicKeys[publicKey.Name] = publicKey.Data
+		m.Keys = append(m.Keys, keyV1{
+			Name: publicKey.Name,
+			Type: defaultString(publicKey.Type, "ssh"),
+			Data: publicKey.Data,
+		})
+	}
+
+	e.writeJSON(w, r, m)
+}
+
+func (e *httpEndpointV1) getNetworkData(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	networkData := instance.NetworkData
+	networkData.Links = make([]openstack.Link, len(instance.NetworkData.Links))
+	for i, link := range instance.NetworkData.Links {
+		link.Type = defaultString(link.Type, "phy")
+		networkData.Links[i] = link
+	}
+	if networkData.Networks == nil {
+		networkData.Networks = []openstack.Network{}
+	}
+	if networkData.Services == nil {
+		networkData.Services = []openstack.Service{}
+	}
+
+	e.writeJSON(w, r, &networkData)
+}
+
+func (e *httpEndpointV1) getVendorData(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	e.writeJSON(w, r, vendorDataV1(instance.VendorData))
+}
+
+func (e *httpEndpointV1) getVendorData2(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	e.writeJSON(w, r, vendorDataV1(instance.VendorData2))
+}
+
+func (e *httpEndpointV1) getUserData(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	if instance.UserData == "" {
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	writeV1(w, "application/octet-stream", []byte(instance.UserData))
+
+	l.Info("", zap.Int("status", 200))
+}
+
+func (e *httpEndpointV1) writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	l := e.logger(r)
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		l.Error("failed to encode document", zap.NamedError("error", err))
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	writeV1(w, "application/json", data)
+
+	l.Info("", zap.Int("status", 200))
+}
+
+// vendorDataV1 returns an empty object in place of missing vendor data, like
+// nova does.
+func vendorDataV1(vendorData map[string]interface{}) map[string]interface{} {
+	if vendorData == nil {
+		return map[string]interface{}{}
+	}
+	return vendorData
+}
+
+func defaultString(s string, d string) string {
+	if s == "" {
+		return d
+	}
+	return s
+}
+
+func writeV1(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func notFoundHandlerV1(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprint(w, "Not Found")
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package route
+
+import (
+	"net/http"
+	"strings"
+)
+
+// A Route describes a shape of request that an endpoint owns.
+type Route struct {
+	// PathPrefix matches the request path segment by segment: "/v1" matches
+	// "/v1", "/v1/hostname" and "/v1.json" but not "/v10". A prefix ending in
+	// "/" matches everything beneath it.
+	PathPrefix string
+	// Header, when set, must be present on the request. If HeaderValue is also
+	// set the header must have exactly that value.
+	Header      string
+	HeaderValue string
+}
+
+// Match reports whether r has the shape described by the route.
+func (route Route) Match(r *http.Request) bool {
+	if !matchPathPrefix(r.URL.Path, route.PathPrefix) {
+		return false
+	}
+
+	if route.Header == "" {
+		return true
+	}
+	values, ok := r.Header[http.CanonicalHeaderKey(route.Header)]
+	if !ok {
+		return false
+	}
+	if route.HeaderValue == "" {
+		return true
+	}
+	for _, value := range values {
+		if value == route.HeaderValue {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MoreSpecific reports whether route should be tried before other when both
+// match a request. Longer prefixes win over shorter ones, then routes that
+// require a header (and value) win over routes that don't.
+func (route Route) MoreSpecific(other Route) bool {
+	if len(route.PathPrefix) != len(other.PathPrefix) {
+		return len(route.PathPrefix) > len(other.PathPrefix)
+	}
+	if (route.Header != "") != (other.Header != "") {
+		return route.Header != ""
+	}
+
+	return route.HeaderValue != "" && other.HeaderValue == ""
+}
+
+func matchPathPrefix(path string, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	if len(path) == len(prefix) || strings.HasSuffix(prefix, "/") {
+		return true
+	}
+
+	switch path[len(prefix)] {
+	case '/', '.':
+		return true
+	default:
+		return false
+	}
+}
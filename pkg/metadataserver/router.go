@@ -17,8 +17,20 @@ limitations under the License.
 package metadataserver
 
 import (
+	"net/http"
+	"sort"
+
 	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/azure"
 	"github.com/amari/cloud-metadata-server/pkg/metadataserver/digitalocean"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/ec2"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/gce"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/hetzner"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/linode"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/oci"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/openstack"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/route"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/vultr"
 	"github.com/amari/cloud-metadata-server/pkg/store"
 	"go.uber.org/zap"
 )
@@ -26,21 +38,83 @@ import (
 type Router struct {
 	*core.Server
 
-	endpoints map[string]Endpoint
+	// endpoints are kept in registration order, which breaks ties between
+	// endpoints that own the same request shape.
+	endpoints []routerEntry
+}
+
+type routerEntry struct {
+	typeURI  string
+	endpoint HTTPEndpoint
+}
+
+type routerCandidate struct {
+	routerEntry
+
+	route route.Route
 }
 
 func NewRouter(c *core.Server, s store.Store) *Router {
-	return &Router{
+	r := &Router{
 		Server: c,
-		endpoints: map[string]Endpoint{
-			digitalocean.TypeURIV1: digitalocean.NewEndpointV1(c.WithLoggerFields(zap.String("kind", digitalocean.TypeURIV1)), s),
-		},
 	}
+
+	r.add(ec2.TypeURIV1, ec2.NewEndpointV1(c.WithLoggerFields(zap.String("kind", ec2.TypeURIV1)), s))
+	r.add(gce.TypeURIV1, gce.NewEndpointV1(c.WithLoggerFields(zap.String("kind", gce.TypeURIV1)), s))
+	r.add(digitalocean.TypeURIV1, digitalocean.NewEndpointV1(c.WithLoggerFields(zap.String("kind", digitalocean.TypeURIV1)), s))
+	r.add(openstack.TypeURIV1, openstack.NewEndpointV1(c.WithLoggerFields(zap.String("kind", openstack.TypeURIV1)), s))
+	r.add(azure.TypeURIV1, azure.NewEndpointV1(c.WithLoggerFields(zap.String("kind", azure.TypeURIV1)), s))
+	r.add(oci.TypeURIV2, oci.NewEndpointV2(c.WithLoggerFields(zap.String("kind", oci.TypeURIV2)), s))
+	r.add(hetzner.TypeURIV1, hetzner.NewEndpointV1(c.WithLoggerFields(zap.String("kind", hetzner.TypeURIV1)), s))
+	r.add(vultr.TypeURIV1, vultr.NewEndpointV1(c.WithLoggerFields(zap.String("kind", vultr.TypeURIV1)), s))
+	r.add(linode.TypeURIV1, linode.NewEndpointV1(c.WithLoggerFields(zap.String("kind", linode.TypeURIV1)), s))
+
+	return r
+}
+
+func (r *Router) add(typeURI string, endpoint HTTPEndpoint) {
+	r.endpoints = append(r.endpoints, routerEntry{
+		typeURI:  typeURI,
+		endpoint: endpoint,
+	})
 }
 
-func (r *Router) Match(typeURI string) Endpoint {
-	if endpoint, ok := r.endpoints[typeURI]; ok {
-		return endpoint
+// Match picks the endpoint that serves req. Endpoints are chosen by the shape
+// of the request first, most specific route first, and then by whether the
+// caller has a document of the endpoint's kind. It returns nil if no endpoint
+// owns the request or the caller has no document of a kind that does.
+func (r *Router) Match(req *http.Request, typeURIs []string) (HTTPEndpoint, string) {
+	candidates := make([]routerCandidate, 0, len(r.endpoints))
+	for _, entry := range r.endpoints {
+		var best *route.Route
+		for _, rt := range entry.endpoint.Routes() {
+			if !rt.Match(req) {
+				continue
+			}
+			if best == nil || rt.MoreSpecific(*best) {
+				rt := rt
+				best = &rt
+			}
+		}
+		if best != nil {
+			candidates = append(candidates, routerCandidate{
+				routerEntry: entry,
+				route:       *best,
+			})
+		}
 	}
-	return nil
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].route.MoreSpecific(candidates[j].route)
+	})
+
+	for _, candidate := range candidates {
+		for _, typeURI := range typeURIs {
+			if typeURI == candidate.typeURI {
+				return candidate.endpoint, candidate.typeURI
+			}
+		}
+	}
+
+	return nil, ""
 }
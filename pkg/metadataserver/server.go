@@ -17,12 +17,16 @@ limitations under the License.
 package metadataserver
 
 import (
+	"context"
 	"net"
 	"net/http"
-	"time"
+	"strings"
 
 	"github.com/amari/cloud-metadata-server/internal/pkg/arp"
+	"github.com/amari/cloud-metadata-server/internal/pkg/netns"
+	"github.com/amari/cloud-metadata-server/internal/pkg/proxyproto"
 	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/identity"
 	model "github.com/amari/cloud-metadata-server/pkg/models/net"
 	"github.com/amari/cloud-metadata-server/pkg/store"
 	"go.uber.org/zap"
@@ -31,25 +35,70 @@ import (
 type HTTPServer struct {
 	*core.Server
 
-	arpWatcher *arp.Watcher
-	router     *Router
-	store      store.Store
+	identity identity.Resolver
+	proxies  TrustedProxies
+	router   *Router
+	store    store.Store
 }
 
-func NewHTTPServer(c *core.Server, s store.Store, d time.Duration) (*HTTPServer, error) {
-	w, err := arp.NewWatcher(d)
-	if err != nil {
-		return nil, err
-	}
+// TrustedProxies are the proxies allowed to speak for the guests behind them.
+type TrustedProxies struct {
+	CIDRs proxyproto.Trusted
+	// DataLinkAddrHeader, if set, is the header a trusted proxy sends the
+	// guest's hardware address in. Anyone else sending it is refused.
+	DataLinkAddrHeader string
+}
+
+// localIfIndexKey is the context key of the index of the interface a
+// connection arrived on.
+type localIfIndexKey struct{}
+
+// namespaceKey is the context key of the named network namespace a
+// connection arrived in.
+type namespaceKey struct{}
+
+// proxyAddrKey is the context key of the address of the proxy a connection
+// came through, if any.
+type proxyAddrKey struct{}
 
+// NewHTTPServer creates a metadata server that identifies callers with i,
+// or as told by the proxies in p.
+func NewHTTPServer(c *core.Server, s store.Store, i identity.Resolver, p TrustedProxies) *HTTPServer {
 	r := NewRouter(c, s)
 
 	return &HTTPServer{
-		Server:     c.WithLoggerFields(zap.String("endpoint", "http")),
-		arpWatcher: w,
-		router:     r,
-		store:      s,
-	}, nil
+		Server:   c.WithLoggerFields(zap.String("endpoint", "http")),
+		identity: i,
+		proxies:  p,
+		router:   r,
+		store:    s,
+	}
+}
+
+// BaseContext records the network namespace of a listener, to be used as the
+// `http.Server` BaseContext hook.
+func (s *HTTPServer) BaseContext(l net.Listener) context.Context {
+	ctx := context.Background()
+	if nl, ok := l.(*netns.Listener); ok {
+		ctx = context.WithValue(ctx, namespaceKey{}, nl.Namespace)
+	}
+
+	return ctx
+}
+
+// ConnContext records the interface a connection arrived on, to be used as the
+// `http.Server` ConnContext hook.
+func (s *HTTPServer) ConnContext(ctx context.Context, c net.Conn) context.Context {
+	// the guest isn't on any of our interfaces when it's behind a proxy
+	if pc, ok := c.(*proxyproto.Conn); ok {
+		return context.WithValue(ctx, proxyAddrKey{}, pc.ProxyAddr())
+	}
+	if addr, ok := c.LocalAddr().(*net.TCPAddr); ok {
+		namespace, _ := ctx.Value(namespaceKey{}).(string)
+		ctx = context.WithValue(ctx, localIfIndexKey{}, arp.LocalIfIndex(namespace, addr.IP))
+	}
+
+	return ctx
 }
 
 func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -59,38 +108,111 @@ func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
+	// link-local IPv6 callers carry the zone of the interface they came in on
+	zone := ""
+	if i := strings.LastIndexByte(host, '%'); i >= 0 {
+		host, zone = host[:i], host[i+1:]
+	}
 	remoteIP := net.ParseIP(host)
 	if remoteIP == nil {
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
-	addr := s.arpWatcher.GetHardwareAddrForIP4(remoteIP)
-	if addr == nil {
-		s.arpWatcher.ForcePoll()
-		addr = s.arpWatcher.GetHardwareAddrForIP4(remoteIP)
+	// resolvers may only trust what was learned on the interface the request
+	// came in on, in the namespace the listener lives in
+	namespace, _ := r.Context().Value(namespaceKey{}).(string)
+	ifIndex := arp.ZoneToIfIndex(namespace, zone)
+	if ifIndex == 0 {
+		ifIndex, _ = r.Context().Value(localIfIndexKey{}).(int)
 	}
-	if addr == nil {
-		s.Log().Error("data link addr not found", zap.String("remoteAddr", r.RemoteAddr))
-		http.Error(w, "not found", http.StatusNotFound)
+	// only trusted proxies may speak for the guests behind them
+	peerIP := remoteIP
+	if proxyAddr, ok := r.Context().Value(proxyAddrKey{}).(*net.TCPAddr); ok {
+		peerIP = proxyAddr.IP
+	}
+	var addr net.HardwareAddr
+	forwardedAddr := ""
+	if s.proxies.DataLinkAddrHeader != "" {
+		forwardedAddr = r.Header.Get(s.proxies.DataLinkAddrHeader)
+	}
+	if s.proxies.CIDRs.Contains(peerIP) {
+		if clientIP := s.forwardedFor(r); clientIP != nil {
+			remoteIP, ifIndex = clientIP, 0
+		}
+		if forwardedAddr != "" {
+			addr, err = net.ParseMAC(forwardedAddr)
+			if err != nil {
+				s.Log().Error("invalid forwarded data link addr", zap.String("remoteAddr", r.RemoteAddr), zap.String("dataLinkAddr", forwardedAddr))
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+		}
+	} else if forwardedAddr != "" {
+		s.Log().Warn("forwarded data link addr from untrusted peer", zap.String("remoteAddr", r.RemoteAddr), zap.String("peerIP", peerIP.String()))
+		http.Error(w, "forbidden", http.StatusForbidden)
 		return
 	}
-	canonicalAddr := model.MACAddr(addr).CanonicalString()
+	if addr == nil {
+		addr, err = s.identity.Resolve(r.Context(), identity.Caller{
+			IP:        remoteIP,
+			IfIndex:   ifIndex,
+			Namespace: namespace,
+		})
+		if err != nil {
+			s.Log().Error("data link addr not found", zap.String("remoteAddr", r.RemoteAddr), zap.String("remoteIP", remoteIP.String()), zap.Int("interfaceIndex", ifIndex), zap.String("namespace", namespace))
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+	}
+	// guests in different namespaces may share addresses, but not documents
+	canonicalAddr := store.Key(namespace, model.MACAddr(addr).CanonicalString())
 	r.Header.Set("X-Remote-Data-Link-Addr", canonicalAddr)
-	// identify the type uri and serve the request
+	// identify the endpoint by the shape of the request and serve it
 	typeURIs, err := s.store.ListSupportedTypeURIs(r.Context(), canonicalAddr)
 	if err != nil {
 		s.Log().Error("typeURI not found", zap.String("remoteAddr", r.RemoteAddr), zap.String("canonicalRemoteDataLinkAddr", canonicalAddr))
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
-	for _, typeURI := range typeURIs {
-		if endpoint, ok := s.router.Match(typeURI).(HTTPEndpoint); ok && endpoint != nil {
-			endpoint.ServeHTTP(w, r)
-			return
+	endpoint, typeURI := s.router.Match(r, typeURIs)
+	if endpoint == nil {
+		s.Log().Error("no endpoint for request", zap.String("remoteAddr", r.RemoteAddr), zap.String("canonicalRemoteDataLinkAddr", canonicalAddr), zap.String("requestPath", r.URL.Path))
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	s.Log().Debug("matched endpoint", zap.String("canonicalRemoteDataLinkAddr", canonicalAddr), zap.String("requestPath", r.URL.Path), zap.String("kind", typeURI))
+	endpoint.ServeHTTP(w, r)
+}
+
+// forwardedFor returns the client a trusted proxy forwarded r for: the
+// rightmost X-Forwarded-For hop that isn't a trusted proxy itself. The hops to
+// its left were sent by the client and are all that's left of the header, so
+// endpoints see the request as the client sent it.
+func (s *HTTPServer) forwardedFor(r *http.Request) net.IP {
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			return nil
+		}
+		if s.proxies.CIDRs.Contains(ip) {
+			continue
+		}
+
+		if i == 0 {
+			r.Header.Del("X-Forwarded-For")
+		} else {
+			r.Header.Set("X-Forwarded-For", strings.Join(hops[:i], ", "))
 		}
+		return ip
 	}
-	//
-	http.Error(w, "", http.StatusNotFound)
 
-	return
+	return nil
 }
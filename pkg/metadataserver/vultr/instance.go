@@ -0,0 +1,188 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vultr
+
+import (
+	"fmt"
+	"strings"
+
+	ec2v1 "github.com/amari/cloud-metadata-server/pkg/models/amazonaws/ec2/v1"
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+	"github.com/amari/cloud-metadata-server/pkg/models/vultr/v1"
+)
+
+// The JSON document served as `v1.json`.
+
+type instanceV1 struct {
+	Hostname     string        `json:"hostname"`
+	InstanceID   string        `json:"instanceid"`
+	InstanceV2ID string        `json:"instance-v2-id"`
+	Interfaces   []interfaceV1 `json:"interfaces"`
+	PublicKeys   []string      `json:"public-keys"`
+	Region       regionV1      `json:"region"`
+	Tags         []string      `json:"tags"`
+}
+
+type regionV1 struct {
+	RegionCode string `json:"regioncode"`
+}
+
+type interfaceV1 struct {
+	IPv4        *ipv4V1 `json:"ipv4,omitempty"`
+	IPv6        *ipv6V1 `json:"ipv6,omitempty"`
+	Mac         string  `json:"mac"`
+	NetworkType string  `json:"network-type"`
+	NetworkV2ID string  `json:"network-v2-id,omitempty"`
+}
+
+type ipv4V1 struct {
+	Additional []ipv4V1 `json:"additional"`
+	Address    string   `json:"address"`
+	Gateway    string   `json:"gateway,omitempty"`
+	Netmask    string   `json:"netmask"`
+}
+
+type ipv6V1 struct {
+	Additional []ipv6V1 `json:"additional"`
+	Address    string   `json:"address"`
+	Network    string   `json:"network"`
+	Prefix     string   `json:"prefix"`
+}
+
+func newInstanceV1(instance *vultr.Instance) *instanceV1 {
+	ret := &instanceV1{
+		Hostname:     instance.Hostname,
+		InstanceID:   instance.InstanceID,
+		InstanceV2ID: instance.InstanceV2ID,
+		Interfaces:   []interfaceV1{},
+		PublicKeys:   instance.PublicKeys,
+		Region:       regionV1{RegionCode: instance.Region},
+		Tags:         instance.Tags,
+	}
+	if ret.PublicKeys == nil {
+		ret.PublicKeys = []string{}
+	}
+	if ret.Tags == nil {
+		ret.Tags = []string{}
+	}
+
+	for _, networkInterface := range instance.NetworkInterfaces {
+		i := interfaceV1{
+			Mac:         networkInterface.Mac.HumanReadableString(),
+			NetworkType: networkType(&networkInterface),
+			NetworkV2ID: networkInterface.NetworkID,
+		}
+		if networkInterface.IPv4 != nil {
+			i.IPv4 = newIPv4V1(networkInterface.IPv4)
+		}
+		if networkInterface.IPv6 != nil {
+			i.IPv6 = &ipv6V1{
+				Additional: []ipv6V1{},
+				Address:    networkInterface.IPv6.Address.String(),
+				Network:    networkInterface.IPv6.Network.String(),
+				Prefix:     fmt.Sprint(uint8(networkInterface.IPv6.Prefix)),
+			}
+		}
+		ret.Interfaces = append(ret.Interfaces, i)
+	}
+
+	return ret
+}
+
+func newIPv4V1(addr *vultr.IPv4Addr) *ipv4V1 {
+	ret := &ipv4V1{
+		Additional: []ipv4V1{},
+		Address:    ipv4String(addr.Address),
+		Gateway:    ipv4String(addr.Gateway),
+		Netmask:    addr.Netmask.String(),
+	}
+	for i := range addr.Additional {
+		ret.Additional = append(ret.Additional, *newIPv4V1(&addr.Additional[i]))
+	}
+	return ret
+}
+
+// ec2InstanceV1 projects a Vultr instance onto the subset of the EC2
+// metadata that Vultr serves under `/latest`.
+func ec2InstanceV1(instance *vultr.Instance) *ec2v1.Instance {
+	ret := &ec2v1.Instance{
+		ID:             instance.InstanceID,
+		Hostname:       instance.Hostname,
+		LocalHostname:  instance.Hostname,
+		PublicHostname: instance.Hostname,
+		Placement: ec2v1.Placement{
+			AvailabilityZone: instance.Region,
+			Region:           instance.Region,
+		},
+		UserData: ec2v1.UserData(instance.UserData),
+	}
+
+	for i, publicKey := range instance.PublicKeys {
+		// use the key's comment as its name
+		name := fmt.Sprintf("key-%d", i)
+		if fields := strings.Fields(publicKey); len(fields) > 2 {
+			name = fields[len(fields)-1]
+		}
+		ret.PublicKeys = append(ret.PublicKeys, ec2v1.PublicKey{
+			Name:       name,
+			OpenSSHKey: publicKey,
+		})
+	}
+
+	for i, networkInterface := range instance.NetworkInterfaces {
+		n := ec2v1.NetworkInterface{
+			Mac:          networkInterface.Mac,
+			DeviceNumber: uint(i),
+		}
+
+		if networkInterface.IPv4 != nil {
+			switch networkType(&networkInterface) {
+			case vultr.NetworkTypePublic:
+				n.PublicIPv4s = append(n.PublicIPv4s, networkInterface.IPv4.Address)
+				if len(ret.PublicIPv4) == 0 {
+					ret.PublicIPv4 = networkInterface.IPv4.Address
+				}
+			case vultr.NetworkTypePrivate:
+				n.LocalIPv4s = append(n.LocalIPv4s, networkInterface.IPv4.Address)
+				if len(ret.LocalIPv4) == 0 {
+					ret.LocalIPv4 = networkInterface.IPv4.Address
+				}
+			}
+		}
+		if networkInterface.IPv6 != nil {
+			n.IPv6s = append(n.IPv6s, networkInterface.IPv6.Address)
+		}
+
+		ret.NetworkInterfaces = append(ret.NetworkInterfaces, n)
+	}
+
+	return ret
+}
+
+func networkType(networkInterface *vultr.NetworkInterface) string {
+	if networkInterface.NetworkType == "" {
+		return vultr.NetworkTypePublic
+	}
+	return networkInterface.NetworkType
+}
+
+func ipv4String(addr model.IPv4) string {
+	if len(addr) == 0 {
+		return ""
+	}
+	return addr.String()
+}
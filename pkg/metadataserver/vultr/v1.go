@@ -0,0 +1,251 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vultr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/amari/cloud-metadata-server/internal/pkg/jsontree"
+	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/ec2"
+	"github.com/amari/cloud-metadata-server/pkg/metadataserver/route"
+	ec2v1 "github.com/amari/cloud-metadata-server/pkg/models/amazonaws/ec2/v1"
+	"github.com/amari/cloud-metadata-server/pkg/models/vultr/v1"
+	"go.uber.org/zap"
+
+	"github.com/amari/cloud-metadata-server/pkg/store"
+	"github.com/gorilla/mux"
+)
+
+const TypeURIV1 = vultr.TypeURI
+
+type EndpointV1 struct {
+	*core.Server
+	*httpEndpointV1
+
+	router *mux.Router
+}
+
+// Store implements `Endpoint`
+func (e *EndpointV1) Store() store.Store {
+	return e.httpEndpointV1.store
+}
+
+// Routes implements `HTTPEndpoint`
+func (e *EndpointV1) Routes() []route.Route {
+	return []route.Route{
+		{PathPrefix: "/v1"},
+		{PathPrefix: "/user-data"},
+		// the EC2 compatible API
+		{PathPrefix: "/"},
+	}
+}
+
+func (e *EndpointV1) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// check that the header is set!
+	addr := r.Header.Get("X-Remote-Data-Link-Addr")
+	if addr == "" {
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	e.router.ServeHTTP(w, r)
+}
+
+func NewEndpointV1(core *core.Server, s store.Store) *EndpointV1 {
+	endpoint := &httpEndpointV1{
+		Server: core,
+		store:  s,
+	}
+
+	router := mux.NewRouter()
+
+	// configure router here!
+	router.NotFoundHandler = http.HandlerFunc(notFoundHandlerV1)
+	router.StrictSlash(false)
+
+	router.HandleFunc("/v1.json", endpoint.getInstanceJSON).Methods("GET")
+	router.HandleFunc("/v1", endpoint.getMetadata).Methods("GET")
+	router.HandleFunc("/v1/{path:.*}", endpoint.getMetadata).Methods("GET")
+	router.HandleFunc("/user-data/user-data", endpoint.getUserData).Methods("GET")
+
+	// everything else is the EC2 compatible API
+	router.PathPrefix("/").Handler(ec2.NewCompatHandler(core, TypeURIV1, endpoint.getEC2Instance))
+
+	return &EndpointV1{
+		core,
+		endpoint,
+		router,
+	}
+}
+
+type httpEndpointV1 struct {
+	*core.Server
+
+	store store.Store
+}
+
+func (e *httpEndpointV1) logger(r *http.Request) *zap.Logger {
+	return e.Log().With(
+		zap.String("datalink_addr", r.Header.Get("X-Remote-Data-Link-Addr")),
+		zap.String("request_path", r.URL.String()),
+		zap.String("schema", TypeURIV1),
+	)
+}
+
+func (e *httpEndpointV1) getInstance(r *http.Request) (*vultr.Instance, error) {
+	d, err := e.store.GetDocument(r.Context(), r.Header.Get("X-Remote-Data-Link-Addr"), TypeURIV1)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, ok := d.Contents.(*vultr.Instance)
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+
+	return instance, nil
+}
+
+func (e *httpEndpointV1) getInstanceJSON(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	data, err := json.Marshal(newInstanceV1(instance))
+	if err != nil {
+		l.Error("failed to encode document", zap.NamedError("error", err))
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	writeV1(w, "application/json", data)
+
+	l.Info("", zap.Int("status", 200))
+}
+
+// getMetadata serves a node of the `v1.json` document. Leaves and lists of
+// leaves are served as text, anything else as JSON.
+func (e *httpEndpointV1) getMetadata(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	tree, err := jsontree.FromValue(newInstanceV1(instance))
+	if err != nil {
+		l.Error("failed to encode document", zap.NamedError("error", err))
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	node, ok := jsontree.Lookup(tree, mux.Vars(r)["path"])
+	if !ok {
+		l.Error("bad attribute")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	if text, ok := textV1(node); ok {
+		writeV1(w, "text/plain", []byte(text))
+	} else {
+		data, err := json.Marshal(node)
+		if err != nil {
+			l.Error("failed to encode document", zap.NamedError("error", err))
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+		writeV1(w, "application/json", data)
+	}
+
+	l.Info("", zap.Int("status", 200))
+}
+
+func (e *httpEndpointV1) getUserData(w http.ResponseWriter, r *http.Request) {
+	l := e.logger(r)
+
+	instance, err := e.getInstance(r)
+	if err != nil {
+		l.Error("document not found")
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	if instance.UserData == "" {
+		notFoundHandlerV1(w, r)
+		return
+	}
+
+	writeV1(w, "text/plain", []byte(instance.UserData))
+
+	l.Info("", zap.Int("status", 200))
+}
+
+func (e *httpEndpointV1) getEC2Instance(r *http.Request) (*ec2v1.Instance, error) {
+	instance, err := e.getInstance(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return ec2InstanceV1(instance), nil
+}
+
+// textV1 renders a leaf, or a list of leaves one per line.
+func textV1(node interface{}) (string, bool) {
+	if jsontree.IsLeaf(node) {
+		return jsontree.Text(node), true
+	}
+
+	list, ok := node.([]interface{})
+	if !ok {
+		return "", false
+	}
+
+	lines := make([]string, 0, len(list))
+	for _, v := range list {
+		if !jsontree.IsLeaf(v) {
+			return "", false
+		}
+		lines = append(lines, jsontree.Text(v))
+	}
+
+	return strings.Join(lines, "\n"), true
+}
+
+func writeV1(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func notFoundHandlerV1(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusNotFound)
+	fmt.Fprint(w, "Not Found")
+}
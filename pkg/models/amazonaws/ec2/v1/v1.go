@@ -0,0 +1,128 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ec2
+
+import (
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+)
+
+const TypeURI = "amazonaws.com/ec2/v1"
+
+type Instance struct {
+	ID                 string             `json:"instance_id" yaml:"instance_id" toml:"instance_id"`
+	ImageID            string             `json:"ami_id" yaml:"ami_id" toml:"ami_id"`
+	LaunchIndex        uint               `json:"ami_launch_index" yaml:"ami_launch_index" toml:"ami_launch_index"`
+	InstanceType       string             `json:"instance_type" yaml:"instance_type" toml:"instance_type"`
+	Hostname           string             `json:"hostname" yaml:"hostname" toml:"hostname"`
+	LocalHostname      string             `json:"local_hostname,omitempty" yaml:"local_hostname,omitempty" toml:"local_hostname,omitempty"`
+	PublicHostname     string             `json:"public_hostname,omitempty" yaml:"public_hostname,omitempty" toml:"public_hostname,omitempty"`
+	LocalIPv4          model.IPv4         `json:"local_ipv4,omitempty" yaml:"local_ipv4,omitempty" toml:"local_ipv4,omitempty"`
+	PublicIPv4         model.IPv4         `json:"public_ipv4,omitempty" yaml:"public_ipv4,omitempty" toml:"public_ipv4,omitempty"`
+	ReservationID      string             `json:"reservation_id,omitempty" yaml:"reservation_id,omitempty" toml:"reservation_id,omitempty"`
+	SecurityGroups     []string           `json:"security_groups,omitempty" yaml:"security_groups,omitempty" toml:"security_groups,omitempty"`
+	PublicKeys         []PublicKey        `json:"public_keys" yaml:"public_keys" toml:"public_keys"`
+	NetworkInterfaces  []NetworkInterface `json:"network_interfaces" yaml:"network_interfaces" toml:"network_interfaces"`
+	Placement          Placement          `json:"placement" yaml:"placement" toml:"placement"`
+	BlockDeviceMapping BlockDeviceMapping `json:"block_device_mapping,omitempty" yaml:"block_device_mapping,omitempty" toml:"block_device_mapping,omitempty"`
+	Services           Services           `json:"services" yaml:"services" toml:"services"`
+	UserData           UserData           `json:"user_data,omitempty" yaml:"user_data,omitempty" toml:"user_data,omitempty"`
+	MetadataOptions    MetadataOptions    `json:"metadata_options" yaml:"metadata_options" toml:"metadata_options"`
+}
+
+func (i *Instance) TypeURI() string {
+	return TypeURI
+}
+
+func (i *Instance) DataLinkAddrs() []model.DataLinkAddr {
+	res := make([]model.DataLinkAddr, 0, len(i.NetworkInterfaces))
+
+	for j := 0; j < len(i.NetworkInterfaces); j++ {
+		res = append(res, i.NetworkInterfaces[j].Mac)
+	}
+
+	return res
+}
+
+// PrimaryNetworkInterface returns the interface with device number 0.
+func (i *Instance) PrimaryNetworkInterface() *NetworkInterface {
+	for j := range i.NetworkInterfaces {
+		if i.NetworkInterfaces[j].DeviceNumber == 0 {
+			return &i.NetworkInterfaces[j]
+		}
+	}
+
+	return nil
+}
+
+type UserData string
+
+const (
+	HTTPTokensOptional = "optional"
+	HTTPTokensRequired = "required"
+)
+
+type MetadataOptions struct {
+	// HTTPTokens is either "optional" (IMDSv1 and IMDSv2) or "required"
+	// (IMDSv2 only). It defaults to "optional".
+	HTTPTokens string `json:"http_tokens,omitempty" yaml:"http_tokens,omitempty" toml:"http_tokens,omitempty"`
+}
+
+// TokensRequired reports whether requests must present an IMDSv2 session token.
+func (o *MetadataOptions) TokensRequired() bool {
+	return o.HTTPTokens == HTTPTokensRequired
+}
+
+// A PublicKey is an OpenSSH public key registered under a key pair name.
+type PublicKey struct {
+	Name       string `json:"name" yaml:"name" toml:"name"`
+	OpenSSHKey string `json:"openssh_key" yaml:"openssh_key" toml:"openssh_key"`
+}
+
+type NetworkInterface struct {
+	Mac                  model.MACAddr `json:"mac" yaml:"mac" toml:"mac"`
+	DeviceNumber         uint          `json:"device_number" yaml:"device_number" toml:"device_number"`
+	InterfaceID          string        `json:"interface_id,omitempty" yaml:"interface_id,omitempty" toml:"interface_id,omitempty"`
+	OwnerID              string        `json:"owner_id,omitempty" yaml:"owner_id,omitempty" toml:"owner_id,omitempty"`
+	LocalHostname        string        `json:"local_hostname,omitempty" yaml:"local_hostname,omitempty" toml:"local_hostname,omitempty"`
+	LocalIPv4s           []model.IPv4  `json:"local_ipv4s,omitempty" yaml:"local_ipv4s,omitempty" toml:"local_ipv4s,omitempty"`
+	PublicHostname       string        `json:"public_hostname,omitempty" yaml:"public_hostname,omitempty" toml:"public_hostname,omitempty"`
+	PublicIPv4s          []model.IPv4  `json:"public_ipv4s,omitempty" yaml:"public_ipv4s,omitempty" toml:"public_ipv4s,omitempty"`
+	IPv6s                []model.IPv6  `json:"ipv6s,omitempty" yaml:"ipv6s,omitempty" toml:"ipv6s,omitempty"`
+	SecurityGroups       []string      `json:"security_groups,omitempty" yaml:"security_groups,omitempty" toml:"security_groups,omitempty"`
+	SecurityGroupIDs     []string      `json:"security_group_ids,omitempty" yaml:"security_group_ids,omitempty" toml:"security_group_ids,omitempty"`
+	SubnetID             string        `json:"subnet_id,omitempty" yaml:"subnet_id,omitempty" toml:"subnet_id,omitempty"`
+	SubnetIPv4CIDRBlock  string        `json:"subnet_ipv4_cidr_block,omitempty" yaml:"subnet_ipv4_cidr_block,omitempty" toml:"subnet_ipv4_cidr_block,omitempty"`
+	SubnetIPv6CIDRBlocks []string      `json:"subnet_ipv6_cidr_blocks,omitempty" yaml:"subnet_ipv6_cidr_blocks,omitempty" toml:"subnet_ipv6_cidr_blocks,omitempty"`
+	VPCID                string        `json:"vpc_id,omitempty" yaml:"vpc_id,omitempty" toml:"vpc_id,omitempty"`
+	VPCIPv4CIDRBlocks    []string      `json:"vpc_ipv4_cidr_blocks,omitempty" yaml:"vpc_ipv4_cidr_blocks,omitempty" toml:"vpc_ipv4_cidr_blocks,omitempty"`
+	VPCIPv6CIDRBlocks    []string      `json:"vpc_ipv6_cidr_blocks,omitempty" yaml:"vpc_ipv6_cidr_blocks,omitempty" toml:"vpc_ipv6_cidr_blocks,omitempty"`
+}
+
+type Placement struct {
+	AvailabilityZone   string `json:"availability_zone" yaml:"availability_zone" toml:"availability_zone"`
+	AvailabilityZoneID string `json:"availability_zone_id,omitempty" yaml:"availability_zone_id,omitempty" toml:"availability_zone_id,omitempty"`
+	Region             string `json:"region" yaml:"region" toml:"region"`
+}
+
+// BlockDeviceMapping maps virtual device names (e.g. "ami", "root", "ebs0")
+// to the device name exposed to the guest.
+type BlockDeviceMapping map[string]string
+
+type Services struct {
+	Domain    string `json:"domain,omitempty" yaml:"domain,omitempty" toml:"domain,omitempty"`
+	Partition string `json:"partition,omitempty" yaml:"partition,omitempty" toml:"partition,omitempty"`
+}
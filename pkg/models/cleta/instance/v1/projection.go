@@ -0,0 +1,569 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"strconv"
+	"strings"
+
+	ec2 "github.com/amari/cloud-metadata-server/pkg/models/amazonaws/ec2/v1"
+	digitalocean "github.com/amari/cloud-metadata-server/pkg/models/digitalocean/v1"
+	compute "github.com/amari/cloud-metadata-server/pkg/models/googleapis/compute/v1"
+	hetzner "github.com/amari/cloud-metadata-server/pkg/models/hetzner/v1"
+	linode "github.com/amari/cloud-metadata-server/pkg/models/linode/v1"
+	azure "github.com/amari/cloud-metadata-server/pkg/models/microsoft/azure/v1"
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+	openstack "github.com/amari/cloud-metadata-server/pkg/models/openstack/v1"
+	oraclecloud "github.com/amari/cloud-metadata-server/pkg/models/oraclecloud/v2"
+	vultr "github.com/amari/cloud-metadata-server/pkg/models/vultr/v1"
+)
+
+// Droplet projects the instance into the `digitalocean.com/v1` schema.
+func (i *Instance) Droplet() *digitalocean.Droplet {
+	droplet := &digitalocean.Droplet{
+		ID:         i.numericID(),
+		Hostname:   i.Hostname,
+		UserData:   digitalocean.UserData(i.UserData),
+		VendorData: digitalocean.VendorData(i.VendorData),
+		Region:     i.Region,
+		Tags:       i.Tags,
+		DNS:        &digitalocean.DNS{},
+	}
+
+	for _, key := range i.PublicKeys {
+		droplet.PublicKeys = append(droplet.PublicKeys, digitalocean.PublicKey(key.Key))
+	}
+	for _, nameserver := range i.DNS.Nameservers {
+		droplet.DNS.Nameservers = append(droplet.DNS.Nameservers, digitalocean.Nameserver{Host: nameserver, Port: 53})
+	}
+
+	for _, networkInterface := range i.NetworkInterfaces {
+		var ipv4 *digitalocean.IPv4Addr
+		if networkInterface.IPv4 != nil {
+			ipv4 = &digitalocean.IPv4Addr{
+				Address: networkInterface.IPv4.Address,
+				Netmask: networkInterface.IPv4.Netmask,
+				Gateway: networkInterface.IPv4.Gateway,
+			}
+		}
+		var ipv6 *digitalocean.IPv6Addr
+		if networkInterface.IPv6 != nil {
+			ipv6 = &digitalocean.IPv6Addr{
+				Address: networkInterface.IPv6.Address,
+				Cidr:    uint8(networkInterface.IPv6.Prefix),
+				Gateway: networkInterface.IPv6.Gateway,
+			}
+		}
+
+		if networkInterface.IsPublic() {
+			droplet.NetworkInterfaces.PublicInterfaces = append(droplet.NetworkInterfaces.PublicInterfaces, digitalocean.PublicNetworkInterface{
+				Mac:  networkInterface.Mac,
+				Ipv4: ipv4,
+				Ipv6: ipv6,
+			})
+		} else {
+			droplet.NetworkInterfaces.PrivateInterfaces = append(droplet.NetworkInterfaces.PrivateInterfaces, digitalocean.PrivateNetworkInterface{
+				Mac:  networkInterface.Mac,
+				Ipv4: ipv4,
+				Ipv6: ipv6,
+			})
+		}
+	}
+
+	return droplet
+}
+
+// EC2Instance projects the instance into the `amazonaws.com/ec2/v1` schema.
+func (i *Instance) EC2Instance() *ec2.Instance {
+	instance := &ec2.Instance{
+		ID:            i.ID,
+		Hostname:      i.Hostname,
+		LocalHostname: i.Hostname,
+		Placement: ec2.Placement{
+			AvailabilityZone: i.Zone,
+			Region:           i.Region,
+		},
+		UserData: ec2.UserData(i.UserData),
+	}
+
+	for j, key := range i.PublicKeys {
+		instance.PublicKeys = append(instance.PublicKeys, ec2.PublicKey{
+			Name:       i.publicKeyName(j),
+			OpenSSHKey: key.Key,
+		})
+	}
+
+	for j, networkInterface := range i.NetworkInterfaces {
+		n := ec2.NetworkInterface{
+			Mac:           networkInterface.Mac,
+			DeviceNumber:  uint(j),
+			LocalHostname: i.Hostname,
+		}
+		if ipv4 := networkInterface.IPv4; ipv4 != nil {
+			n.LocalIPv4s = []model.IPv4{ipv4.Address}
+			n.SubnetIPv4CIDRBlock = ipv4CIDR(ipv4)
+			if public := networkInterface.publicIPv4(); public != nil {
+				n.PublicIPv4s = []model.IPv4{public}
+			}
+		}
+		if ipv6 := networkInterface.IPv6; ipv6 != nil {
+			n.IPv6s = []model.IPv6{ipv6.Address}
+			n.SubnetIPv6CIDRBlocks = []string{ipv6CIDR(ipv6)}
+		}
+		instance.NetworkInterfaces = append(instance.NetworkInterfaces, n)
+	}
+
+	if primary := instance.PrimaryNetworkInterface(); primary != nil {
+		if len(primary.LocalIPv4s) > 0 {
+			instance.LocalIPv4 = primary.LocalIPv4s[0]
+		}
+		if len(primary.PublicIPv4s) > 0 {
+			instance.PublicIPv4 = primary.PublicIPv4s[0]
+		}
+	}
+
+	return instance
+}
+
+// ComputeInstance projects the instance into the `googleapis.com/compute/v1`
+// schema. SSH keys and user data are exposed as instance attributes the way
+// the guest environment expects them.
+func (i *Instance) ComputeInstance() *compute.Instance {
+	instance := &compute.Instance{
+		ID:         i.numericID(),
+		Name:       i.shortHostname(),
+		Hostname:   i.Hostname,
+		Zone:       i.Zone,
+		Tags:       i.Tags,
+		Attributes: map[string]string{},
+	}
+
+	if len(i.PublicKeys) > 0 {
+		lines := make([]string, 0, len(i.PublicKeys))
+		for j, key := range i.PublicKeys {
+			lines = append(lines, i.publicKeyName(j)+":"+key.Key)
+		}
+		instance.Attributes["ssh-keys"] = strings.Join(lines, "\n")
+	}
+	if i.UserData != "" {
+		instance.Attributes["user-data"] = string(i.UserData)
+	}
+
+	var dnsServers []model.IPv4
+	for _, nameserver := range i.DNS.Nameservers {
+		if ip := net.ParseIP(nameserver).To4(); ip != nil {
+			dnsServers = append(dnsServers, model.IPv4(ip))
+		}
+	}
+
+	for _, networkInterface := range i.NetworkInterfaces {
+		n := compute.NetworkInterface{
+			Mac:        networkInterface.Mac,
+			MTU:        networkInterface.MTU,
+			DNSServers: dnsServers,
+		}
+		if ipv4 := networkInterface.IPv4; ipv4 != nil {
+			n.IP = ipv4.Address
+			n.Gateway = ipv4.Gateway
+			n.Subnetmask = ipv4.Netmask
+			if public := networkInterface.publicIPv4(); public != nil {
+				n.AccessConfigs = []compute.AccessConfig{{ExternalIP: public, Type: "ONE_TO_ONE_NAT"}}
+			}
+		}
+		instance.NetworkInterfaces = append(instance.NetworkInterfaces, n)
+	}
+
+	return instance
+}
+
+// OpenStackInstance projects the instance into the `openstack.org/v1` schema.
+func (i *Instance) OpenStackInstance() *openstack.Instance {
+	instance := &openstack.Instance{
+		UUID:             i.ID,
+		Name:             i.shortHostname(),
+		Hostname:         i.Hostname,
+		AvailabilityZone: i.Zone,
+		UserData:         openstack.UserData(i.UserData),
+	}
+
+	for j, key := range i.PublicKeys {
+		instance.PublicKeys = append(instance.PublicKeys, openstack.PublicKey{
+			Name: i.publicKeyName(j),
+			Type: "ssh",
+			Data: key.Key,
+		})
+	}
+
+	// cloud-init picks the `cloud-init` key out of the vendor data.
+	if i.VendorData != "" {
+		instance.VendorData = map[string]interface{}{"cloud-init": string(i.VendorData)}
+	}
+
+	networkData := &instance.NetworkData
+	for j, networkInterface := range i.NetworkInterfaces {
+		link := i.interfaceName(j)
+		networkData.Links = append(networkData.Links, openstack.Link{
+			ID:                 link,
+			Type:               "phy",
+			EthernetMacAddress: networkInterface.Mac,
+			MTU:                networkInterface.MTU,
+		})
+		if ipv4 := networkInterface.IPv4; ipv4 != nil {
+			network := openstack.Network{
+				ID:        fmt.Sprintf("network%d", len(networkData.Networks)),
+				Type:      "ipv4",
+				Link:      link,
+				IPAddress: ipv4.Address.String(),
+				Netmask:   ipv4.Netmask.String(),
+			}
+			if ipv4.Gateway != nil {
+				network.Routes = []openstack.Route{{Network: "0.0.0.0", Netmask: "0.0.0.0", Gateway: ipv4.Gateway.String()}}
+			}
+			networkData.Networks = append(networkData.Networks, network)
+		}
+		if ipv6 := networkInterface.IPv6; ipv6 != nil {
+			network := openstack.Network{
+				ID:        fmt.Sprintf("network%d", len(networkData.Networks)),
+				Type:      "ipv6",
+				Link:      link,
+				IPAddress: ipv6.Address.String(),
+				Netmask:   net.IP(net.CIDRMask(int(ipv6.Prefix), 8*net.IPv6len)).String(),
+			}
+			if ipv6.Gateway != nil {
+				network.Routes = []openstack.Route{{Network: "::", Netmask: "::", Gateway: ipv6.Gateway.String()}}
+			}
+			networkData.Networks = append(networkData.Networks, network)
+		}
+	}
+	for _, nameserver := range i.DNS.Nameservers {
+		networkData.Services = append(networkData.Services, openstack.Service{Type: "dns", Address: nameserver})
+	}
+
+	return instance
+}
+
+// AzureInstance projects the instance into the `microsoft.com/azure/v1`
+// schema.
+func (i *Instance) AzureInstance() *azure.Instance {
+	instance := &azure.Instance{
+		Compute: azure.Compute{
+			VMID:     i.ID,
+			Name:     i.shortHostname(),
+			Location: i.Region,
+			Zone:     i.Zone,
+			OSType:   "Linux",
+			Tags:     i.tagMap(),
+			OSProfile: azure.OSProfile{
+				ComputerName:                  i.shortHostname(),
+				DisablePasswordAuthentication: true,
+			},
+			UserData: azure.UserData(i.UserData),
+		},
+	}
+
+	for _, key := range i.PublicKeys {
+		instance.Compute.PublicKeys = append(instance.Compute.PublicKeys, azure.PublicKey{KeyData: key.Key})
+	}
+
+	for _, networkInterface := range i.NetworkInterfaces {
+		n := azure.NetworkInterface{
+			Mac: networkInterface.Mac,
+		}
+		if ipv4 := networkInterface.IPv4; ipv4 != nil {
+			address := azure.IPAddress{Private: ipv4.Address.String()}
+			if ipv4.Public != nil {
+				address.Public = ipv4.Public.String()
+			}
+			ones, _ := net.IPMask(ipv4.Netmask).Size()
+			n.IPv4 = []azure.IPAddress{address}
+			n.IPv4Subnets = []azure.Subnet{{
+				Address: net.IP(ipv4.Address).Mask(net.IPMask(ipv4.Netmask)).String(),
+				Prefix:  strconv.Itoa(ones),
+			}}
+		}
+		if ipv6 := networkInterface.IPv6; ipv6 != nil {
+			mask := net.CIDRMask(int(ipv6.Prefix), 8*net.IPv6len)
+			n.IPv6 = []azure.IPAddress{{Private: ipv6.Address.String()}}
+			n.IPv6Subnets = []azure.Subnet{{
+				Address: net.IP(ipv6.Address).Mask(mask).String(),
+				Prefix:  strconv.Itoa(int(ipv6.Prefix)),
+			}}
+		}
+		instance.NetworkInterfaces = append(instance.NetworkInterfaces, n)
+	}
+
+	return instance
+}
+
+// OracleCloudInstance projects the instance into the `oraclecloud.com/v2`
+// schema.
+func (i *Instance) OracleCloudInstance() *oraclecloud.Instance {
+	instance := &oraclecloud.Instance{
+		ID:                  i.ID,
+		DisplayName:         i.shortHostname(),
+		Hostname:            i.Hostname,
+		AvailabilityDomain:  i.Zone,
+		Region:              i.Region,
+		CanonicalRegionName: i.Region,
+		UserData:            oraclecloud.UserData(i.UserData),
+		FreeformTags:        i.tagMap(),
+	}
+
+	for _, key := range i.PublicKeys {
+		instance.SSHAuthorizedKeys = append(instance.SSHAuthorizedKeys, key.Key)
+	}
+
+	for j, networkInterface := range i.NetworkInterfaces {
+		vnic := oraclecloud.VNIC{
+			Mac:      networkInterface.Mac,
+			NICIndex: uint(j),
+		}
+		if ipv4 := networkInterface.IPv4; ipv4 != nil {
+			vnic.PrivateIP = ipv4.Address
+			vnic.VirtualRouterIP = ipv4.Gateway
+			vnic.SubnetCIDRBlock = ipv4CIDR(ipv4)
+		}
+		instance.VNICs = append(instance.VNICs, vnic)
+	}
+
+	return instance
+}
+
+// HetznerServer projects the instance into the `hetzner.cloud/v1` schema.
+// Public interfaces become network interfaces, private interfaces with an
+// IPv4 address become private networks.
+func (i *Instance) HetznerServer() *hetzner.Server {
+	server := &hetzner.Server{
+		ID:               i.numericID(),
+		Hostname:         i.Hostname,
+		Region:           i.Region,
+		AvailabilityZone: i.Zone,
+		UserData:         hetzner.UserData(i.UserData),
+		VendorData:       hetzner.VendorData(i.VendorData),
+	}
+
+	for _, key := range i.PublicKeys {
+		server.PublicKeys = append(server.PublicKeys, key.Key)
+	}
+
+	for j, networkInterface := range i.NetworkInterfaces {
+		if networkInterface.IsPublic() {
+			n := hetzner.NetworkInterface{
+				Name: i.interfaceName(j),
+				Mac:  networkInterface.Mac,
+			}
+			if ipv6 := networkInterface.IPv6; ipv6 != nil {
+				n.IPv6 = ipv6CIDR(ipv6)
+				if ipv6.Gateway != nil {
+					n.IPv6Gateway = ipv6.Gateway.String()
+				}
+			}
+			if server.PublicIPv4 == nil {
+				server.PublicIPv4 = networkInterface.publicIPv4()
+			}
+			server.NetworkInterfaces = append(server.NetworkInterfaces, n)
+			continue
+		}
+
+		if ipv4 := networkInterface.IPv4; ipv4 != nil {
+			server.PrivateNetworks = append(server.PrivateNetworks, hetzner.PrivateNetwork{
+				IP:           ipv4.Address,
+				InterfaceNum: uint(len(server.PrivateNetworks) + 1),
+				Mac:          networkInterface.Mac,
+				Network:      ipv4CIDR(ipv4),
+				Subnet:       ipv4CIDR(ipv4),
+				Gateway:      ipv4.Gateway,
+			})
+		}
+	}
+
+	return server
+}
+
+// VultrInstance projects the instance into the `vultr.com/v1` schema.
+func (i *Instance) VultrInstance() *vultr.Instance {
+	instance := &vultr.Instance{
+		InstanceID:   i.ID,
+		InstanceV2ID: i.ID,
+		Hostname:     i.Hostname,
+		Region:       i.Region,
+		Tags:         i.Tags,
+		UserData:     vultr.UserData(i.UserData),
+	}
+
+	for _, key := range i.PublicKeys {
+		instance.PublicKeys = append(instance.PublicKeys, key.Key)
+	}
+
+	for _, networkInterface := range i.NetworkInterfaces {
+		n := vultr.NetworkInterface{
+			Mac:         networkInterface.Mac,
+			NetworkType: vultr.NetworkTypePrivate,
+		}
+		if networkInterface.IsPublic() {
+			n.NetworkType = vultr.NetworkTypePublic
+		}
+		if ipv4 := networkInterface.IPv4; ipv4 != nil {
+			n.IPv4 = &vultr.IPv4Addr{
+				Address: ipv4.Address,
+				Netmask: ipv4.Netmask,
+				Gateway: ipv4.Gateway,
+			}
+		}
+		if ipv6 := networkInterface.IPv6; ipv6 != nil {
+			n.IPv6 = &vultr.IPv6Addr{
+				Address: ipv6.Address,
+				Network: model.IPv6(net.IP(ipv6.Address).Mask(net.CIDRMask(int(ipv6.Prefix), 8*net.IPv6len))),
+				Prefix:  ipv6.Prefix,
+			}
+		}
+		instance.NetworkInterfaces = append(instance.NetworkInterfaces, n)
+	}
+
+	return instance
+}
+
+// LinodeInstance projects the instance into the `linode.com/v1` schema. SSH
+// keys are attributed to root.
+func (i *Instance) LinodeInstance() *linode.Instance {
+	instance := &linode.Instance{
+		ID:       i.numericID(),
+		Label:    i.shortHostname(),
+		Region:   i.Region,
+		Tags:     i.Tags,
+		UserData: linode.UserData(i.UserData),
+	}
+
+	if len(i.PublicKeys) > 0 {
+		keys := make([]string, 0, len(i.PublicKeys))
+		for _, key := range i.PublicKeys {
+			keys = append(keys, key.Key)
+		}
+		instance.SSHKeys = map[string][]string{"root": keys}
+	}
+
+	for j, networkInterface := range i.NetworkInterfaces {
+		n := linode.NetworkInterface{
+			Mac:     networkInterface.Mac,
+			Label:   networkInterface.Name,
+			Purpose: "vlan",
+		}
+		if networkInterface.IsPublic() {
+			n.Purpose = "public"
+		}
+
+		if ipv4 := networkInterface.IPv4; ipv4 != nil {
+			ones, _ := net.IPMask(ipv4.Netmask).Size()
+			address := ipv4.Address.String() + "/" + strconv.Itoa(ones)
+			if networkInterface.IsPublic() {
+				instance.IPv4.Public = append(instance.IPv4.Public, address)
+			} else {
+				n.IPAMAddress = address
+				instance.IPv4.Private = append(instance.IPv4.Private, address)
+			}
+		}
+		if ipv6 := networkInterface.IPv6; ipv6 != nil && networkInterface.IsPublic() && instance.IPv6.SLAAC == "" {
+			instance.IPv6.SLAAC = ipv6CIDR(ipv6)
+		}
+		if n.Label == "" && !networkInterface.IsPublic() {
+			n.Label = i.interfaceName(j)
+		}
+		instance.NetworkInterfaces = append(instance.NetworkInterfaces, n)
+	}
+
+	return instance
+}
+
+// numericID returns the instance id for schemas that require a number. Ids
+// that are not numeric are hashed so that the result stays stable.
+func (i *Instance) numericID() uint64 {
+	if id, err := strconv.ParseUint(i.ID, 10, 64); err == nil {
+		return id
+	}
+	h := fnv.New64a()
+	h.Write([]byte(i.ID))
+	// keep the id within the range of a JSON number
+	return h.Sum64() & (1<<53 - 1)
+}
+
+func (i *Instance) shortHostname() string {
+	if j := strings.IndexByte(i.Hostname, '.'); j >= 0 {
+		return i.Hostname[:j]
+	}
+	return i.Hostname
+}
+
+func (i *Instance) publicKeyName(j int) string {
+	if name := i.PublicKeys[j].Name; name != "" {
+		return name
+	}
+	return fmt.Sprintf("key-%d", j)
+}
+
+func (i *Instance) interfaceName(j int) string {
+	if name := i.NetworkInterfaces[j].Name; name != "" {
+		return name
+	}
+	return fmt.Sprintf("eth%d", j)
+}
+
+// tagMap converts `key=value` tags into a map. Tags without a value map to
+// the empty string.
+func (i *Instance) tagMap() map[string]string {
+	if len(i.Tags) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(i.Tags))
+	for _, tag := range i.Tags {
+		if j := strings.IndexByte(tag, '='); j >= 0 {
+			m[tag[:j]] = tag[j+1:]
+		} else {
+			m[tag] = ""
+		}
+	}
+	return m
+}
+
+// publicIPv4 returns the address the interface is reachable at from outside,
+// or nil if it is not reachable.
+func (n *NetworkInterface) publicIPv4() model.IPv4 {
+	switch {
+	case n.IPv4 == nil:
+		return nil
+	case n.IPv4.Public != nil:
+		return n.IPv4.Public
+	case n.IsPublic():
+		return n.IPv4.Address
+	}
+	return nil
+}
+
+func ipv4CIDR(addr *IPv4Addr) string {
+	if addr.Netmask == nil {
+		return ""
+	}
+	ipNet := net.IPNet{IP: net.IP(addr.Address), Mask: net.IPMask(addr.Netmask)}
+	ipNet.IP = ipNet.IP.Mask(ipNet.Mask)
+	return ipNet.String()
+}
+
+func ipv6CIDR(addr *IPv6Addr) string {
+	return addr.Address.String() + "/" + strconv.Itoa(int(addr.Prefix))
+}
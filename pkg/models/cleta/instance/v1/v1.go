@@ -0,0 +1,102 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package instance
+
+import (
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+)
+
+const TypeURI = "cleta.dev/instance/v1"
+
+// Instance is a provider-neutral description of a virtual machine. Every
+// endpoint in the router can project it into its own schema, so a single
+// document answers the guest on whichever metadata API it queries.
+type Instance struct {
+	ID                string             `json:"instance_id" yaml:"instance_id" toml:"instance_id"`
+	Hostname          string             `json:"hostname" yaml:"hostname" toml:"hostname"`
+	Region            string             `json:"region,omitempty" yaml:"region,omitempty" toml:"region,omitempty"`
+	Zone              string             `json:"zone,omitempty" yaml:"zone,omitempty" toml:"zone,omitempty"`
+	Tags              []string           `json:"tags,omitempty" yaml:"tags,omitempty" toml:"tags,omitempty"`
+	PublicKeys        []PublicKey        `json:"public_keys,omitempty" yaml:"public_keys,omitempty" toml:"public_keys,omitempty"`
+	UserData          UserData           `json:"user_data,omitempty" yaml:"user_data,omitempty" toml:"user_data,omitempty"`
+	VendorData        VendorData         `json:"vendor_data,omitempty" yaml:"vendor_data,omitempty" toml:"vendor_data,omitempty"`
+	DNS               DNS                `json:"dns,omitempty" yaml:"dns,omitempty" toml:"dns,omitempty"`
+	NetworkInterfaces []NetworkInterface `json:"network_interfaces" yaml:"network_interfaces" toml:"network_interfaces"`
+}
+
+func (i *Instance) TypeURI() string {
+	return TypeURI
+}
+
+func (i *Instance) DataLinkAddrs() []model.DataLinkAddr {
+	res := make([]model.DataLinkAddr, 0, len(i.NetworkInterfaces))
+	for j := 0; j < len(i.NetworkInterfaces); j++ {
+		res = append(res, i.NetworkInterfaces[j].Mac)
+	}
+	return res
+}
+
+type UserData string
+
+type VendorData string
+
+type PublicKey struct {
+	// Name is optional; projections that need one fall back to a
+	// positional name.
+	Name string `json:"name,omitempty" yaml:"name,omitempty" toml:"name,omitempty"`
+	Key  string `json:"key" yaml:"key" toml:"key"`
+}
+
+type DNS struct {
+	Nameservers []string `json:"nameservers,omitempty" yaml:"nameservers,omitempty" toml:"nameservers,omitempty"`
+	Search      []string `json:"search,omitempty" yaml:"search,omitempty" toml:"search,omitempty"`
+}
+
+const (
+	NetworkTypePublic  = "public"
+	NetworkTypePrivate = "private"
+)
+
+type NetworkInterface struct {
+	Mac  model.MACAddr `json:"mac" yaml:"mac" toml:"mac"`
+	Name string        `json:"name,omitempty" yaml:"name,omitempty" toml:"name,omitempty"`
+	// Type is either `public` or `private`. Interfaces without a type are
+	// private.
+	Type string    `json:"type,omitempty" yaml:"type,omitempty" toml:"type,omitempty"`
+	MTU  uint      `json:"mtu,omitempty" yaml:"mtu,omitempty" toml:"mtu,omitempty"`
+	IPv4 *IPv4Addr `json:"ipv4,omitempty" yaml:"ipv4,omitempty" toml:"ipv4,omitempty"`
+	IPv6 *IPv6Addr `json:"ipv6,omitempty" yaml:"ipv6,omitempty" toml:"ipv6,omitempty"`
+}
+
+func (n *NetworkInterface) IsPublic() bool {
+	return n.Type == NetworkTypePublic
+}
+
+type IPv4Addr struct {
+	Address model.IPv4     `json:"address" yaml:"address" toml:"address"`
+	Netmask model.IPv4Mask `json:"netmask" yaml:"netmask" toml:"netmask"`
+	Gateway model.IPv4     `json:"gateway,omitempty" yaml:"gateway,omitempty" toml:"gateway,omitempty"`
+	// Public is the address the interface is reachable at from outside
+	// when it sits behind a one-to-one NAT.
+	Public model.IPv4 `json:"public,omitempty" yaml:"public,omitempty" toml:"public,omitempty"`
+}
+
+type IPv6Addr struct {
+	Address model.IPv6          `json:"address" yaml:"address" toml:"address"`
+	Prefix  model.IPv6PrefixLen `json:"prefix" yaml:"prefix" toml:"prefix"`
+	Gateway model.IPv6          `json:"gateway,omitempty" yaml:"gateway,omitempty" toml:"gateway,omitempty"`
+}
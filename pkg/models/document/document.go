@@ -20,14 +20,26 @@ import (
 	"encoding/json"
 	"errors"
 
+	ec2v1 "github.com/amari/cloud-metadata-server/pkg/models/amazonaws/ec2/v1"
+	instancev1 "github.com/amari/cloud-metadata-server/pkg/models/cleta/instance/v1"
 	digitaloceanv1 "github.com/amari/cloud-metadata-server/pkg/models/digitalocean/v1"
+	computev1 "github.com/amari/cloud-metadata-server/pkg/models/googleapis/compute/v1"
+	hetznerv1 "github.com/amari/cloud-metadata-server/pkg/models/hetzner/v1"
+	linodev1 "github.com/amari/cloud-metadata-server/pkg/models/linode/v1"
+	azurev1 "github.com/amari/cloud-metadata-server/pkg/models/microsoft/azure/v1"
 	"github.com/amari/cloud-metadata-server/pkg/models/net"
+	openstackv1 "github.com/amari/cloud-metadata-server/pkg/models/openstack/v1"
+	oraclecloudv2 "github.com/amari/cloud-metadata-server/pkg/models/oraclecloud/v2"
+	vultrv1 "github.com/amari/cloud-metadata-server/pkg/models/vultr/v1"
 	"gopkg.in/yaml.v3"
 )
 
 type Document struct {
-	Kind     string   `json:"kind" yaml:"kind" toml:"kind"`
-	Contents Metadata `json:"metadata" yaml:"metadata" toml:"metadata"`
+	Kind string `json:"kind" yaml:"kind" toml:"kind"`
+	// Namespace is the named network namespace the guest lives in, empty
+	// for guests reached from the namespace of the server.
+	Namespace string   `json:"namespace,omitempty" yaml:"namespace,omitempty" toml:"namespace,omitempty"`
+	Contents  Metadata `json:"metadata" yaml:"metadata" toml:"metadata"`
 }
 
 func (d *Document) TypeURI() string {
@@ -46,6 +58,7 @@ func (d *Document) UnmarshalJSON(data []byte) (err error) {
 	}
 
 	d.Kind = rawDocument.Kind
+	d.Namespace = rawDocument.Namespace
 	d.Contents = m
 
 	return nil
@@ -63,19 +76,22 @@ func (d *Document) UnmarshalYAML(node *yaml.Node) (err error) {
 	}
 
 	d.Kind = rawDocument.Kind
+	d.Namespace = rawDocument.Namespace
 	d.Contents = m
 
 	return nil
 }
 
 type rawJSONDocument struct {
-	Kind     string          `json:"kind" yaml:"kind" toml:"kind"`
-	Contents json.RawMessage `json:"metadata" yaml:"metadata" toml:"metadata"`
+	Kind      string          `json:"kind" yaml:"kind" toml:"kind"`
+	Namespace string          `json:"namespace" yaml:"namespace" toml:"namespace"`
+	Contents  json.RawMessage `json:"metadata" yaml:"metadata" toml:"metadata"`
 }
 
 type rawYAMLDocument struct {
-	Kind     string    `json:"kind" yaml:"kind" toml:"kind"`
-	Contents yaml.Node `json:"metadata" yaml:"metadata" toml:"metadata"`
+	Kind      string    `json:"kind" yaml:"kind" toml:"kind"`
+	Namespace string    `json:"namespace" yaml:"namespace" toml:"namespace"`
+	Contents  yaml.Node `json:"metadata" yaml:"metadata" toml:"metadata"`
 }
 
 type Metadata interface {
@@ -88,6 +104,24 @@ func unmarshalJSONMetadata(kind string, data json.RawMessage) (metadata Metadata
 	switch kind {
 	case digitaloceanv1.TypeURI:
 		metadata = new(digitaloceanv1.Droplet)
+	case ec2v1.TypeURI:
+		metadata = new(ec2v1.Instance)
+	case computev1.TypeURI:
+		metadata = new(computev1.Instance)
+	case openstackv1.TypeURI:
+		metadata = new(openstackv1.Instance)
+	case azurev1.TypeURI:
+		metadata = new(azurev1.Instance)
+	case oraclecloudv2.TypeURI:
+		metadata = new(oraclecloudv2.Instance)
+	case hetznerv1.TypeURI:
+		metadata = new(hetznerv1.Server)
+	case vultrv1.TypeURI:
+		metadata = new(vultrv1.Instance)
+	case linodev1.TypeURI:
+		metadata = new(linodev1.Instance)
+	case instancev1.TypeURI:
+		metadata = new(instancev1.Instance)
 	default:
 		err = errBadTypeURI
 		return
@@ -108,6 +142,69 @@ func unmarshalYAMLMetadata(kind string, node *yaml.Node) (metadata Metadata, err
 			return
 		}
 		metadata = &droplet
+	case ec2v1.TypeURI:
+		var instance ec2v1.Instance
+		err = node.Decode(&instance)
+		if err != nil {
+			return
+		}
+		metadata = &instance
+	case computev1.TypeURI:
+		var instance computev1.Instance
+		err = node.Decode(&instance)
+		if err != nil {
+			return
+		}
+		metadata = &instance
+	case openstackv1.TypeURI:
+		var instance openstackv1.Instance
+		err = node.Decode(&instance)
+		if err != nil {
+			return
+		}
+		metadata = &instance
+	case azurev1.TypeURI:
+		var instance azurev1.Instance
+		err = node.Decode(&instance)
+		if err != nil {
+			return
+		}
+		metadata = &instance
+	case oraclecloudv2.TypeURI:
+		var instance oraclecloudv2.Instance
+		err = node.Decode(&instance)
+		if err != nil {
+			return
+		}
+		metadata = &instance
+	case hetznerv1.TypeURI:
+		var server hetznerv1.Server
+		err = node.Decode(&server)
+		if err != nil {
+			return
+		}
+		metadata = &server
+	case vultrv1.TypeURI:
+		var instance vultrv1.Instance
+		err = node.Decode(&instance)
+		if err != nil {
+			return
+		}
+		metadata = &instance
+	case linodev1.TypeURI:
+		var instance linodev1.Instance
+		err = node.Decode(&instance)
+		if err != nil {
+			return
+		}
+		metadata = &instance
+	case instancev1.TypeURI:
+		var instance instancev1.Instance
+		err = node.Decode(&instance)
+		if err != nil {
+			return
+		}
+		metadata = &instance
 	default:
 		err = errBadTypeURI
 		return
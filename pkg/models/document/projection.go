@@ -0,0 +1,96 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package document
+
+import (
+	ec2v1 "github.com/amari/cloud-metadata-server/pkg/models/amazonaws/ec2/v1"
+	instancev1 "github.com/amari/cloud-metadata-server/pkg/models/cleta/instance/v1"
+	digitaloceanv1 "github.com/amari/cloud-metadata-server/pkg/models/digitalocean/v1"
+	computev1 "github.com/amari/cloud-metadata-server/pkg/models/googleapis/compute/v1"
+	hetznerv1 "github.com/amari/cloud-metadata-server/pkg/models/hetzner/v1"
+	linodev1 "github.com/amari/cloud-metadata-server/pkg/models/linode/v1"
+	azurev1 "github.com/amari/cloud-metadata-server/pkg/models/microsoft/azure/v1"
+	openstackv1 "github.com/amari/cloud-metadata-server/pkg/models/openstack/v1"
+	oraclecloudv2 "github.com/amari/cloud-metadata-server/pkg/models/oraclecloud/v2"
+	vultrv1 "github.com/amari/cloud-metadata-server/pkg/models/vultr/v1"
+)
+
+// projectableTypeURIs are the kinds a `cleta.dev/instance/v1` document can be
+// projected into.
+var projectableTypeURIs = [...]string{
+	digitaloceanv1.TypeURI,
+	ec2v1.TypeURI,
+	computev1.TypeURI,
+	openstackv1.TypeURI,
+	azurev1.TypeURI,
+	oraclecloudv2.TypeURI,
+	hetznerv1.TypeURI,
+	vultrv1.TypeURI,
+	linodev1.TypeURI,
+}
+
+// SupportedTypeURIs returns every kind the document can be served as: its own
+// kind followed by the kinds it can be projected into.
+func (d *Document) SupportedTypeURIs() []string {
+	if d.Kind != instancev1.TypeURI {
+		return []string{d.Kind}
+	}
+	return append([]string{d.Kind}, projectableTypeURIs[:]...)
+}
+
+// Project returns the document as a document of the given kind. Documents
+// are returned unchanged when they already are of that kind.
+func (d *Document) Project(kind string) (*Document, error) {
+	if d.Kind == kind {
+		return d, nil
+	}
+
+	instance, ok := d.Contents.(*instancev1.Instance)
+	if !ok {
+		return nil, errBadTypeURI
+	}
+
+	var metadata Metadata
+	switch kind {
+	case digitaloceanv1.TypeURI:
+		metadata = instance.Droplet()
+	case ec2v1.TypeURI:
+		metadata = instance.EC2Instance()
+	case computev1.TypeURI:
+		metadata = instance.ComputeInstance()
+	case openstackv1.TypeURI:
+		metadata = instance.OpenStackInstance()
+	case azurev1.TypeURI:
+		metadata = instance.AzureInstance()
+	case oraclecloudv2.TypeURI:
+		metadata = instance.OracleCloudInstance()
+	case hetznerv1.TypeURI:
+		metadata = instance.HetznerServer()
+	case vultrv1.TypeURI:
+		metadata = instance.VultrInstance()
+	case linodev1.TypeURI:
+		metadata = instance.LinodeInstance()
+	default:
+		return nil, errBadTypeURI
+	}
+
+	return &Document{
+		Kind:      kind,
+		Namespace: d.Namespace,
+		Contents:  metadata,
+	}, nil
+}
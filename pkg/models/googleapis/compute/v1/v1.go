@@ -0,0 +1,90 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compute
+
+import (
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+)
+
+const TypeURI = "googleapis.com/compute/v1"
+
+type Instance struct {
+	ID                uint64             `json:"id" yaml:"id" toml:"id"`
+	Name              string             `json:"name" yaml:"name" toml:"name"`
+	Hostname          string             `json:"hostname" yaml:"hostname" toml:"hostname"`
+	Description       string             `json:"description,omitempty" yaml:"description,omitempty" toml:"description,omitempty"`
+	Zone              string             `json:"zone" yaml:"zone" toml:"zone"`
+	MachineType       string             `json:"machine_type" yaml:"machine_type" toml:"machine_type"`
+	Image             string             `json:"image,omitempty" yaml:"image,omitempty" toml:"image,omitempty"`
+	CPUPlatform       string             `json:"cpu_platform,omitempty" yaml:"cpu_platform,omitempty" toml:"cpu_platform,omitempty"`
+	Tags              []string           `json:"tags,omitempty" yaml:"tags,omitempty" toml:"tags,omitempty"`
+	Attributes        map[string]string  `json:"attributes,omitempty" yaml:"attributes,omitempty" toml:"attributes,omitempty"`
+	NetworkInterfaces []NetworkInterface `json:"network_interfaces" yaml:"network_interfaces" toml:"network_interfaces"`
+	Disks             []Disk             `json:"disks,omitempty" yaml:"disks,omitempty" toml:"disks,omitempty"`
+	ServiceAccounts   []ServiceAccount   `json:"service_accounts,omitempty" yaml:"service_accounts,omitempty" toml:"service_accounts,omitempty"`
+	Project           Project            `json:"project" yaml:"project" toml:"project"`
+}
+
+func (i *Instance) TypeURI() string {
+	return TypeURI
+}
+
+func (i *Instance) DataLinkAddrs() []model.DataLinkAddr {
+	res := make([]model.DataLinkAddr, 0, len(i.NetworkInterfaces))
+
+	for j := 0; j < len(i.NetworkInterfaces); j++ {
+		res = append(res, i.NetworkInterfaces[j].Mac)
+	}
+
+	return res
+}
+
+type NetworkInterface struct {
+	Mac           model.MACAddr  `json:"mac" yaml:"mac" toml:"mac"`
+	IP            model.IPv4     `json:"ip" yaml:"ip" toml:"ip"`
+	Network       string         `json:"network" yaml:"network" toml:"network"`
+	Gateway       model.IPv4     `json:"gateway,omitempty" yaml:"gateway,omitempty" toml:"gateway,omitempty"`
+	Subnetmask    model.IPv4Mask `json:"subnetmask,omitempty" yaml:"subnetmask,omitempty" toml:"subnetmask,omitempty"`
+	MTU           uint           `json:"mtu,omitempty" yaml:"mtu,omitempty" toml:"mtu,omitempty"`
+	DNSServers    []model.IPv4   `json:"dns_servers,omitempty" yaml:"dns_servers,omitempty" toml:"dns_servers,omitempty"`
+	ForwardedIPs  []model.IPv4   `json:"forwarded_ips,omitempty" yaml:"forwarded_ips,omitempty" toml:"forwarded_ips,omitempty"`
+	AccessConfigs []AccessConfig `json:"access_configs,omitempty" yaml:"access_configs,omitempty" toml:"access_configs,omitempty"`
+}
+
+type AccessConfig struct {
+	ExternalIP model.IPv4 `json:"external_ip" yaml:"external_ip" toml:"external_ip"`
+	// Type defaults to "ONE_TO_ONE_NAT".
+	Type string `json:"type,omitempty" yaml:"type,omitempty" toml:"type,omitempty"`
+}
+
+type Disk struct {
+	DeviceName string `json:"device_name" yaml:"device_name" toml:"device_name"`
+	Mode       string `json:"mode,omitempty" yaml:"mode,omitempty" toml:"mode,omitempty"`
+	Type       string `json:"type,omitempty" yaml:"type,omitempty" toml:"type,omitempty"`
+}
+
+type ServiceAccount struct {
+	Email   string   `json:"email" yaml:"email" toml:"email"`
+	Aliases []string `json:"aliases,omitempty" yaml:"aliases,omitempty" toml:"aliases,omitempty"`
+	Scopes  []string `json:"scopes,omitempty" yaml:"scopes,omitempty" toml:"scopes,omitempty"`
+}
+
+type Project struct {
+	ID         string            `json:"project_id" yaml:"project_id" toml:"project_id"`
+	NumericID  uint64            `json:"numeric_project_id" yaml:"numeric_project_id" toml:"numeric_project_id"`
+	Attributes map[string]string `json:"attributes,omitempty" yaml:"attributes,omitempty" toml:"attributes,omitempty"`
+}
@@ -0,0 +1,80 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hetzner
+
+import (
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+)
+
+const TypeURI = "hetzner.cloud/v1"
+
+type Server struct {
+	ID                uint64             `json:"instance_id" yaml:"instance_id" toml:"instance_id"`
+	Hostname          string             `json:"hostname" yaml:"hostname" toml:"hostname"`
+	Region            string             `json:"region" yaml:"region" toml:"region"`
+	AvailabilityZone  string             `json:"availability_zone" yaml:"availability_zone" toml:"availability_zone"`
+	PublicIPv4        model.IPv4         `json:"public_ipv4,omitempty" yaml:"public_ipv4,omitempty" toml:"public_ipv4,omitempty"`
+	PublicKeys        []string           `json:"public_keys,omitempty" yaml:"public_keys,omitempty" toml:"public_keys,omitempty"`
+	UserData          UserData           `json:"user_data,omitempty" yaml:"user_data,omitempty" toml:"user_data,omitempty"`
+	VendorData        VendorData         `json:"vendor_data,omitempty" yaml:"vendor_data,omitempty" toml:"vendor_data,omitempty"`
+	NetworkInterfaces []NetworkInterface `json:"network_interfaces" yaml:"network_interfaces" toml:"network_interfaces"`
+	PrivateNetworks   []PrivateNetwork   `json:"private_networks,omitempty" yaml:"private_networks,omitempty" toml:"private_networks,omitempty"`
+}
+
+func (s *Server) TypeURI() string {
+	return TypeURI
+}
+
+func (s *Server) DataLinkAddrs() []model.DataLinkAddr {
+	res := make([]model.DataLinkAddr, 0, len(s.NetworkInterfaces)+len(s.PrivateNetworks))
+
+	for i := 0; i < len(s.NetworkInterfaces); i++ {
+		res = append(res, s.NetworkInterfaces[i].Mac)
+	}
+
+	for i := 0; i < len(s.PrivateNetworks); i++ {
+		res = append(res, s.PrivateNetworks[i].Mac)
+	}
+
+	return res
+}
+
+type UserData string
+type VendorData string
+
+// A NetworkInterface is a public interface. IPv4 is configured with DHCP,
+// IPv6 statically when IPv6 is set.
+type NetworkInterface struct {
+	// Name defaults to "eth<index>".
+	Name        string        `json:"name,omitempty" yaml:"name,omitempty" toml:"name,omitempty"`
+	Mac         model.MACAddr `json:"mac" yaml:"mac" toml:"mac"`
+	IPv6        string        `json:"ipv6,omitempty" yaml:"ipv6,omitempty" toml:"ipv6,omitempty"`
+	IPv6Gateway string        `json:"ipv6_gateway,omitempty" yaml:"ipv6_gateway,omitempty" toml:"ipv6_gateway,omitempty"`
+}
+
+// A PrivateNetwork is an attachment to a Hetzner Cloud network.
+type PrivateNetwork struct {
+	IP           model.IPv4    `json:"ip" yaml:"ip" toml:"ip"`
+	AliasIPs     []model.IPv4  `json:"alias_ips,omitempty" yaml:"alias_ips,omitempty" toml:"alias_ips,omitempty"`
+	InterfaceNum uint          `json:"interface_num" yaml:"interface_num" toml:"interface_num"`
+	Mac          model.MACAddr `json:"mac" yaml:"mac" toml:"mac"`
+	NetworkID    uint64        `json:"network_id" yaml:"network_id" toml:"network_id"`
+	NetworkName  string        `json:"network_name" yaml:"network_name" toml:"network_name"`
+	Network      string        `json:"network" yaml:"network" toml:"network"`
+	Subnet       string        `json:"subnet" yaml:"subnet" toml:"subnet"`
+	Gateway      model.IPv4    `json:"gateway" yaml:"gateway" toml:"gateway"`
+}
@@ -0,0 +1,93 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package linode
+
+import (
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+)
+
+const TypeURI = "linode.com/v1"
+
+type Instance struct {
+	ID       uint64   `json:"id" yaml:"id" toml:"id"`
+	HostUUID string   `json:"host_uuid" yaml:"host_uuid" toml:"host_uuid"`
+	Label    string   `json:"label" yaml:"label" toml:"label"`
+	Region   string   `json:"region" yaml:"region" toml:"region"`
+	Type     string   `json:"type" yaml:"type" toml:"type"`
+	Tags     []string `json:"tags,omitempty" yaml:"tags,omitempty" toml:"tags,omitempty"`
+	Specs    Specs    `json:"specs" yaml:"specs" toml:"specs"`
+	Backups  Backups  `json:"backups" yaml:"backups" toml:"backups"`
+	// SSHKeys maps user names (e.g. "root") to their authorized keys.
+	SSHKeys           map[string][]string `json:"ssh_keys,omitempty" yaml:"ssh_keys,omitempty" toml:"ssh_keys,omitempty"`
+	UserData          UserData            `json:"user_data,omitempty" yaml:"user_data,omitempty" toml:"user_data,omitempty"`
+	NetworkInterfaces []NetworkInterface  `json:"interfaces" yaml:"interfaces" toml:"interfaces"`
+	IPv4              IPv4                `json:"ipv4" yaml:"ipv4" toml:"ipv4"`
+	IPv6              IPv6                `json:"ipv6,omitempty" yaml:"ipv6,omitempty" toml:"ipv6,omitempty"`
+}
+
+func (i *Instance) TypeURI() string {
+	return TypeURI
+}
+
+func (i *Instance) DataLinkAddrs() []model.DataLinkAddr {
+	res := make([]model.DataLinkAddr, 0, len(i.NetworkInterfaces))
+
+	for j := 0; j < len(i.NetworkInterfaces); j++ {
+		res = append(res, i.NetworkInterfaces[j].Mac)
+	}
+
+	return res
+}
+
+type UserData string
+
+type Specs struct {
+	VCPUs    uint `json:"vcpus" yaml:"vcpus" toml:"vcpus"`
+	Memory   uint `json:"memory" yaml:"memory" toml:"memory"`
+	GPUs     uint `json:"gpus" yaml:"gpus" toml:"gpus"`
+	Transfer uint `json:"transfer" yaml:"transfer" toml:"transfer"`
+	Disk     uint `json:"disk" yaml:"disk" toml:"disk"`
+}
+
+type Backups struct {
+	Enabled bool   `json:"enabled" yaml:"enabled" toml:"enabled"`
+	Status  string `json:"status,omitempty" yaml:"status,omitempty" toml:"status,omitempty"`
+}
+
+// A NetworkInterface is a configuration profile interface. Its MAC address
+// identifies the instance but is not served.
+type NetworkInterface struct {
+	Mac   model.MACAddr `json:"mac" yaml:"mac" toml:"mac"`
+	Label string        `json:"label,omitempty" yaml:"label,omitempty" toml:"label,omitempty"`
+	// Purpose is one of "public", "vlan" or "vpc". It defaults to "public".
+	Purpose     string `json:"purpose,omitempty" yaml:"purpose,omitempty" toml:"purpose,omitempty"`
+	IPAMAddress string `json:"ipam_address,omitempty" yaml:"ipam_address,omitempty" toml:"ipam_address,omitempty"`
+}
+
+// IPv4 holds the addresses of the instance in CIDR notation.
+type IPv4 struct {
+	Public  []string `json:"public,omitempty" yaml:"public,omitempty" toml:"public,omitempty"`
+	Private []string `json:"private,omitempty" yaml:"private,omitempty" toml:"private,omitempty"`
+	Shared  []string `json:"shared,omitempty" yaml:"shared,omitempty" toml:"shared,omitempty"`
+}
+
+type IPv6 struct {
+	SLAAC        string   `json:"slaac,omitempty" yaml:"slaac,omitempty" toml:"slaac,omitempty"`
+	LinkLocal    string   `json:"link_local,omitempty" yaml:"link_local,omitempty" toml:"link_local,omitempty"`
+	Ranges       []string `json:"ranges,omitempty" yaml:"ranges,omitempty" toml:"ranges,omitempty"`
+	SharedRanges []string `json:"shared_ranges,omitempty" yaml:"shared_ranges,omitempty" toml:"shared_ranges,omitempty"`
+}
@@ -22,8 +22,17 @@ import (
 
 	"gopkg.in/yaml.v3"
 
+	ec2_v1 "github.com/amari/cloud-metadata-server/pkg/models/amazonaws/ec2/v1"
+	instance_v1 "github.com/amari/cloud-metadata-server/pkg/models/cleta/instance/v1"
 	digitalocean_v1 "github.com/amari/cloud-metadata-server/pkg/models/digitalocean/v1"
+	compute_v1 "github.com/amari/cloud-metadata-server/pkg/models/googleapis/compute/v1"
+	hetzner_v1 "github.com/amari/cloud-metadata-server/pkg/models/hetzner/v1"
+	linode_v1 "github.com/amari/cloud-metadata-server/pkg/models/linode/v1"
+	azure_v1 "github.com/amari/cloud-metadata-server/pkg/models/microsoft/azure/v1"
 	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+	openstack_v1 "github.com/amari/cloud-metadata-server/pkg/models/openstack/v1"
+	oraclecloud_v2 "github.com/amari/cloud-metadata-server/pkg/models/oraclecloud/v2"
+	vultr_v1 "github.com/amari/cloud-metadata-server/pkg/models/vultr/v1"
 	"github.com/pelletier/go-toml"
 )
 
@@ -36,6 +45,24 @@ func UnmarshalMetadataJSON(typeURI string, data []byte) (metadata Metadata, err
 	switch typeURI {
 	case digitalocean_v1.TypeURI:
 		metadata = new(digitalocean_v1.Droplet)
+	case ec2_v1.TypeURI:
+		metadata = new(ec2_v1.Instance)
+	case compute_v1.TypeURI:
+		metadata = new(compute_v1.Instance)
+	case openstack_v1.TypeURI:
+		metadata = new(openstack_v1.Instance)
+	case azure_v1.TypeURI:
+		metadata = new(azure_v1.Instance)
+	case oraclecloud_v2.TypeURI:
+		metadata = new(oraclecloud_v2.Instance)
+	case hetzner_v1.TypeURI:
+		metadata = new(hetzner_v1.Server)
+	case vultr_v1.TypeURI:
+		metadata = new(vultr_v1.Instance)
+	case linode_v1.TypeURI:
+		metadata = new(linode_v1.Instance)
+	case instance_v1.TypeURI:
+		metadata = new(instance_v1.Instance)
 	default:
 		return nil, fmt.Errorf("unknown typeURI %v", typeURI)
 	}
@@ -56,6 +83,69 @@ func UnmarshalMetadataYAML(typeURI string, value *yaml.Node) (metadata Metadata,
 			return nil, err
 		}
 		metadata = &m
+	case ec2_v1.TypeURI:
+		var m ec2_v1.Instance
+		err = value.Decode(&m)
+		if err != nil {
+			return nil, err
+		}
+		metadata = &m
+	case compute_v1.TypeURI:
+		var m compute_v1.Instance
+		err = value.Decode(&m)
+		if err != nil {
+			return nil, err
+		}
+		metadata = &m
+	case openstack_v1.TypeURI:
+		var m openstack_v1.Instance
+		err = value.Decode(&m)
+		if err != nil {
+			return nil, err
+		}
+		metadata = &m
+	case azure_v1.TypeURI:
+		var m azure_v1.Instance
+		err = value.Decode(&m)
+		if err != nil {
+			return nil, err
+		}
+		metadata = &m
+	case oraclecloud_v2.TypeURI:
+		var m oraclecloud_v2.Instance
+		err = value.Decode(&m)
+		if err != nil {
+			return nil, err
+		}
+		metadata = &m
+	case hetzner_v1.TypeURI:
+		var m hetzner_v1.Server
+		err = value.Decode(&m)
+		if err != nil {
+			return nil, err
+		}
+		metadata = &m
+	case vultr_v1.TypeURI:
+		var m vultr_v1.Instance
+		err = value.Decode(&m)
+		if err != nil {
+			return nil, err
+		}
+		metadata = &m
+	case linode_v1.TypeURI:
+		var m linode_v1.Instance
+		err = value.Decode(&m)
+		if err != nil {
+			return nil, err
+		}
+		metadata = &m
+	case instance_v1.TypeURI:
+		var m instance_v1.Instance
+		err = value.Decode(&m)
+		if err != nil {
+			return nil, err
+		}
+		metadata = &m
 	default:
 		return nil, fmt.Errorf("unknown typeURI %v", typeURI)
 	}
@@ -71,6 +161,24 @@ func UnmarshalMetadataTOML(typeURI string, data []byte) (metadata Metadata, err
 	switch typeURI {
 	case digitalocean_v1.TypeURI:
 		metadata = new(digitalocean_v1.Droplet)
+	case ec2_v1.TypeURI:
+		metadata = new(ec2_v1.Instance)
+	case compute_v1.TypeURI:
+		metadata = new(compute_v1.Instance)
+	case openstack_v1.TypeURI:
+		metadata = new(openstack_v1.Instance)
+	case azure_v1.TypeURI:
+		metadata = new(azure_v1.Instance)
+	case oraclecloud_v2.TypeURI:
+		metadata = new(oraclecloud_v2.Instance)
+	case hetzner_v1.TypeURI:
+		metadata = new(hetzner_v1.Server)
+	case vultr_v1.TypeURI:
+		metadata = new(vultr_v1.Instance)
+	case linode_v1.TypeURI:
+		metadata = new(linode_v1.Instance)
+	case instance_v1.TypeURI:
+		metadata = new(instance_v1.Instance)
 	default:
 		return nil, fmt.Errorf("unknown typeURI %v", typeURI)
 	}
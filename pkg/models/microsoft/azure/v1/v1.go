@@ -0,0 +1,120 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package azure
+
+import (
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+)
+
+const TypeURI = "microsoft.com/azure/v1"
+
+type Instance struct {
+	Compute           Compute            `json:"compute" yaml:"compute" toml:"compute"`
+	NetworkInterfaces []NetworkInterface `json:"network_interfaces" yaml:"network_interfaces" toml:"network_interfaces"`
+	ScheduledEvents   ScheduledEvents    `json:"scheduled_events,omitempty" yaml:"scheduled_events,omitempty" toml:"scheduled_events,omitempty"`
+}
+
+func (i *Instance) TypeURI() string {
+	return TypeURI
+}
+
+func (i *Instance) DataLinkAddrs() []model.DataLinkAddr {
+	res := make([]model.DataLinkAddr, 0, len(i.NetworkInterfaces))
+
+	for j := 0; j < len(i.NetworkInterfaces); j++ {
+		res = append(res, i.NetworkInterfaces[j].Mac)
+	}
+
+	return res
+}
+
+type Compute struct {
+	VMID              string `json:"vm_id" yaml:"vm_id" toml:"vm_id"`
+	Name              string `json:"name" yaml:"name" toml:"name"`
+	Location          string `json:"location" yaml:"location" toml:"location"`
+	Zone              string `json:"zone,omitempty" yaml:"zone,omitempty" toml:"zone,omitempty"`
+	VMSize            string `json:"vm_size" yaml:"vm_size" toml:"vm_size"`
+	OSType            string `json:"os_type" yaml:"os_type" toml:"os_type"`
+	Publisher         string `json:"publisher,omitempty" yaml:"publisher,omitempty" toml:"publisher,omitempty"`
+	Offer             string `json:"offer,omitempty" yaml:"offer,omitempty" toml:"offer,omitempty"`
+	SKU               string `json:"sku,omitempty" yaml:"sku,omitempty" toml:"sku,omitempty"`
+	Version           string `json:"version,omitempty" yaml:"version,omitempty" toml:"version,omitempty"`
+	ResourceGroupName string `json:"resource_group_name" yaml:"resource_group_name" toml:"resource_group_name"`
+	SubscriptionID    string `json:"subscription_id" yaml:"subscription_id" toml:"subscription_id"`
+	ResourceID        string `json:"resource_id,omitempty" yaml:"resource_id,omitempty" toml:"resource_id,omitempty"`
+	// AzEnvironment defaults to "AzurePublicCloud".
+	AzEnvironment string            `json:"az_environment,omitempty" yaml:"az_environment,omitempty" toml:"az_environment,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty" yaml:"tags,omitempty" toml:"tags,omitempty"`
+	OSProfile     OSProfile         `json:"os_profile" yaml:"os_profile" toml:"os_profile"`
+	PublicKeys    []PublicKey       `json:"public_keys,omitempty" yaml:"public_keys,omitempty" toml:"public_keys,omitempty"`
+	// UserData is served base64 encoded, like Azure does.
+	UserData UserData `json:"user_data,omitempty" yaml:"user_data,omitempty" toml:"user_data,omitempty"`
+}
+
+type UserData string
+
+type OSProfile struct {
+	AdminUsername                 string `json:"admin_username" yaml:"admin_username" toml:"admin_username"`
+	ComputerName                  string `json:"computer_name" yaml:"computer_name" toml:"computer_name"`
+	DisablePasswordAuthentication bool   `json:"disable_password_authentication" yaml:"disable_password_authentication" toml:"disable_password_authentication"`
+}
+
+// A PublicKey is an OpenSSH public key and the path it is installed to.
+type PublicKey struct {
+	Path    string `json:"path" yaml:"path" toml:"path"`
+	KeyData string `json:"key_data" yaml:"key_data" toml:"key_data"`
+}
+
+type NetworkInterface struct {
+	Mac         model.MACAddr `json:"mac" yaml:"mac" toml:"mac"`
+	IPv4        []IPAddress   `json:"ipv4,omitempty" yaml:"ipv4,omitempty" toml:"ipv4,omitempty"`
+	IPv4Subnets []Subnet      `json:"ipv4_subnets,omitempty" yaml:"ipv4_subnets,omitempty" toml:"ipv4_subnets,omitempty"`
+	IPv6        []IPAddress   `json:"ipv6,omitempty" yaml:"ipv6,omitempty" toml:"ipv6,omitempty"`
+	IPv6Subnets []Subnet      `json:"ipv6_subnets,omitempty" yaml:"ipv6_subnets,omitempty" toml:"ipv6_subnets,omitempty"`
+}
+
+// An IPAddress is a private address and the public address, if any, that
+// is mapped to it. Addresses are kept as strings since the same type is used
+// for both families.
+type IPAddress struct {
+	Private string `json:"private" yaml:"private" toml:"private"`
+	Public  string `json:"public,omitempty" yaml:"public,omitempty" toml:"public,omitempty"`
+}
+
+type Subnet struct {
+	Address string `json:"address" yaml:"address" toml:"address"`
+	Prefix  string `json:"prefix" yaml:"prefix" toml:"prefix"`
+}
+
+type ScheduledEvents struct {
+	DocumentIncarnation uint             `json:"document_incarnation" yaml:"document_incarnation" toml:"document_incarnation"`
+	Events              []ScheduledEvent `json:"events,omitempty" yaml:"events,omitempty" toml:"events,omitempty"`
+}
+
+// A ScheduledEvent is an upcoming maintenance event, e.g. "Reboot" or
+// "Freeze".
+type ScheduledEvent struct {
+	EventID           string   `json:"event_id" yaml:"event_id" toml:"event_id"`
+	EventType         string   `json:"event_type" yaml:"event_type" toml:"event_type"`
+	ResourceType      string   `json:"resource_type,omitempty" yaml:"resource_type,omitempty" toml:"resource_type,omitempty"`
+	Resources         []string `json:"resources,omitempty" yaml:"resources,omitempty" toml:"resources,omitempty"`
+	EventStatus       string   `json:"event_status,omitempty" yaml:"event_status,omitempty" toml:"event_status,omitempty"`
+	NotBefore         string   `json:"not_before,omitempty" yaml:"not_before,omitempty" toml:"not_before,omitempty"`
+	Description       string   `json:"description,omitempty" yaml:"description,omitempty" toml:"description,omitempty"`
+	EventSource       string   `json:"event_source,omitempty" yaml:"event_source,omitempty" toml:"event_source,omitempty"`
+	DurationInSeconds int      `json:"duration_in_seconds,omitempty" yaml:"duration_in_seconds,omitempty" toml:"duration_in_seconds,omitempty"`
+}
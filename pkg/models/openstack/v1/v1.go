@@ -0,0 +1,109 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package openstack
+
+import (
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+)
+
+const TypeURI = "openstack.org/v1"
+
+type Instance struct {
+	UUID             string            `json:"uuid" yaml:"uuid" toml:"uuid"`
+	Name             string            `json:"name" yaml:"name" toml:"name"`
+	Hostname         string            `json:"hostname" yaml:"hostname" toml:"hostname"`
+	AvailabilityZone string            `json:"availability_zone" yaml:"availability_zone" toml:"availability_zone"`
+	ProjectID        string            `json:"project_id" yaml:"project_id" toml:"project_id"`
+	LaunchIndex      uint              `json:"launch_index" yaml:"launch_index" toml:"launch_index"`
+	Flavor           string            `json:"flavor,omitempty" yaml:"flavor,omitempty" toml:"flavor,omitempty"`
+	ImageID          string            `json:"image_id,omitempty" yaml:"image_id,omitempty" toml:"image_id,omitempty"`
+	Meta             map[string]string `json:"meta,omitempty" yaml:"meta,omitempty" toml:"meta,omitempty"`
+	PublicKeys       []PublicKey       `json:"public_keys,omitempty" yaml:"public_keys,omitempty" toml:"public_keys,omitempty"`
+	UserData         UserData          `json:"user_data,omitempty" yaml:"user_data,omitempty" toml:"user_data,omitempty"`
+	// VendorData and VendorData2 are served verbatim as vendor_data.json and
+	// vendor_data2.json.
+	VendorData  map[string]interface{} `json:"vendor_data,omitempty" yaml:"vendor_data,omitempty" toml:"vendor_data,omitempty"`
+	VendorData2 map[string]interface{} `json:"vendor_data2,omitempty" yaml:"vendor_data2,omitempty" toml:"vendor_data2,omitempty"`
+	NetworkData NetworkData            `json:"network_data" yaml:"network_data" toml:"network_data"`
+}
+
+func (i *Instance) TypeURI() string {
+	return TypeURI
+}
+
+func (i *Instance) DataLinkAddrs() []model.DataLinkAddr {
+	res := make([]model.DataLinkAddr, 0, len(i.NetworkData.Links))
+
+	for j := 0; j < len(i.NetworkData.Links); j++ {
+		res = append(res, i.NetworkData.Links[j].EthernetMacAddress)
+	}
+
+	return res
+}
+
+type UserData string
+
+// A PublicKey is a key pair registered with the instance. Type defaults to
+// "ssh".
+type PublicKey struct {
+	Name string `json:"name" yaml:"name" toml:"name"`
+	Type string `json:"type,omitempty" yaml:"type,omitempty" toml:"type,omitempty"`
+	Data string `json:"data" yaml:"data" toml:"data"`
+}
+
+// NetworkData is served as network_data.json. The field names follow the
+// format consumed by cloud-init.
+type NetworkData struct {
+	Links    []Link    `json:"links" yaml:"links" toml:"links"`
+	Networks []Network `json:"networks" yaml:"networks" toml:"networks"`
+	Services []Service `json:"services" yaml:"services" toml:"services"`
+}
+
+// A Link is a layer 2 interface. Type defaults to "phy".
+type Link struct {
+	ID                 string        `json:"id" yaml:"id" toml:"id"`
+	Type               string        `json:"type,omitempty" yaml:"type,omitempty" toml:"type,omitempty"`
+	EthernetMacAddress model.MACAddr `json:"ethernet_mac_address" yaml:"ethernet_mac_address" toml:"ethernet_mac_address"`
+	MTU                uint          `json:"mtu,omitempty" yaml:"mtu,omitempty" toml:"mtu,omitempty"`
+	VifID              string        `json:"vif_id,omitempty" yaml:"vif_id,omitempty" toml:"vif_id,omitempty"`
+}
+
+// A Network is a layer 3 network configured on a link. Type is one of
+// "ipv4", "ipv6", "ipv4_dhcp", "ipv6_dhcp", "ipv6_slaac", ... Addresses are
+// kept as strings since a network may be of either family.
+type Network struct {
+	ID        string    `json:"id" yaml:"id" toml:"id"`
+	Type      string    `json:"type" yaml:"type" toml:"type"`
+	Link      string    `json:"link" yaml:"link" toml:"link"`
+	NetworkID string    `json:"network_id,omitempty" yaml:"network_id,omitempty" toml:"network_id,omitempty"`
+	IPAddress string    `json:"ip_address,omitempty" yaml:"ip_address,omitempty" toml:"ip_address,omitempty"`
+	Netmask   string    `json:"netmask,omitempty" yaml:"netmask,omitempty" toml:"netmask,omitempty"`
+	Routes    []Route   `json:"routes,omitempty" yaml:"routes,omitempty" toml:"routes,omitempty"`
+	Services  []Service `json:"services,omitempty" yaml:"services,omitempty" toml:"services,omitempty"`
+}
+
+type Route struct {
+	Network string `json:"network" yaml:"network" toml:"network"`
+	Netmask string `json:"netmask" yaml:"netmask" toml:"netmask"`
+	Gateway string `json:"gateway" yaml:"gateway" toml:"gateway"`
+}
+
+// A Service is a network service such as a DNS server.
+type Service struct {
+	Type    string `json:"type" yaml:"type" toml:"type"`
+	Address string `json:"address" yaml:"address" toml:"address"`
+}
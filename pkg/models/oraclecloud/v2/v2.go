@@ -0,0 +1,97 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oraclecloud
+
+import (
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+)
+
+const TypeURI = "oraclecloud.com/v2"
+
+type Instance struct {
+	ID                  string      `json:"id" yaml:"id" toml:"id"`
+	DisplayName         string      `json:"display_name" yaml:"display_name" toml:"display_name"`
+	Hostname            string      `json:"hostname" yaml:"hostname" toml:"hostname"`
+	CompartmentID       string      `json:"compartment_id" yaml:"compartment_id" toml:"compartment_id"`
+	AvailabilityDomain  string      `json:"availability_domain" yaml:"availability_domain" toml:"availability_domain"`
+	FaultDomain         string      `json:"fault_domain,omitempty" yaml:"fault_domain,omitempty" toml:"fault_domain,omitempty"`
+	Region              string      `json:"region" yaml:"region" toml:"region"`
+	CanonicalRegionName string      `json:"canonical_region_name" yaml:"canonical_region_name" toml:"canonical_region_name"`
+	RegionInfo          RegionInfo  `json:"region_info,omitempty" yaml:"region_info,omitempty" toml:"region_info,omitempty"`
+	Image               string      `json:"image" yaml:"image" toml:"image"`
+	Shape               string      `json:"shape" yaml:"shape" toml:"shape"`
+	ShapeConfig         ShapeConfig `json:"shape_config,omitempty" yaml:"shape_config,omitempty" toml:"shape_config,omitempty"`
+	// State defaults to "Running".
+	State string `json:"state,omitempty" yaml:"state,omitempty" toml:"state,omitempty"`
+	// TimeCreated is in milliseconds since the epoch.
+	TimeCreated       int64                        `json:"time_created,omitempty" yaml:"time_created,omitempty" toml:"time_created,omitempty"`
+	SSHAuthorizedKeys []string                     `json:"ssh_authorized_keys,omitempty" yaml:"ssh_authorized_keys,omitempty" toml:"ssh_authorized_keys,omitempty"`
+	UserData          UserData                     `json:"user_data,omitempty" yaml:"user_data,omitempty" toml:"user_data,omitempty"`
+	Metadata          map[string]string            `json:"metadata,omitempty" yaml:"metadata,omitempty" toml:"metadata,omitempty"`
+	FreeformTags      map[string]string            `json:"freeform_tags,omitempty" yaml:"freeform_tags,omitempty" toml:"freeform_tags,omitempty"`
+	DefinedTags       map[string]map[string]string `json:"defined_tags,omitempty" yaml:"defined_tags,omitempty" toml:"defined_tags,omitempty"`
+	VNICs             []VNIC                       `json:"vnics" yaml:"vnics" toml:"vnics"`
+	Identity          Identity                     `json:"identity,omitempty" yaml:"identity,omitempty" toml:"identity,omitempty"`
+}
+
+func (i *Instance) TypeURI() string {
+	return TypeURI
+}
+
+func (i *Instance) DataLinkAddrs() []model.DataLinkAddr {
+	res := make([]model.DataLinkAddr, 0, len(i.VNICs))
+
+	for j := 0; j < len(i.VNICs); j++ {
+		res = append(res, i.VNICs[j].Mac)
+	}
+
+	return res
+}
+
+// UserData is served base64 encoded as `metadata/user_data`, like OCI does.
+type UserData string
+
+type RegionInfo struct {
+	RealmKey             string `json:"realm_key" yaml:"realm_key" toml:"realm_key"`
+	RealmDomainComponent string `json:"realm_domain_component" yaml:"realm_domain_component" toml:"realm_domain_component"`
+	RegionKey            string `json:"region_key" yaml:"region_key" toml:"region_key"`
+	RegionIdentifier     string `json:"region_identifier" yaml:"region_identifier" toml:"region_identifier"`
+}
+
+type ShapeConfig struct {
+	OCPUs                     float64 `json:"ocpus" yaml:"ocpus" toml:"ocpus"`
+	MemoryInGBs               float64 `json:"memory_in_gbs" yaml:"memory_in_gbs" toml:"memory_in_gbs"`
+	NetworkingBandwidthInGbps float64 `json:"networking_bandwidth_in_gbps,omitempty" yaml:"networking_bandwidth_in_gbps,omitempty" toml:"networking_bandwidth_in_gbps,omitempty"`
+	MaxVNICAttachments        uint    `json:"max_vnic_attachments,omitempty" yaml:"max_vnic_attachments,omitempty" toml:"max_vnic_attachments,omitempty"`
+}
+
+type VNIC struct {
+	ID              string        `json:"vnic_id" yaml:"vnic_id" toml:"vnic_id"`
+	Mac             model.MACAddr `json:"mac" yaml:"mac" toml:"mac"`
+	PrivateIP       model.IPv4    `json:"private_ip" yaml:"private_ip" toml:"private_ip"`
+	VirtualRouterIP model.IPv4    `json:"virtual_router_ip" yaml:"virtual_router_ip" toml:"virtual_router_ip"`
+	SubnetCIDRBlock string        `json:"subnet_cidr_block" yaml:"subnet_cidr_block" toml:"subnet_cidr_block"`
+	VLANTag         uint          `json:"vlan_tag,omitempty" yaml:"vlan_tag,omitempty" toml:"vlan_tag,omitempty"`
+	NICIndex        uint          `json:"nic_index,omitempty" yaml:"nic_index,omitempty" toml:"nic_index,omitempty"`
+}
+
+// Identity holds the PEM encoded instance principal certificate chain.
+type Identity struct {
+	Cert         string `json:"cert,omitempty" yaml:"cert,omitempty" toml:"cert,omitempty"`
+	Key          string `json:"key,omitempty" yaml:"key,omitempty" toml:"key,omitempty"`
+	Intermediate string `json:"intermediate,omitempty" yaml:"intermediate,omitempty" toml:"intermediate,omitempty"`
+}
@@ -0,0 +1,77 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vultr
+
+import (
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+)
+
+const TypeURI = "vultr.com/v1"
+
+type Instance struct {
+	InstanceID        string             `json:"instance_id" yaml:"instance_id" toml:"instance_id"`
+	InstanceV2ID      string             `json:"instance_v2_id" yaml:"instance_v2_id" toml:"instance_v2_id"`
+	Hostname          string             `json:"hostname" yaml:"hostname" toml:"hostname"`
+	Region            string             `json:"region" yaml:"region" toml:"region"`
+	PublicKeys        []string           `json:"public_keys,omitempty" yaml:"public_keys,omitempty" toml:"public_keys,omitempty"`
+	Tags              []string           `json:"tags,omitempty" yaml:"tags,omitempty" toml:"tags,omitempty"`
+	UserData          UserData           `json:"user_data,omitempty" yaml:"user_data,omitempty" toml:"user_data,omitempty"`
+	NetworkInterfaces []NetworkInterface `json:"interfaces" yaml:"interfaces" toml:"interfaces"`
+}
+
+func (i *Instance) TypeURI() string {
+	return TypeURI
+}
+
+func (i *Instance) DataLinkAddrs() []model.DataLinkAddr {
+	res := make([]model.DataLinkAddr, 0, len(i.NetworkInterfaces))
+
+	for j := 0; j < len(i.NetworkInterfaces); j++ {
+		res = append(res, i.NetworkInterfaces[j].Mac)
+	}
+
+	return res
+}
+
+type UserData string
+
+const (
+	NetworkTypePublic  = "public"
+	NetworkTypePrivate = "private"
+)
+
+type NetworkInterface struct {
+	Mac model.MACAddr `json:"mac" yaml:"mac" toml:"mac"`
+	// NetworkType is either "public" or "private". It defaults to "public".
+	NetworkType string    `json:"network_type,omitempty" yaml:"network_type,omitempty" toml:"network_type,omitempty"`
+	NetworkID   string    `json:"network_id,omitempty" yaml:"network_id,omitempty" toml:"network_id,omitempty"`
+	IPv4        *IPv4Addr `json:"ipv4,omitempty" yaml:"ipv4,omitempty" toml:"ipv4,omitempty"`
+	IPv6        *IPv6Addr `json:"ipv6,omitempty" yaml:"ipv6,omitempty" toml:"ipv6,omitempty"`
+}
+
+type IPv4Addr struct {
+	Address    model.IPv4     `json:"address" yaml:"address" toml:"address"`
+	Netmask    model.IPv4Mask `json:"netmask" yaml:"netmask" toml:"netmask"`
+	Gateway    model.IPv4     `json:"gateway,omitempty" yaml:"gateway,omitempty" toml:"gateway,omitempty"`
+	Additional []IPv4Addr     `json:"additional,omitempty" yaml:"additional,omitempty" toml:"additional,omitempty"`
+}
+
+type IPv6Addr struct {
+	Address model.IPv6          `json:"address" yaml:"address" toml:"address"`
+	Network model.IPv6          `json:"network" yaml:"network" toml:"network"`
+	Prefix  model.IPv6PrefixLen `json:"prefix" yaml:"prefix" toml:"prefix"`
+}
@@ -17,53 +17,124 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/amari/cloud-metadata-server/pkg/core"
 	"github.com/amari/cloud-metadata-server/pkg/models/document"
 	"github.com/amari/cloud-metadata-server/pkg/models/metadata"
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
 	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 
 	lru "github.com/hashicorp/golang-lru"
 )
 
+// settleDelay is how long a DirStore waits after a change before scanning.
+// Writing a temporary file and renaming it over a document, or removing and
+// creating it again, is then seen as one change.
+const settleDelay = 100 * time.Millisecond
+
 // A DirStore is a store backed by one or more filesystem directories.
+// Requests read an immutable snapshot of the index and never wait for a reload.
 type DirStore struct {
 	*core.Server
 
 	doneCh chan struct{}
 
-	m *sync.RWMutex
+	// strict refuses to serve data-link addresses with conflicting documents
+	strict bool
+
+	// m serializes changes to the index, readers never take it
+	m *sync.Mutex
 
 	watcher *fsnotify.Watcher
-	paths   map[string]struct{}
+	// scanM serializes scans, and guards paths and dirs
+	scanM *sync.Mutex
+	// paths are the paths added, in order of precedence
+	paths []string
+	// dirs are the directories being watched
+	dirs map[string]struct{}
+	// FilePath to what the file was indexed as
+	files map[string]*indexedFile
+	// CanonicalDataLinkAddr to the FilePaths naming it
+	filePathsForDataLinkAddr map[string]map[string]struct{}
+	// index is the current *dirIndex
+	index atomic.Value
+	// Cache fileRef to *document.Document. Entries are never stale, a
+	// changed file has a new hash.
+	documentCache  *lru.Cache
+	cacheHits      uint64
+	cacheMisses    uint64
+	cacheEvictions uint64
+
+	notifier *changeNotifier
+}
+
+// CacheStats counts how the document cache of a DirStore has done since it
+// was created.
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	// Len is the number of documents cached now.
+	Len int `json:"len"`
+}
+
+// A fileRef names the contents of a file at the time it was read.
+type fileRef struct {
+	path string
+	// hash is the SHA-256 of the contents
+	hash string
+}
+
+// A dirIndex is a snapshot of what every directory holds. It's never modified
+// once published, a change publishes a new one.
+type dirIndex struct {
 	// CanonicalDataLinkAddr to []typeURIsForDataLinkAddr
 	typeURIsForDataLinkAddr map[string][]string
-	// FilePath to []CanonicalDataLinkAddr
-	dataLinkAddrsForFilePath map[string][]string
-	// (CanonicalDataLinkAddr, TypeURI) to FilePath
-	filePathForDataLinkAddrAndTypeURI map[string]map[string]string
-	// Cache FilePath to model.Metadata
-	documentCache *lru.ARCCache
+	// (CanonicalDataLinkAddr, TypeURI) to the file
+	fileForDataLinkAddrAndTypeURI map[string]map[string]fileRef
+	// CanonicalDataLinkAddr to the kinds more than one file claims it as
+	conflictsForDataLinkAddr map[string][]Conflict
+}
 
-	// CanonicalDataLinkAddr to FilePath
-	// filePathForDataLinkAddr map[string]string
+// An indexedFile is what the index needs to know about a file.
+type indexedFile struct {
+	// rank is the index of the added path the file is under, files under
+	// paths added first take precedence
+	rank              int
+	hash              string
+	namespace         string
+	typeURI           string
+	supportedTypeURIs []string
+	// canonicalDataLinkAddrs are the keys of the data-link addresses the
+	// document is for
+	canonicalDataLinkAddrs []string
 }
 
-func NewDirStore(c *core.Server, cacheSize int) (*DirStore, error) {
+// NewDirStore creates an empty store, see AddPath. If strict is set, data-link
+// addresses that more than one document claims as the same kind aren't
+// served, otherwise the first document in the order paths were added, then
+// by file path, is.
+func NewDirStore(c *core.Server, cacheSize int, strict bool) (*DirStore, error) {
 	w, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, err
 	}
 
-	cache, err := lru.NewARC(cacheSize)
+	cache, err := lru.New(cacheSize)
 	if err != nil {
 		return nil, err
 	}
@@ -71,30 +142,64 @@ func NewDirStore(c *core.Server, cacheSize int) (*DirStore, error) {
 	store := &DirStore{
 		Server: c,
 
-		doneCh:                            make(chan struct{}),
-		m:                                 &sync.RWMutex{},
-		watcher:                           w,
-		paths:                             map[string]struct{}{},
-		typeURIsForDataLinkAddr:           map[string][]string{},
-		dataLinkAddrsForFilePath:          map[string][]string{},
-		filePathForDataLinkAddrAndTypeURI: map[string]map[string]string{},
-		documentCache:                     cache,
+		doneCh:                   make(chan struct{}),
+		strict:                   strict,
+		m:                        &sync.Mutex{},
+		watcher:                  w,
+		scanM:                    &sync.Mutex{},
+		dirs:                     map[string]struct{}{},
+		files:                    map[string]*indexedFile{},
+		filePathsForDataLinkAddr: map[string]map[string]struct{}{},
+		documentCache:            cache,
+		notifier:                 newChangeNotifier(),
 	}
+	store.index.Store(&dirIndex{
+		typeURIsForDataLinkAddr:       map[string][]string{},
+		fileForDataLinkAddrAndTypeURI: map[string]map[string]fileRef{},
+		conflictsForDataLinkAddr:      map[string][]Conflict{},
+	})
 
 	go func(s *DirStore) {
 		defer s.watcher.Close()
+
+		// paths to scan once things settle
+		pending := map[string]struct{}{}
+		settle := time.NewTimer(settleDelay)
+		settle.Stop()
+
 		for {
 			select {
 			case <-s.doneCh:
 				return
-			case event, _ := <-s.watcher.Events:
-				if event.Op&fsnotify.Create == fsnotify.Create {
-					s.didAddFile(event.Name)
-				} else if event.Op&fsnotify.Chmod == fsnotify.Chmod || event.Op&fsnotify.Write == fsnotify.Write {
-					s.didChangeFile(event.Name)
-				} else if event.Op&fsnotify.Rename == fsnotify.Rename || event.Op&fsnotify.Remove == fsnotify.Remove {
-					s.didRemoveFile(event.Name)
+			case event, ok := <-s.watcher.Events:
+				if !ok {
+					return
 				}
+				path := event.Name
+				if strings.HasPrefix(filepath.Base(path), ".") {
+					// e.g. Kubernetes updates a ConfigMap by swapping the
+					// ..data symlink the files next to it resolve through
+					path = filepath.Dir(path)
+				}
+				pending[path] = struct{}{}
+				settle.Reset(settleDelay)
+			case err, ok := <-s.watcher.Errors:
+				if !ok {
+					return
+				}
+				// events may have been dropped, start over
+				s.Log().Warn("failed to watch directory store", zap.NamedError("error", err))
+				s.scanM.Lock()
+				for _, path := range s.paths {
+					pending[path] = struct{}{}
+				}
+				s.scanM.Unlock()
+				settle.Reset(settleDelay)
+			case <-settle.C:
+				for path := range pending {
+					s.scan(path)
+				}
+				pending = map[string]struct{}{}
 			}
 		}
 	}(store)
@@ -108,132 +213,486 @@ func (s *DirStore) Close(path string) error {
 	return nil
 }
 
+// AddPath indexes the documents under path and keeps them up to date.
+// Subdirectories and symbolic links are followed, names starting with a dot
+// are skipped.
 func (s *DirStore) AddPath(path string) error {
-	_, err := os.Stat(path)
-	if err != nil {
+	path = filepath.Clean(path)
+	if _, err := os.Stat(path); err != nil {
 		return err
 	}
 
-	filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
-		if info.Mode().IsRegular() {
-			s.didAddFile(path)
-		}
-		return err
-	})
-
-	if err := s.watcher.Add(path); err != nil {
+	s.scanM.Lock()
+	if !s.isPath(path) {
+		s.paths = append(s.paths, path)
+	}
+	err := s.watch(path)
+	s.scanM.Unlock()
+	if err != nil {
 		return err
 	}
 
+	s.scan(path)
+
 	return nil
 }
 
-func (s *DirStore) didAddFile(path string) {
-	file, err := readDocumentFromFile(path)
+// A dirScan is what a scan found.
+type dirScan struct {
+	// files are the paths of the document files
+	files map[string]struct{}
+	// dirs are the paths of the directories
+	dirs map[string]struct{}
+	// realDirs are the directories after resolving symbolic links
+	realDirs map[string]struct{}
+}
+
+// scan brings the index up to date with path and everything under it.
+func (s *DirStore) scan(path string) {
+	s.scanM.Lock()
+	defer s.scanM.Unlock()
+
+	found := &dirScan{
+		files:    map[string]struct{}{},
+		dirs:     map[string]struct{}{},
+		realDirs: map[string]struct{}{},
+	}
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			s.walk(path, found)
+		} else if info.Mode().IsRegular() && isDocumentFile(path) {
+			found.files[path] = struct{}{}
+		}
+	}
+
+	filePaths := make([]string, 0, len(found.files))
+	for filePath := range found.files {
+		filePaths = append(filePaths, filePath)
+	}
+	sort.Strings(filePaths)
+	for _, filePath := range filePaths {
+		s.didChangeFile(filePath, s.rank(filePath))
+	}
+	for _, filePath := range s.filePathsUnder(path) {
+		if _, ok := found.files[filePath]; !ok {
+			s.didRemoveFile(filePath)
+		}
+	}
+	for dir := range s.dirs {
+		if _, ok := found.dirs[dir]; !ok && isUnder(dir, path) {
+			if s.isPath(dir) {
+				continue
+			}
+			// the watch is gone if the directory is
+			s.watcher.Remove(dir)
+			delete(s.dirs, dir)
+		}
+	}
+}
+
+// walk finds the document files under dir and watches the directories on
+// the way. The caller must hold scanM.
+func (s *DirStore) walk(dir string, found *dirScan) {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return
+	}
+	if _, ok := found.realDirs[realDir]; ok {
+		// a symbolic link loop, or a second link to the directory
+		return
+	}
+	found.realDirs[realDir] = struct{}{}
+	found.dirs[dir] = struct{}{}
+
+	if err := s.watch(dir); err != nil {
+		s.Log().Warn("failed to watch directory", zap.NamedError("error", err), zap.String("path", dir))
+	}
+
+	infos, err := ioutil.ReadDir(dir)
 	if err != nil {
-		//s.Log().Error(err.Error())
 		return
 	}
-	canonicalDataLinkAddrs := []string{}
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, info.Name())
+		if info.Mode()&os.ModeSymlink == os.ModeSymlink {
+			if info, err = os.Stat(path); err != nil {
+				// dangling
+				continue
+			}
+		}
+		if info.IsDir() {
+			s.walk(path, found)
+		} else if info.Mode().IsRegular() && isDocumentFile(path) {
+			found.files[path] = struct{}{}
+		}
+	}
+}
+
+// rank returns the index of the first added path that path is under, or -1.
+// The caller must hold scanM.
+func (s *DirStore) rank(path string) int {
+	for i, root := range s.paths {
+		if isUnder(path, root) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// isPath reports whether path was added. The caller must hold scanM.
+func (s *DirStore) isPath(path string) bool {
+	for _, root := range s.paths {
+		if root == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watch watches path, if it isn't already. The caller must hold scanM.
+func (s *DirStore) watch(path string) error {
+	if _, ok := s.dirs[path]; ok {
+		return nil
+	}
+	if err := s.watcher.Add(path); err != nil {
+		return err
+	}
+	s.dirs[path] = struct{}{}
 
+	return nil
+}
+
+// filePathsUnder returns the indexed files that are path or under it.
+func (s *DirStore) filePathsUnder(path string) []string {
 	s.m.Lock()
 	defer s.m.Unlock()
 
-	for _, dataLinkAddr := range file.Contents.DataLinkAddrs() {
-		canonicalDataLinkAddr := dataLinkAddr.CanonicalString()
-		canonicalDataLinkAddrs = append(canonicalDataLinkAddrs, canonicalDataLinkAddr)
-		s.typeURIsForDataLinkAddr[canonicalDataLinkAddr] = append(s.typeURIsForDataLinkAddr[canonicalDataLinkAddr], file.TypeURI())
-		if filePathForTypeURI, ok := s.filePathForDataLinkAddrAndTypeURI[canonicalDataLinkAddr]; ok {
-			filePathForTypeURI[file.TypeURI()] = path
-		} else {
-			s.filePathForDataLinkAddrAndTypeURI[canonicalDataLinkAddr] = map[string]string{
-				file.TypeURI(): path,
-			}
+	var ret []string
+	for filePath := range s.files {
+		if isUnder(filePath, path) {
+			ret = append(ret, filePath)
 		}
-		s.documentCache.Remove(canonicalDataLinkAddr)
 	}
-	s.dataLinkAddrsForFilePath[path] = canonicalDataLinkAddrs
 
-	fmt.Printf("didAddFile(%v)\n", path)
+	return ret
 }
 
-func (s *DirStore) didChangeFile(path string) {
-	file, err := readDocumentFromFile(path)
+// isUnder reports whether path is dir or is in it.
+func isUnder(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+func (s *DirStore) didChangeFile(path string, rank int) {
+	file, hash, err := readDocumentFromFile(path)
 	if err != nil {
-		//s.Log().Error(err.Error())
+		s.Log().Warn("failed to read document", zap.NamedError("error", err), zap.String("path", path))
+		return
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if old, ok := s.files[path]; ok && old.hash == hash && old.rank == rank {
+		// e.g. a chmod, or a write of the same contents
 		return
 	}
+	s.setFile(path, newIndexedFile(file, hash, rank))
+	// it was just read, it's likely to be asked for
+	s.cacheDocument(fileRef{path, hash}, file)
+}
 
+func (s *DirStore) didRemoveFile(path string) {
 	s.m.Lock()
 	defer s.m.Unlock()
 
-	s.documentCache.Remove(path)
+	s.setFile(path, nil)
+}
+
+func newIndexedFile(file *document.Document, hash string, rank int) *indexedFile {
+	ret := &indexedFile{
+		rank:              rank,
+		hash:              hash,
+		namespace:         file.Namespace,
+		typeURI:           file.TypeURI(),
+		supportedTypeURIs: file.SupportedTypeURIs(),
+	}
 
-	// remove
-	if dataLinkAddrs, ok := s.dataLinkAddrsForFilePath[path]; ok {
-		for _, dataLinkAddr := range dataLinkAddrs {
-			delete(s.typeURIsForDataLinkAddr, dataLinkAddr)
-			delete(s.filePathForDataLinkAddrAndTypeURI, dataLinkAddr)
+	seen := map[string]struct{}{}
+	for _, dataLinkAddr := range file.Contents.DataLinkAddrs() {
+		canonicalDataLinkAddr := Key(file.Namespace, dataLinkAddr.CanonicalString())
+		if _, ok := seen[canonicalDataLinkAddr]; ok {
+			continue
 		}
-		delete(s.dataLinkAddrsForFilePath, path)
+		seen[canonicalDataLinkAddr] = struct{}{}
+		ret.canonicalDataLinkAddrs = append(ret.canonicalDataLinkAddrs, canonicalDataLinkAddr)
 	}
 
-	// add
+	return ret
+}
 
-	canonicalDataLinkAddrs := []string{}
+// setFile replaces what path was indexed as, nil removes it, then publishes
+// a new snapshot of the index. The caller must hold the lock.
+func (s *DirStore) setFile(path string, file *indexedFile) {
+	changed := map[string]struct{}{}
+
+	if old, ok := s.files[path]; ok {
+		// nothing refers to the old contents anymore
+		s.documentCache.Remove(fileRef{path, old.hash})
+		for _, canonicalDataLinkAddr := range old.canonicalDataLinkAddrs {
+			delete(s.filePathsForDataLinkAddr[canonicalDataLinkAddr], path)
+			if len(s.filePathsForDataLinkAddr[canonicalDataLinkAddr]) == 0 {
+				delete(s.filePathsForDataLinkAddr, canonicalDataLinkAddr)
+			}
+			changed[canonicalDataLinkAddr] = struct{}{}
+		}
+		delete(s.files, path)
+	}
+	if file != nil {
+		for _, canonicalDataLinkAddr := range file.canonicalDataLinkAddrs {
+			filePaths, ok := s.filePathsForDataLinkAddr[canonicalDataLinkAddr]
+			if !ok {
+				filePaths = map[string]struct{}{}
+				s.filePathsForDataLinkAddr[canonicalDataLinkAddr] = filePaths
+			}
+			filePaths[path] = struct{}{}
+			changed[canonicalDataLinkAddr] = struct{}{}
+		}
+		s.files[path] = file
+	}
+	if len(changed) == 0 {
+		return
+	}
 
-	for _, dataLinkAddr := range file.Contents.DataLinkAddrs() {
-		canonicalDataLinkAddr := dataLinkAddr.CanonicalString()
+	// copy the snapshot and redo the addresses that changed
+	prev := s.loadIndex()
+	next := &dirIndex{
+		typeURIsForDataLinkAddr:       make(map[string][]string, len(prev.typeURIsForDataLinkAddr)),
+		fileForDataLinkAddrAndTypeURI: make(map[string]map[string]fileRef, len(prev.fileForDataLinkAddrAndTypeURI)),
+		conflictsForDataLinkAddr:      make(map[string][]Conflict, len(prev.conflictsForDataLinkAddr)),
+	}
+	for canonicalDataLinkAddr, typeURIs := range prev.typeURIsForDataLinkAddr {
+		next.typeURIsForDataLinkAddr[canonicalDataLinkAddr] = typeURIs
+	}
+	for canonicalDataLinkAddr, fileForTypeURI := range prev.fileForDataLinkAddrAndTypeURI {
+		next.fileForDataLinkAddrAndTypeURI[canonicalDataLinkAddr] = fileForTypeURI
+	}
+	for canonicalDataLinkAddr, conflicts := range prev.conflictsForDataLinkAddr {
+		next.conflictsForDataLinkAddr[canonicalDataLinkAddr] = conflicts
+	}
+
+	canonicalDataLinkAddrs := make([]string, 0, len(changed))
+	for canonicalDataLinkAddr := range changed {
+		delete(next.typeURIsForDataLinkAddr, canonicalDataLinkAddr)
+		delete(next.fileForDataLinkAddrAndTypeURI, canonicalDataLinkAddr)
+		delete(next.conflictsForDataLinkAddr, canonicalDataLinkAddr)
+		s.indexDataLinkAddr(next, canonicalDataLinkAddr)
+		s.logConflicts(prev.conflictsForDataLinkAddr[canonicalDataLinkAddr], next.conflictsForDataLinkAddr[canonicalDataLinkAddr])
 		canonicalDataLinkAddrs = append(canonicalDataLinkAddrs, canonicalDataLinkAddr)
-		s.typeURIsForDataLinkAddr[canonicalDataLinkAddr] = append(s.typeURIsForDataLinkAddr[canonicalDataLinkAddr], file.TypeURI())
-		if filePathForTypeURI, ok := s.filePathForDataLinkAddrAndTypeURI[canonicalDataLinkAddr]; ok {
-			filePathForTypeURI[file.TypeURI()] = path
-		} else {
-			s.filePathForDataLinkAddrAndTypeURI[canonicalDataLinkAddr] = map[string]string{
-				file.TypeURI(): path,
+	}
+
+	s.index.Store(next)
+	s.notifier.notify(canonicalDataLinkAddrs...)
+}
+
+// indexDataLinkAddr records the kinds the files naming the data-link address
+// can be served as. A kind a file only supports through projection never
+// replaces a file of that kind, otherwise files under paths added first, then
+// files that sort first, win. The caller must hold the lock.
+func (s *DirStore) indexDataLinkAddr(index *dirIndex, canonicalDataLinkAddr string) {
+	filePaths := make([]string, 0, len(s.filePathsForDataLinkAddr[canonicalDataLinkAddr]))
+	for path := range s.filePathsForDataLinkAddr[canonicalDataLinkAddr] {
+		filePaths = append(filePaths, path)
+	}
+	if len(filePaths) == 0 {
+		return
+	}
+	sort.Slice(filePaths, func(i, j int) bool {
+		if a, b := s.files[filePaths[i]].rank, s.files[filePaths[j]].rank; a != b {
+			return a < b
+		}
+		return filePaths[i] < filePaths[j]
+	})
+
+	// files of the same kind are ambiguous
+	var conflicts []Conflict
+	filePathsForTypeURI := map[string][]string{}
+	for _, path := range filePaths {
+		typeURI := s.files[path].typeURI
+		filePathsForTypeURI[typeURI] = append(filePathsForTypeURI[typeURI], path)
+	}
+	namespace := s.files[filePaths[0]].namespace
+	for typeURI, sources := range filePathsForTypeURI {
+		if len(sources) > 1 {
+			conflicts = append(conflicts, Conflict{
+				Namespace:    namespace,
+				DataLinkAddr: humanReadableKey(namespace, canonicalDataLinkAddr),
+				TypeURI:      typeURI,
+				Sources:      sources,
+				Refused:      s.strict,
+			})
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.Slice(conflicts, func(i, j int) bool {
+			return conflicts[i].TypeURI < conflicts[j].TypeURI
+		})
+		index.conflictsForDataLinkAddr[canonicalDataLinkAddr] = conflicts
+		if s.strict {
+			return
+		}
+	}
+
+	var typeURIs []string
+	fileForTypeURI := map[string]fileRef{}
+	for _, path := range filePaths {
+		file := s.files[path]
+		for _, typeURI := range file.supportedTypeURIs {
+			existing, exists := fileForTypeURI[typeURI]
+			if exists && (typeURI != file.typeURI || s.files[existing.path].typeURI == typeURI) {
+				continue
+			}
+			if !exists {
+				typeURIs = append(typeURIs, typeURI)
 			}
+			fileForTypeURI[typeURI] = fileRef{path, file.hash}
 		}
 	}
-	s.dataLinkAddrsForFilePath[path] = canonicalDataLinkAddrs
 
-	fmt.Printf("didChangeFile(%v)\n", path)
+	index.typeURIsForDataLinkAddr[canonicalDataLinkAddr] = typeURIs
+	index.fileForDataLinkAddrAndTypeURI[canonicalDataLinkAddr] = fileForTypeURI
 }
 
-func (s *DirStore) didRemoveFile(path string) {
-	s.m.Lock()
-	defer s.m.Unlock()
+// logConflicts warns about the conflicts of a data-link address that are new
+// since the last snapshot. The caller must hold the lock.
+func (s *DirStore) logConflicts(prev, next []Conflict) {
+	seen := make(map[string][]string, len(prev))
+	for _, conflict := range prev {
+		seen[conflict.TypeURI] = conflict.Sources
+	}
+	for _, conflict := range next {
+		if sources, ok := seen[conflict.TypeURI]; ok && equalStrings(sources, conflict.Sources) {
+			continue
+		}
+		s.Log().Warn("conflicting documents",
+			zap.String("namespace", conflict.Namespace),
+			zap.String("dataLinkAddr", conflict.DataLinkAddr),
+			zap.String("kind", conflict.TypeURI),
+			zap.Strings("filePaths", conflict.Sources),
+			zap.Bool("refused", conflict.Refused),
+		)
+	}
+	if len(prev) > 0 && len(next) == 0 {
+		s.Log().Info("resolved conflicting documents", zap.String("namespace", prev[0].Namespace), zap.String("dataLinkAddr", prev[0].DataLinkAddr))
+	}
+}
+
+// humanReadableKey is the data-link address of the key of a guest in
+// namespace, as it's written in documents.
+func humanReadableKey(namespace, key string) string {
+	canonicalDataLinkAddr := key
+	if namespace != "" {
+		canonicalDataLinkAddr = strings.TrimPrefix(key, namespace+"/")
+	}
+	dataLinkAddr, err := model.ParseCanonicalAddr(canonicalDataLinkAddr)
+	if err != nil {
+		return canonicalDataLinkAddr
+	}
 
-	// map path to dataLinkAddrs
-	if dataLinkAddrs, ok := s.dataLinkAddrsForFilePath[path]; ok {
-		for _, dataLinkAddr := range dataLinkAddrs {
-			delete(s.typeURIsForDataLinkAddr, dataLinkAddr)
-			delete(s.filePathForDataLinkAddrAndTypeURI, dataLinkAddr)
+	return dataLinkAddr.HumanReadableString()
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
 		}
-		delete(s.dataLinkAddrsForFilePath, path)
 	}
-	s.documentCache.Remove(path)
 
-	fmt.Printf("didRemoveFile(%v)\n", path)
+	return true
 }
 
-func (s *DirStore) getDocument(path string) (*document.Document, error) {
-	if v, ok := s.documentCache.Get(path); ok {
-		if m, ok := v.(*document.Document); ok {
-			return m, nil
+// loadIndex returns the current snapshot of the index.
+func (s *DirStore) loadIndex() *dirIndex {
+	return s.index.Load().(*dirIndex)
+}
+
+// Changed implements `Notifier`
+func (s *DirStore) Changed(canonicalDataLinkAddr string) <-chan struct{} {
+	return s.notifier.Changed(canonicalDataLinkAddr)
+}
+
+// ListConflicts implements `ConflictLister`
+func (s *DirStore) ListConflicts(ctx context.Context) ([]Conflict, error) {
+	index := s.loadIndex()
+
+	ret := []Conflict{}
+	for _, conflicts := range index.conflictsForDataLinkAddr {
+		ret = append(ret, conflicts...)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Namespace != ret[j].Namespace {
+			return ret[i].Namespace < ret[j].Namespace
 		}
+		if ret[i].DataLinkAddr != ret[j].DataLinkAddr {
+			return ret[i].DataLinkAddr < ret[j].DataLinkAddr
+		}
+		return ret[i].TypeURI < ret[j].TypeURI
+	})
+
+	return ret, nil
+}
+
+// CacheStats implements `CacheStatsReporter`
+func (s *DirStore) CacheStats() CacheStats {
+	return CacheStats{
+		Hits:      atomic.LoadUint64(&s.cacheHits),
+		Misses:    atomic.LoadUint64(&s.cacheMisses),
+		Evictions: atomic.LoadUint64(&s.cacheEvictions),
+		Len:       s.documentCache.Len(),
+	}
+}
+
+func (s *DirStore) getDocument(ref fileRef) (*document.Document, error) {
+	if v, ok := s.documentCache.Get(ref); ok {
+		atomic.AddUint64(&s.cacheHits, 1)
+		return v.(*document.Document), nil
 	}
+	atomic.AddUint64(&s.cacheMisses, 1)
+
 	// write-back update the cache
-	file, err := readDocumentFromFile(path)
-	if err != nil {
-		return nil, err
+	file, hash, err := readDocumentFromFile(ref.path)
+	if err != nil || hash != ref.hash {
+		// the file changed since the snapshot, it may be half written or
+		// be for another guest now. it's served once the reload is done.
+		return nil, ErrNotFound
 	}
-	s.documentCache.Add(path, file.Contents)
+	// only the indexed contents are cached, so that removing the entries
+	// of a file when it's re-indexed leaves nothing behind
+	s.m.Lock()
+	if indexed, ok := s.files[ref.path]; ok && indexed.hash == hash {
+		s.cacheDocument(ref, file)
+	}
+	s.m.Unlock()
 
 	return file, nil
 }
 
+func (s *DirStore) cacheDocument(ref fileRef, file *document.Document) {
+	if s.documentCache.Add(ref, file) {
+		atomic.AddUint64(&s.cacheEvictions, 1)
+	}
+}
+
 func (s *DirStore) ListSupportedTypeURIs(ctx context.Context, canonicalDataLinkAddr string) ([]string, error) {
-	if v, ok := s.typeURIsForDataLinkAddr[canonicalDataLinkAddr]; ok {
+	if v, ok := s.loadIndex().typeURIsForDataLinkAddr[canonicalDataLinkAddr]; ok {
 		return v, nil
 	}
 
@@ -241,24 +700,27 @@ func (s *DirStore) ListSupportedTypeURIs(ctx context.Context, canonicalDataLinkA
 }
 
 func (s *DirStore) ListDocuments(ctx context.Context, canonicalDataLinkAddr string) ([]document.Document, error) {
-	typeURIs, err := s.ListSupportedTypeURIs(ctx, canonicalDataLinkAddr)
-	if err != nil {
-		return nil, err
+	// one snapshot for the whole request
+	index := s.loadIndex()
+
+	typeURIs, ok := index.typeURIsForDataLinkAddr[canonicalDataLinkAddr]
+	if !ok {
+		return nil, ErrNotFound
 	}
 
-	if filePathForTypeURI, ok := s.filePathForDataLinkAddrAndTypeURI[canonicalDataLinkAddr]; ok {
-		filePaths := make(map[string]struct{}, len(typeURIs))
+	if fileForTypeURI, ok := index.fileForDataLinkAddrAndTypeURI[canonicalDataLinkAddr]; ok {
+		files := make(map[fileRef]struct{}, len(typeURIs))
 		ret := make([]document.Document, 0, len(typeURIs))
 
 		for _, typeURI := range typeURIs {
-			if filePath, ok := filePathForTypeURI[typeURI]; ok {
-				filePaths[filePath] = struct{}{}
+			if file, ok := fileForTypeURI[typeURI]; ok {
+				files[file] = struct{}{}
 			}
 		}
 		// ensure that the file is unique
-		for filePath := range filePaths {
+		for file := range files {
 			// get metadata from the cache
-			d, err := s.getDocument(filePath)
+			d, err := s.getDocument(file)
 			if err != nil {
 				//return nil, err
 				continue
@@ -273,14 +735,14 @@ func (s *DirStore) ListDocuments(ctx context.Context, canonicalDataLinkAddr stri
 }
 
 func (s *DirStore) GetDocument(ctx context.Context, canonicalDataLinkAddr string, typeURI string) (*document.Document, error) {
-	if filePathForTypeURI, ok := s.filePathForDataLinkAddrAndTypeURI[canonicalDataLinkAddr]; ok {
-		if filePath, ok := filePathForTypeURI[typeURI]; ok {
+	if fileForTypeURI, ok := s.loadIndex().fileForDataLinkAddrAndTypeURI[canonicalDataLinkAddr]; ok {
+		if file, ok := fileForTypeURI[typeURI]; ok {
 			// get metadata from the cache
-			d, err := s.getDocument(filePath)
+			d, err := s.getDocument(file)
 			if err != nil {
 				return nil, err
 			}
-			return d, nil
+			return d.Project(typeURI)
 		}
 	}
 
@@ -305,12 +767,28 @@ type metadataFile struct {
 var errBadFileExtension = errors.New("Bad file extension")
 var errBadPath = errors.New("Bad path")
 
-func readDocumentFromFile(path string) (d *document.Document, err error) {
+func isDocumentFile(path string) bool {
+	switch filepath.Ext(path) {
+	case ".json", ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
+
+// ReadDocumentFile reads a JSON or YAML document file the way a DirStore does.
+func ReadDocumentFile(path string) (*document.Document, error) {
+	d, _, err := readDocumentFromFile(path)
+
+	return d, err
+}
+
+func readDocumentFromFile(path string) (d *document.Document, hash string, err error) {
 	// TODO: limit the file size
 	data, err := ioutil.ReadFile(path)
 
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	if len(data) == 0 {
@@ -321,26 +799,19 @@ func readDocumentFromFile(path string) (d *document.Document, err error) {
 	switch filepath.Ext(path) {
 	case ".json":
 		err = json.Unmarshal(data, &d)
-		if err != nil {
-			d = nil
-			return
-		}
-
-		return
 	case ".yaml":
 		fallthrough
 	case ".yml":
 		err = yaml.Unmarshal(data, &d)
-		if err != nil {
-			d = nil
-			return
-		}
-
-		return
 	default:
 		err = errBadFileExtension
-		return
 	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return d, hex.EncodeToString(sum[:]), nil
 }
 
 func readAndParseMetadataFile(path string) (*metadataFile, error) {
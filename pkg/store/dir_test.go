@@ -0,0 +1,261 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/amari/cloud-metadata-server/pkg/core"
+	ec2v1 "github.com/amari/cloud-metadata-server/pkg/models/amazonaws/ec2/v1"
+	model "github.com/amari/cloud-metadata-server/pkg/models/net"
+)
+
+const (
+	testMACA = "02:00:00:00:00:0a"
+	testMACB = "02:00:00:00:00:0b"
+	testMACC = "02:00:00:00:00:0c"
+)
+
+func testKey(t *testing.T, mac string) string {
+	addr, err := net.ParseMAC(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return model.MACAddr(addr).CanonicalString()
+}
+
+// writeTestDocument writes an EC2 instance document for mac, by writing a
+// temporary file and renaming it over path if rename is set.
+func writeTestDocument(t *testing.T, path, mac, id string, rename bool) {
+	data := []byte(fmt.Sprintf(`{
+	"kind": "amazonaws.com/ec2/v1",
+	"metadata": {
+		"instance_id": %q,
+		"network_interfaces": [{"mac": %q, "device_number": 0}]
+	}
+}`, id, mac))
+
+	if !rename {
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Error(err)
+		}
+		return
+	}
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		t.Error(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Error(err)
+	}
+}
+
+func newTestDirStore(t *testing.T, cacheSize int) (*DirStore, string) {
+	dir, err := ioutil.TempDir("", "dirstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	c, err := core.NewNopServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewDirStore(c, cacheSize, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close(dir) })
+
+	return s, dir
+}
+
+// getInstanceID returns the ID of the instance served for mac, or "" if none
+// is.
+func getInstanceID(t *testing.T, s *DirStore, mac string) string {
+	d, err := s.GetDocument(context.Background(), testKey(t, mac), ec2v1.TypeURI)
+	if err == ErrNotFound {
+		return ""
+	}
+	if err != nil {
+		t.Errorf("GetDocument(%s) = %v", mac, err)
+		return ""
+	}
+
+	instance := d.Contents.(*ec2v1.Instance)
+	for _, ni := range instance.NetworkInterfaces {
+		if net.HardwareAddr(ni.Mac).String() == mac {
+			return instance.ID
+		}
+	}
+	t.Errorf("GetDocument(%s) served %s, a document for another guest", mac, instance.ID)
+
+	return instance.ID
+}
+
+// eventually waits for the store to settle into f returning true.
+func eventually(t *testing.T, f func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatal("store didn't settle")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDirStoreConcurrentChanges(t *testing.T) {
+	// a cache too small for the documents keeps evicting
+	s, dir := newTestDirStore(t, 1)
+
+	writeTestDocument(t, filepath.Join(dir, "a.json"), testMACA, "i-a0", false)
+	if err := s.AddPath(dir); err != nil {
+		t.Fatal(err)
+	}
+	if id := getInstanceID(t, s, testMACA); id != "i-a0" {
+		t.Fatalf("got %q, want i-a0", id)
+	}
+
+	// readers check every answer is for the guest asked about
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				for _, mac := range []string{testMACA, testMACB, testMACC} {
+					getInstanceID(t, s, mac)
+				}
+				s.ListDocuments(context.Background(), testKey(t, testMACA))
+				s.ListSupportedTypeURIs(context.Background(), testKey(t, testMACB))
+			}
+		}()
+	}
+
+	sub := filepath.Join(dir, "sub")
+	for i := 1; i <= 20; i++ {
+		// change
+		writeTestDocument(t, filepath.Join(dir, "a.json"), testMACA, fmt.Sprintf("i-a%d", i), false)
+		// rename over
+		writeTestDocument(t, filepath.Join(dir, "a.json"), testMACA, fmt.Sprintf("i-a%d", i), true)
+		// a file that switches guests
+		mac := testMACB
+		if i%2 == 0 {
+			mac = testMACC
+		}
+		writeTestDocument(t, filepath.Join(dir, "b.json"), mac, fmt.Sprintf("i-b%d", i), i%3 == 0)
+		// add and remove, in a new directory
+		os.MkdirAll(sub, 0755)
+		writeTestDocument(t, filepath.Join(sub, "c.json"), testMACC, "i-c", false)
+		if i%2 == 1 {
+			os.RemoveAll(sub)
+		}
+		time.Sleep(time.Duration(i%4) * 20 * time.Millisecond)
+	}
+
+	close(done)
+	wg.Wait()
+
+	// the last write of each file wins
+	eventually(t, func() bool {
+		return getInstanceID(t, s, testMACA) == "i-a20" &&
+			getInstanceID(t, s, testMACB) == "" &&
+			getInstanceID(t, s, testMACC) == "i-b20"
+	})
+
+	// and removing them empties the store
+	os.Remove(filepath.Join(dir, "a.json"))
+	os.Remove(filepath.Join(dir, "b.json"))
+	os.RemoveAll(sub)
+	eventually(t, func() bool {
+		for _, mac := range []string{testMACA, testMACB, testMACC} {
+			if _, err := s.ListSupportedTypeURIs(context.Background(), testKey(t, mac)); err != ErrNotFound {
+				return false
+			}
+		}
+		return true
+	})
+	if stats := s.CacheStats(); stats.Len != 0 {
+		t.Errorf("%d documents left in the cache", stats.Len)
+	}
+}
+
+func TestDirStoreCacheStats(t *testing.T) {
+	s, dir := newTestDirStore(t, 1)
+
+	writeTestDocument(t, filepath.Join(dir, "a.json"), testMACA, "i-a", false)
+	writeTestDocument(t, filepath.Join(dir, "b.json"), testMACB, "i-b", false)
+	if err := s.AddPath(dir); err != nil {
+		t.Fatal(err)
+	}
+	// indexing b.json evicted a.json
+	if stats := s.CacheStats(); stats.Evictions != 1 || stats.Len != 1 {
+		t.Fatalf("after indexing, got %+v", stats)
+	}
+
+	getInstanceID(t, s, testMACA)
+	getInstanceID(t, s, testMACA)
+	if stats := s.CacheStats(); stats.Hits != 1 || stats.Misses != 1 || stats.Evictions != 2 {
+		t.Fatalf("after reading a.json twice, got %+v", stats)
+	}
+
+	// a changed file is never served from the cache
+	writeTestDocument(t, filepath.Join(dir, "a.json"), testMACA, "i-a2", false)
+	eventually(t, func() bool {
+		return getInstanceID(t, s, testMACA) == "i-a2"
+	})
+}
+
+func TestDirStoreListConflicts(t *testing.T) {
+	s, dir := newTestDirStore(t, 16)
+
+	writeTestDocument(t, filepath.Join(dir, "a.json"), testMACA, "i-a0", false)
+	writeTestDocument(t, filepath.Join(dir, "b.json"), testMACA, "i-a1", false)
+	if err := s.AddPath(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	conflicts, err := s.ListConflicts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 {
+		t.Fatalf("got %d conflicts, want 1", len(conflicts))
+	}
+	// operators look guests up by MAC, not by store key
+	if conflicts[0].DataLinkAddr != testMACA || conflicts[0].Namespace != "" {
+		t.Errorf("conflict for %q in %q, want %s", conflicts[0].DataLinkAddr, conflicts[0].Namespace, testMACA)
+	}
+	if id := getInstanceID(t, s, testMACA); id != "i-a0" {
+		t.Errorf("got %q, want i-a0", id)
+	}
+}
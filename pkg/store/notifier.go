@@ -0,0 +1,66 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import "sync"
+
+// A Notifier is a Store that can report when the documents for a data-link
+// address change.
+type Notifier interface {
+	// Changed returns a channel that is closed the next time a document for
+	// dataLinkAddr is added, changed or removed.
+	Changed(dataLinkAddr string) <-chan struct{}
+}
+
+// changeNotifier broadcasts changes to everyone waiting on a data-link
+// address by closing a shared channel.
+type changeNotifier struct {
+	lock    *sync.Mutex
+	waiters map[string]chan struct{}
+}
+
+func newChangeNotifier() *changeNotifier {
+	return &changeNotifier{
+		lock:    &sync.Mutex{},
+		waiters: map[string]chan struct{}{},
+	}
+}
+
+func (n *changeNotifier) Changed(dataLinkAddr string) <-chan struct{} {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	ch, ok := n.waiters[dataLinkAddr]
+	if !ok {
+		ch = make(chan struct{})
+		n.waiters[dataLinkAddr] = ch
+	}
+
+	return ch
+}
+
+func (n *changeNotifier) notify(dataLinkAddrs ...string) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for _, dataLinkAddr := range dataLinkAddrs {
+		if ch, ok := n.waiters[dataLinkAddr]; ok {
+			close(ch)
+			delete(n.waiters, dataLinkAddr)
+		}
+	}
+}
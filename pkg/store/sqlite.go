@@ -0,0 +1,471 @@
+/*
+Copyright © 2019 Amari Robinson
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/amari/cloud-metadata-server/pkg/core"
+	"github.com/amari/cloud-metadata-server/pkg/models/document"
+	"go.uber.org/zap"
+
+	// registers the "sqlite" driver
+	_ "modernc.org/sqlite"
+)
+
+// sqlitePollInterval is how often a SQLiteStore checks the database for
+// changes, which may be made by other processes.
+const sqlitePollInterval = time.Second
+
+// sqliteChangeRetention is how long rows of the changes table are kept.
+const sqliteChangeRetention = time.Hour
+
+// sqliteMigrations build the schema. PRAGMA user_version is the number of
+// them applied to a database, new ones are only ever appended.
+var sqliteMigrations = []string{
+	`CREATE TABLE documents (
+		id INTEGER PRIMARY KEY,
+		-- name identifies the document to whoever manages it
+		name TEXT NOT NULL UNIQUE,
+		kind TEXT NOT NULL,
+		namespace TEXT NOT NULL DEFAULT '',
+		-- payload is the whole document as JSON
+		payload TEXT NOT NULL,
+		created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now')),
+		updated_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+	);
+
+	-- data_link_addr is the store key, see Key
+	CREATE TABLE document_data_link_addrs (
+		document_id INTEGER NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+		data_link_addr TEXT NOT NULL,
+		PRIMARY KEY (data_link_addr, document_id)
+	) WITHOUT ROWID;
+	CREATE INDEX document_data_link_addrs_document_id ON document_data_link_addrs (document_id);
+
+	-- changes lets every process reading the database find out what changed
+	CREATE TABLE changes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		data_link_addr TEXT NOT NULL,
+		changed_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))
+	);
+	CREATE TRIGGER document_data_link_addrs_inserted AFTER INSERT ON document_data_link_addrs BEGIN
+		INSERT INTO changes (data_link_addr) VALUES (NEW.data_link_addr);
+	END;
+	CREATE TRIGGER document_data_link_addrs_deleted AFTER DELETE ON document_data_link_addrs BEGIN
+		INSERT INTO changes (data_link_addr) VALUES (OLD.data_link_addr);
+	END;
+	CREATE TRIGGER documents_updated AFTER UPDATE ON documents BEGIN
+		INSERT INTO changes (data_link_addr)
+		SELECT data_link_addr FROM document_data_link_addrs WHERE document_id = NEW.id;
+	END;`,
+}
+
+var errSQLiteSchemaTooNew = errors.New("database schema is newer than supported")
+
+// A SQLiteStore is a store backed by a single SQLite database file. Documents
+// for the same data-link address and kind are served in the order they were
+// first added.
+type SQLiteStore struct {
+	*core.Server
+
+	db     *sql.DB
+	doneCh chan struct{}
+	// stoppedCh is closed once the poller is done with the database
+	stoppedCh chan struct{}
+	// wakeCh has the poller check for changes now
+	wakeCh chan struct{}
+
+	// lastChangeID is the row of the changes table last notified about, only
+	// the poller uses it
+	lastChangeID int64
+
+	notifier *changeNotifier
+}
+
+// NewSQLiteStore opens the database at path, creating it if needed, and
+// migrates it to the current schema.
+func NewSQLiteStore(c *core.Server, path string) (*SQLiteStore, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	// sqlite decodes the path of a file: URI, so "?" and "#" in it are
+	// escaped rather than taken for the query or fragment
+	dsn := url.URL{
+		Scheme: "file",
+		Path:   filepath.ToSlash(path),
+		RawQuery: url.Values{
+			"_pragma": {"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)"},
+			// writers take the lock up front rather than fail to upgrade it
+			"_txlock": {"immediate"},
+		}.Encode(),
+	}
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateSQLite(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &SQLiteStore{
+		Server:    c,
+		db:        db,
+		doneCh:    make(chan struct{}),
+		stoppedCh: make(chan struct{}),
+		wakeCh:    make(chan struct{}, 1),
+		notifier:  newChangeNotifier(),
+	}
+	// only changes from now on are news
+	if err := db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM changes`).Scan(&s.lastChangeID); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	go func(s *SQLiteStore) {
+		defer close(s.stoppedCh)
+		poll := time.NewTicker(sqlitePollInterval)
+		defer poll.Stop()
+		prune := time.NewTicker(sqliteChangeRetention)
+		defer prune.Stop()
+
+		for {
+			select {
+			case <-s.doneCh:
+				return
+			case <-poll.C:
+			case <-s.wakeCh:
+			case <-prune.C:
+				if err := s.pruneChanges(); err != nil {
+					s.Log().Warn("failed to prune sqlite store changes", zap.NamedError("error", err))
+				}
+				continue
+			}
+			if err := s.pollChanges(); err != nil {
+				s.Log().Warn("failed to poll sqlite store changes", zap.NamedError("error", err))
+			}
+		}
+	}(s)
+
+	return s, nil
+}
+
+// migrateSQLite applies the migrations the database hasn't had yet.
+func migrateSQLite(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var version int
+	if err := tx.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(sqliteMigrations) {
+		return errSQLiteSchemaTooNew
+	}
+	if version == len(sqliteMigrations) {
+		return nil
+	}
+	for i := version; i < len(sqliteMigrations); i++ {
+		if _, err := tx.ExecContext(ctx, sqliteMigrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+	}
+	// PRAGMA doesn't take parameters
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, len(sqliteMigrations))); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Close() error {
+	close(s.doneCh)
+	<-s.stoppedCh
+
+	return s.db.Close()
+}
+
+// pollChanges notifies about the rows added to the changes table since the
+// last poll.
+func (s *SQLiteStore) pollChanges() error {
+	rows, err := s.db.Query(`SELECT id, data_link_addr FROM changes WHERE id > ? ORDER BY id`, s.lastChangeID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var canonicalDataLinkAddrs []string
+	for rows.Next() {
+		var canonicalDataLinkAddr string
+		if err := rows.Scan(&s.lastChangeID, &canonicalDataLinkAddr); err != nil {
+			return err
+		}
+		canonicalDataLinkAddrs = append(canonicalDataLinkAddrs, canonicalDataLinkAddr)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.notifier.notify(canonicalDataLinkAddrs...)
+
+	return nil
+}
+
+func (s *SQLiteStore) pruneChanges() error {
+	before := time.Now().Add(-sqliteChangeRetention).UTC().Format(sqliteTimeFormat)
+	_, err := s.db.Exec(`DELETE FROM changes WHERE changed_at < ?`, before)
+
+	return err
+}
+
+// sqliteTimeFormat matches strftime('%Y-%m-%dT%H:%M:%fZ'), so timestamps
+// compare as text.
+const sqliteTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// wake has the poller check for changes without waiting.
+func (s *SQLiteStore) wake() {
+	select {
+	case s.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// PutDocument adds the document, or replaces the one with the same name.
+func (s *SQLiteStore) PutDocument(ctx context.Context, name string, d *document.Document) error {
+	payload, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(sqliteTimeFormat)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO documents (name, kind, namespace, payload, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			kind = excluded.kind,
+			namespace = excluded.namespace,
+			payload = excluded.payload,
+			updated_at = excluded.updated_at
+		RETURNING id`,
+		name, d.TypeURI(), d.Namespace, string(payload), now, now,
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM document_data_link_addrs WHERE document_id = ?`, id); err != nil {
+		return err
+	}
+	for _, dataLinkAddr := range d.Contents.DataLinkAddrs() {
+		_, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO document_data_link_addrs (document_id, data_link_addr) VALUES (?, ?)`,
+			id, Key(d.Namespace, dataLinkAddr.CanonicalString()))
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.wake()
+
+	return nil
+}
+
+// DeleteDocument removes the document with the given name.
+func (s *SQLiteStore) DeleteDocument(ctx context.Context, name string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the addresses go first, so the change is recorded whether or not
+	// foreign keys are enforced
+	_, err = tx.ExecContext(ctx, `DELETE FROM document_data_link_addrs WHERE document_id IN (SELECT id FROM documents WHERE name = ?)`, name)
+	if err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM documents WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.wake()
+
+	return nil
+}
+
+// A sqliteRow is a document naming a data-link address, not yet decoded.
+type sqliteRow struct {
+	kind    string
+	payload string
+}
+
+// listRows returns the documents naming the data-link address, oldest first.
+func (s *SQLiteStore) listRows(ctx context.Context, canonicalDataLinkAddr string) ([]sqliteRow, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT documents.kind, documents.payload
+		FROM document_data_link_addrs
+		JOIN documents ON documents.id = document_data_link_addrs.document_id
+		WHERE document_data_link_addrs.data_link_addr = ?
+		ORDER BY documents.id`,
+		canonicalDataLinkAddr,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []sqliteRow
+	for rows.Next() {
+		var row sqliteRow
+		if err := rows.Scan(&row.kind, &row.payload); err != nil {
+			return nil, err
+		}
+		ret = append(ret, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return ret, nil
+}
+
+// resolveRows returns the kinds the documents can be served as and which
+// document serves each. Like a DirStore, a kind a document only supports
+// through projection never replaces a document of that kind, otherwise the
+// first one wins.
+func resolveRows(rows []sqliteRow) (typeURIs []string, rowForTypeURI map[string]int) {
+	rowForTypeURI = map[string]int{}
+	for i, row := range rows {
+		for _, typeURI := range (&document.Document{Kind: row.kind}).SupportedTypeURIs() {
+			existing, exists := rowForTypeURI[typeURI]
+			if exists && (typeURI != row.kind || rows[existing].kind == typeURI) {
+				continue
+			}
+			if !exists {
+				typeURIs = append(typeURIs, typeURI)
+			}
+			rowForTypeURI[typeURI] = i
+		}
+	}
+
+	return typeURIs, rowForTypeURI
+}
+
+func decodeRow(row sqliteRow) (*document.Document, error) {
+	var d document.Document
+	if err := json.Unmarshal([]byte(row.payload), &d); err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+func (s *SQLiteStore) ListSupportedTypeURIs(ctx context.Context, canonicalDataLinkAddr string) ([]string, error) {
+	rows, err := s.listRows(ctx, canonicalDataLinkAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	typeURIs, _ := resolveRows(rows)
+
+	return typeURIs, nil
+}
+
+func (s *SQLiteStore) ListDocuments(ctx context.Context, canonicalDataLinkAddr string) ([]document.Document, error) {
+	rows, err := s.listRows(ctx, canonicalDataLinkAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	typeURIs, rowForTypeURI := resolveRows(rows)
+	// ensure that the document is unique
+	seen := make(map[int]struct{}, len(typeURIs))
+	ret := make([]document.Document, 0, len(typeURIs))
+	for _, typeURI := range typeURIs {
+		i := rowForTypeURI[typeURI]
+		if _, ok := seen[i]; ok {
+			continue
+		}
+		seen[i] = struct{}{}
+
+		d, err := decodeRow(rows[i])
+		if err != nil {
+			s.Log().Warn("failed to decode document", zap.NamedError("error", err), zap.String("canonicalDataLinkAddr", canonicalDataLinkAddr))
+			continue
+		}
+		ret = append(ret, *d)
+	}
+
+	return ret, nil
+}
+
+func (s *SQLiteStore) GetDocument(ctx context.Context, canonicalDataLinkAddr string, typeURI string) (*document.Document, error) {
+	rows, err := s.listRows(ctx, canonicalDataLinkAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	_, rowForTypeURI := resolveRows(rows)
+	i, ok := rowForTypeURI[typeURI]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	d, err := decodeRow(rows[i])
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Project(typeURI)
+}
+
+// Changed implements `Notifier`
+func (s *SQLiteStore) Changed(canonicalDataLinkAddr string) <-chan struct{} {
+	return s.notifier.Changed(canonicalDataLinkAddr)
+}
@@ -38,6 +38,44 @@ type Store interface {
 
 var ErrNotFound = errors.New("Not found")
 
+// A Conflict is a data-link address that more than one document claims as
+// the same kind.
+type Conflict struct {
+	// Namespace is the network namespace of the guest, empty for the
+	// process's own.
+	Namespace string `json:"namespace,omitempty"`
+	// DataLinkAddr is the address in colon-hex form, e.g. 04:01:2a:0f:2a:01.
+	DataLinkAddr string `json:"dataLinkAddr"`
+	TypeURI      string `json:"kind"`
+	// Sources are where the documents are, in order of precedence. The first
+	// one is served unless the store refuses ambiguous addresses.
+	Sources []string `json:"sources"`
+	// Refused is whether the data-link address isn't served because of it.
+	Refused bool `json:"refused"`
+}
+
+// A ConflictLister is a store that detects conflicting documents.
+type ConflictLister interface {
+	ListConflicts(ctx context.Context) ([]Conflict, error)
+}
+
+// A CacheStatsReporter is a store that caches documents.
+type CacheStatsReporter interface {
+	CacheStats() CacheStats
+}
+
+// Key is what stores look guests up by: the canonical data-link address,
+// qualified by the named network namespace the guest lives in so tenants
+// reusing addresses each get their own documents. Namespace names can't
+// contain "/".
+func Key(namespace string, canonicalDataLinkAddr string) string {
+	if namespace == "" {
+		return canonicalDataLinkAddr
+	}
+
+	return namespace + "/" + canonicalDataLinkAddr
+}
+
 /*type Store interface {
 	//TypeURIForHardwareAddr(ctx context.Context, addr net.HardwareAddr) (string, error)
 